@@ -0,0 +1,213 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+)
+
+// Backends dispatches the calls to the Client serving the chain designated in the request Metadata, allowing to
+// serve multiple networks (e.g. mainnet and testnet) from different backend groups. Calls for chains that weren't
+// explicitly assigned to a group are sent to the default Client.
+type Backends struct {
+	def     *Client
+	clients []*Client
+	// groups maps the hex-encoded chainhashes and beacon IDs assigned to a group to its Client
+	groups map[string]*Client
+	// allowed holds the hex-encoded chainhashes and beacon IDs we are allowed to serve, all chains are served if empty
+	allowed map[string]struct{}
+	log     logger
+}
+
+// NewBackends returns a Backends using the provided Client as the default one. It is not thread safe to Add new groups
+// once it is used to serve requests.
+func NewBackends(def *Client, l logger) *Backends {
+	return &Backends{
+		def:     def,
+		clients: []*Client{def},
+		groups:  make(map[string]*Client),
+		log:     l,
+	}
+}
+
+// Add assigns the provided chains, designated by their hex-encoded chainhash or their beacon ID, to the given Client.
+// When a chain is designated by its beacon ID, its chainhash is also assigned to the Client, but not the other way
+// around, since beacon IDs are typically not unique across networks.
+func (b *Backends) Add(ctx context.Context, c *Client, chains ...string) {
+	b.clients = append(b.clients, c)
+	for _, chain := range chains {
+		chain = strings.ToLower(strings.TrimSpace(chain))
+		b.groups[chain] = c
+
+		if _, err := hex.DecodeString(chain); err == nil && len(chain) == 64 {
+			continue
+		}
+
+		info, err := c.GetChainInfo(ctx, &proto.Metadata{BeaconID: chain})
+		if err != nil {
+			b.log.Warn("unable to get chain info for beacon ID assigned to backend group", "beaconID", chain, "group", c, "err", err)
+			continue
+		}
+		b.groups[info.Hash.String()] = c
+	}
+}
+
+// Allow restricts the chains served by the Backends to the provided ones, designated by their hex-encoded chainhash
+// or their beacon ID. Note that allowing a beacon ID allows it on all networks.
+func (b *Backends) Allow(chains ...string) {
+	if b.allowed == nil {
+		b.allowed = make(map[string]struct{}, len(chains))
+	}
+	for _, chain := range chains {
+		b.allowed[strings.ToLower(strings.TrimSpace(chain))] = struct{}{}
+	}
+}
+
+// Allowed checks whether the chain designated in the provided Metadata is allowed to be served. It relies on the
+// cached chain info to match chainhashes with beacon IDs.
+func (b *Backends) Allowed(ctx context.Context, m *proto.Metadata) bool {
+	if len(b.allowed) == 0 {
+		return true
+	}
+	if b.isAllowed(hex.EncodeToString(m.GetChainHash()), m.GetBeaconID()) {
+		return true
+	}
+
+	info, err := b.For(m).GetChainInfo(ctx, m)
+	if err != nil {
+		b.log.Debug("unable to get chain info to check allowlist", "err", err)
+		return false
+	}
+	return b.isAllowed(info.Hash.String(), info.BeaconId)
+}
+
+func (b *Backends) isAllowed(hash, beaconID string) bool {
+	if len(b.allowed) == 0 {
+		return true
+	}
+	if _, ok := b.allowed[hash]; ok {
+		return true
+	}
+	_, ok := b.allowed[beaconID]
+	return ok
+}
+
+// Known checks whether the chain designated by chainhash in the provided Metadata is served by its Client, see
+// Client.Knows. The chains designated by their beacon ID are left for the backends to check.
+func (b *Backends) Known(ctx context.Context, m *proto.Metadata) bool {
+	if len(m.GetChainHash()) == 0 {
+		return true
+	}
+	return b.For(m).Knows(ctx, hex.EncodeToString(m.GetChainHash()))
+}
+
+// For returns the Client serving the chain designated in the provided Metadata.
+func (b *Backends) For(m *proto.Metadata) *Client {
+	if len(b.groups) == 0 {
+		return b.def
+	}
+	if c, ok := b.groups[hex.EncodeToString(m.GetChainHash())]; ok {
+		return c
+	}
+	if c, ok := b.groups[m.GetBeaconID()]; ok {
+		return c
+	}
+	return b.def
+}
+
+// GetBeacon fetches the requested beacon from the Client serving the chain designated in the Metadata.
+func (b *Backends) GetBeacon(ctx context.Context, m *proto.Metadata, round uint64) (*HexBeacon, error) {
+	return b.For(m).GetBeacon(ctx, m, round)
+}
+
+// GetChainInfo fetches the chain info from the Client serving the chain designated in the Metadata.
+func (b *Backends) GetChainInfo(ctx context.Context, m *proto.Metadata) (*JsonInfoV2, error) {
+	return b.For(m).GetChainInfo(ctx, m)
+}
+
+// Next waits for the next beacon from the Client serving the chain designated in the Metadata.
+func (b *Backends) Next(ctx context.Context, m *proto.Metadata) (*HexBeacon, error) {
+	return b.For(m).Next(ctx, m)
+}
+
+// Watch returns new randomness from the Client serving the chain designated in the Metadata.
+func (b *Backends) Watch(ctx context.Context, m *proto.Metadata) <-chan *HexBeacon {
+	return b.For(m).Watch(ctx, m)
+}
+
+// GetChains returns the chainhashes available on all backend groups, without duplicates.
+func (b *Backends) GetChains(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	var chains []string
+	for _, c := range b.clients {
+		cs, err := c.GetChains(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, chain := range cs {
+			if _, ok := seen[chain]; ok {
+				continue
+			}
+			if len(b.allowed) > 0 && !b.Allowed(ctx, &proto.Metadata{ChainHash: mustDecode(chain)}) {
+				continue
+			}
+			seen[chain] = struct{}{}
+			chains = append(chains, chain)
+		}
+	}
+	return chains, nil
+}
+
+// GetBeaconIds returns the beacon IDs and their metadata available on all backend groups. The same beacon ID can
+// appear multiple times if it is served by different networks, the metadata allows to distinguish them.
+func (b *Backends) GetBeaconIds(ctx context.Context) ([]string, []*proto.Metadata, error) {
+	var ids []string
+	var metadatas []*proto.Metadata
+	seen := make(map[string]struct{})
+	for _, c := range b.clients {
+		is, ms, err := c.GetBeaconIds(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, m := range ms {
+			hash := hex.EncodeToString(m.GetChainHash())
+			if _, ok := seen[hash]; ok {
+				continue
+			}
+			if !b.isAllowed(hash, is[i]) {
+				continue
+			}
+			seen[hash] = struct{}{}
+			ids = append(ids, is[i])
+			metadatas = append(metadatas, m)
+		}
+	}
+	return ids, metadatas, nil
+}
+
+// Close closes all the underlying Clients, returning the first error encountered.
+func (b *Backends) Close() error {
+	var ret error
+	for _, c := range b.clients {
+		if err := c.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// mustDecode decodes the hex-encoded chainhashes we produce ourselves in GetChains.
+func mustDecode(chain string) []byte {
+	hash, _ := hex.DecodeString(chain)
+	return hash
+}
+
+func (b *Backends) String() string {
+	addrs := make([]string, 0, len(b.clients))
+	for _, c := range b.clients {
+		addrs = append(addrs, c.String())
+	}
+	return strings.Join(addrs, ";")
+}
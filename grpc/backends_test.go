@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendsFor(t *testing.T) {
+	// the clients are never reached, the groups are only designated by chainhash or by beacon ID
+	def, _ := NewClient("localhost:1", slog.Default())
+	group, _ := NewClient("localhost:2", slog.Default())
+	b := NewBackends(def, slog.Default())
+	defer b.Close()
+
+	chain := "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	b.Add(ctx, group, " "+chain+" ", "Quicknet")
+
+	hash, err := hex.DecodeString(chain)
+	require.NoError(t, err)
+	require.Same(t, group, b.For(&proto.Metadata{ChainHash: hash}))
+	require.Same(t, group, b.For(&proto.Metadata{BeaconID: "quicknet"}))
+	require.Same(t, def, b.For(&proto.Metadata{BeaconID: "default"}))
+	require.Same(t, def, b.For(&proto.Metadata{ChainHash: []byte{1, 2, 3}}))
+	require.Equal(t, "localhost:1;localhost:2", b.String())
+}
+
+func TestBackendsAllow(t *testing.T) {
+	def, _ := NewClient("localhost:1", slog.Default())
+	b := NewBackends(def, slog.Default())
+	defer b.Close()
+
+	ctx := context.Background()
+	require.True(t, b.Allowed(ctx, &proto.Metadata{BeaconID: "default"}), "expected all chains to be allowed without allowlist")
+
+	chain := "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"
+	b.Allow(strings.ToUpper(chain), " quicknet")
+	hash, err := hex.DecodeString(chain)
+	require.NoError(t, err)
+	require.True(t, b.Allowed(ctx, &proto.Metadata{ChainHash: hash}))
+	require.True(t, b.Allowed(ctx, &proto.Metadata{BeaconID: "quicknet"}))
+	// the other chains can't be matched without their chain info, and the backend is unreachable
+	require.False(t, b.Allowed(ctx, &proto.Metadata{BeaconID: "default"}))
+}
@@ -27,6 +27,21 @@ func (h *HexBeacon) UnsetRandomness() {
 	h.Randomness = nil
 }
 
+// ApplyScheme makes sure the beacon is consistent with the provided scheme, rather than relying on what the backend
+// sent us: beacons of unchained schemes never have a previous signature. Note that all schemes currently derive their
+// randomness from the signature in the same way, so SetRandomness is scheme-agnostic.
+func (h *HexBeacon) ApplyScheme(scheme string) {
+	if !IsChained(scheme) {
+		h.PreviousSignature = nil
+	}
+}
+
+// IsChained returns whether the provided scheme ID is a chained one, i.e. whether its beacons depend on the previous
+// signature. An empty scheme ID designates the default, chained, scheme.
+func IsChained(scheme string) bool {
+	return scheme == "" || scheme == crypto.DefaultSchemeID
+}
+
 func (h *HexBeacon) GetRandomness() []byte {
 	return h.Randomness
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/drand/drand/v2/crypto"
 	proto "github.com/drand/drand/v2/protobuf/drand"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -222,3 +223,24 @@ func TestHexBytes_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyScheme(t *testing.T) {
+	tests := []struct {
+		scheme   string
+		keepPrev bool
+	}{
+		{"", true},
+		{crypto.DefaultSchemeID, true},
+		{crypto.UnchainedSchemeID, false},
+		{crypto.ShortSigSchemeID, false},
+		{crypto.SigsOnG1ID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			beacon := &HexBeacon{Round: 1, Signature: []byte{1}, PreviousSignature: []byte{2}}
+			beacon.ApplyScheme(tt.scheme)
+			assert.Equal(t, tt.keepPrev, beacon.PreviousSignature != nil)
+			assert.Equal(t, tt.keepPrev, IsChained(tt.scheme))
+		})
+	}
+}
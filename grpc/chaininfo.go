@@ -0,0 +1,99 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"golang.org/x/sync/errgroup"
+)
+
+// ChainInfoRefresh is the default interval at which the Clients revalidate their cached chain infos with the backends,
+// see WithChainInfoRefresh, since they can change across reshares, and look for newly added chains. Disabled when set
+// to 0.
+var ChainInfoRefresh = 10 * time.Minute
+
+// ChainInfoChanges is counting the changes of the cached chain infos found when revalidating them, per chain
+var ChainInfoChanges = defaultMetrics.chainInfoChanges
+
+// runChainInfoRefresh revalidates the cached chain infos at the provided interval until the Client is closed.
+func (c *Client) runChainInfoRefresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), chainsRefreshTimeout)
+			c.refreshChainInfos(ctx)
+			cancel()
+		}
+	}
+}
+
+// refreshChainInfos revalidates the cached chain infos with the backends, replacing the ones that changed, and then
+// looks for newly added chains.
+func (c *Client) refreshChainInfos(ctx context.Context) {
+	cached := make(map[string]*JsonInfoV2)
+	c.knownChains.Range(func(_, v any) bool {
+		if info, ok := v.(*JsonInfoV2); ok {
+			cached[info.Hash.String()] = info
+		}
+		return true
+	})
+
+	var g errgroup.Group
+	g.SetLimit(chainInfoWorkers)
+	for _, old := range cached {
+		g.Go(func() error {
+			c.refreshChainInfo(ctx, old)
+			return nil
+		})
+	}
+	g.Wait()
+
+	if _, err := c.fetchChains(ctx); err != nil {
+		c.log.Warn("unable to look for new chains while refreshing chain infos", "err", err)
+	}
+}
+
+// refreshChainInfo fetches the chain info of the chain of the provided cached one, replacing it if it changed. The chain
+// is designated by its beacon ID when it has one, since its chainhash could be the part that changed.
+func (c *Client) refreshChainInfo(ctx context.Context, old *JsonInfoV2) {
+	m := &proto.Metadata{ChainHash: old.Hash}
+	if old.BeaconId != "" {
+		m = &proto.Metadata{BeaconID: old.BeaconId}
+	}
+	resp, err := c.pc.ChainInfo(withChain(ctx, m), &proto.ChainInfoRequest{Metadata: m})
+	if err != nil {
+		c.log.Warn("unable to revalidate cached chain info", "chain", old.Hash, "beaconID", old.BeaconId, "err", wrapError(err))
+		return
+	}
+
+	info := NewInfoV2(resp)
+	if old.Equal(info) {
+		return
+	}
+	c.log.Warn("cached chain info changed", "beaconID", old.BeaconId, "old", old.Hash, "new", info.Hash)
+	c.metrics.chainInfoChanges.WithLabelValues(chainKey(m)).Inc()
+	if !bytes.Equal(old.Hash, info.Hash) {
+		c.knownChains.Delete(old.Hash.String())
+	}
+	c.knownChains.Store(info.Hash.String(), info)
+	if info.BeaconId != "" {
+		c.knownChains.Store(info.BeaconId, info)
+	}
+}
+
+// Equal reports whether both chain infos are the same.
+func (info *JsonInfoV2) Equal(other *JsonInfoV2) bool {
+	return bytes.Equal(info.PublicKey, other.PublicKey) &&
+		info.Period == other.Period &&
+		info.GenesisTime == other.GenesisTime &&
+		bytes.Equal(info.GenesisSeed, other.GenesisSeed) &&
+		bytes.Equal(info.Hash, other.Hash) &&
+		info.Scheme == other.Scheme &&
+		info.BeaconId == other.BeaconId
+}
@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"testing"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// infoClient is a PublicClient serving the provided chain infos, keyed by beacon ID.
+type infoClient struct {
+	proto.PublicClient
+	mu    sync.Mutex
+	infos map[string]*proto.ChainInfoPacket
+}
+
+func (s *infoClient) ListBeaconIDs(context.Context, *proto.ListBeaconIDsRequest, ...grpc.CallOption) (*proto.ListBeaconIDsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &proto.ListBeaconIDsResponse{}
+	for id, info := range s.infos {
+		resp.Ids = append(resp.Ids, id)
+		resp.Metadatas = append(resp.Metadatas, info.GetMetadata())
+	}
+	return resp, nil
+}
+
+func (s *infoClient) ChainInfo(_ context.Context, in *proto.ChainInfoRequest, _ ...grpc.CallOption) (*proto.ChainInfoPacket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, info := range s.infos {
+		if id == in.GetMetadata().GetBeaconID() || string(info.GetHash()) == string(in.GetMetadata().GetChainHash()) {
+			return info, nil
+		}
+	}
+	return nil, status.Error(codes.InvalidArgument, "unknown beacon ID")
+}
+
+func (s *infoClient) set(id, hash string, period uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.infos[id] = &proto.ChainInfoPacket{Hash: []byte(hash), Period: period, Metadata: &proto.Metadata{ChainHash: []byte(hash), BeaconID: id}}
+}
+
+func TestRefreshChainInfos(t *testing.T) {
+	pc := &infoClient{infos: make(map[string]*proto.ChainInfoPacket)}
+	pc.set("quicknet", "quick-hash", 3)
+	c := &Client{pc: pc, log: slog.Default(), metrics: defaultMetrics}
+	_, err := c.fetchChains(context.Background())
+	require.NoError(t, err)
+	changes := testutil.ToFloat64(ChainInfoChanges.WithLabelValues("quicknet"))
+
+	// nothing changed
+	c.refreshChainInfos(context.Background())
+	require.Equal(t, changes, testutil.ToFloat64(ChainInfoChanges.WithLabelValues("quicknet")))
+
+	// a reshare changed the chain info, and a new chain appeared
+	pc.set("quicknet", "reshared-hash", 3)
+	pc.set("evmnet", "evm-hash", 1)
+	c.refreshChainInfos(context.Background())
+	require.Equal(t, changes+1, testutil.ToFloat64(ChainInfoChanges.WithLabelValues("quicknet")))
+
+	info, err := c.GetChainInfo(context.Background(), &proto.Metadata{BeaconID: "quicknet"})
+	require.NoError(t, err)
+	require.Equal(t, "reshared-hash", string(info.Hash))
+	_, ok := c.knownChains.Load(hex.EncodeToString([]byte("quick-hash")))
+	require.False(t, ok, "the outdated chainhash must be forgotten")
+	info, err = c.GetChainInfo(context.Background(), &proto.Metadata{BeaconID: "evmnet"})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), info.Period)
+}
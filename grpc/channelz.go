@@ -0,0 +1,238 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ChannelzInterval is how often the channelz data of the grpc channels to the backends is collected, so that the
+// metrics scrapes only read it. It is only collected once when set to 0.
+var ChannelzInterval = 15 * time.Second
+
+// channelzTimeout bounds the queries to the local channelz server of each collection.
+const channelzTimeout = 5 * time.Second
+
+// channelzLabels are the labels of the channelz metrics: the kind, either channel or subchannel, and the target, which
+// is the address of the backend for the subchannels.
+var channelzLabels = []string{"kind", "target"}
+
+var (
+	channelzCallsStarted = prometheus.NewDesc("grpc_server_calls_started_total",
+		"The total number of gRPC server calls started.", channelzLabels, nil)
+	channelzCallsSucceeded = prometheus.NewDesc("grpc_server_calls_succeeded_total",
+		"The total number of gRPC server calls succeeded.", channelzLabels, nil)
+	channelzCallsFailed = prometheus.NewDesc("grpc_server_calls_failed_total",
+		"The total number of gRPC server failed calls.", channelzLabels, nil)
+	channelzLastCallStarted = prometheus.NewDesc("grpc_server_last_call_started_seconds",
+		"The timestamp of the last gRPC call started.", channelzLabels, nil)
+	channelzState = prometheus.NewDesc("grpc_server_current_state",
+		"Current state of the gRPC channel or subchannel. 0: UNKNOWN; 1: IDLE; 2: CONNECTING; 3: READY; 4: TRANSIENT_FAILURE; 5: SHUTDOWN",
+		channelzLabels, nil)
+)
+
+// ChannelzChannel is the channelz data of a grpc channel, or of one of its subchannels.
+type ChannelzChannel struct {
+	ID              int64             `json:"id"`
+	Target          string            `json:"target"`
+	State           string            `json:"state"`
+	CallsStarted    int64             `json:"calls_started"`
+	CallsSucceeded  int64             `json:"calls_succeeded"`
+	CallsFailed     int64             `json:"calls_failed"`
+	LastCallStarted string            `json:"last_call_started,omitempty"`
+	Subchannels     []ChannelzChannel `json:"subchannels,omitempty"`
+
+	state    grpc_channelz_v1.ChannelConnectivityState_State
+	lastCall time.Time
+}
+
+// newChannelzChannel returns the channelz data of the channel or subchannel with the provided ID.
+func newChannelzChannel(id int64, data *grpc_channelz_v1.ChannelData) ChannelzChannel {
+	c := ChannelzChannel{
+		ID:             id,
+		Target:         data.GetTarget(),
+		State:          data.GetState().GetState().String(),
+		CallsStarted:   data.GetCallsStarted(),
+		CallsSucceeded: data.GetCallsSucceeded(),
+		CallsFailed:    data.GetCallsFailed(),
+		state:          data.GetState().GetState(),
+	}
+	if ts := data.GetLastCallStartedTimestamp(); ts != nil {
+		c.lastCall = ts.AsTime()
+		c.LastCallStarted = c.lastCall.Format(time.RFC3339)
+	}
+	return c
+}
+
+// merge adds the calls of o to the ones of c, which takes the state of the most recently used of both, so that the
+// channels and subchannels sharing their target are reported once.
+func (c *ChannelzChannel) merge(o ChannelzChannel) {
+	c.CallsStarted += o.CallsStarted
+	c.CallsSucceeded += o.CallsSucceeded
+	c.CallsFailed += o.CallsFailed
+	if o.lastCall.After(c.lastCall) {
+		c.lastCall, c.LastCallStarted = o.lastCall, o.LastCallStarted
+		c.state, c.State = o.state, o.State
+	}
+}
+
+// LocalMetricClient queries a local channelz server about the grpc channels of the relay. It is a prometheus
+// Collector exposing their data as of the last collection.
+type LocalMetricClient struct {
+	grpc_channelz_v1.ChannelzClient
+	addr string
+
+	mu       sync.RWMutex
+	channels []ChannelzChannel
+}
+
+// CreateChannelzMonitor creates a localhost channelz server and a `metricClient` for it.
+func CreateChannelzMonitor() (*LocalMetricClient, error) {
+	// Channelz monitoring works by having a local GRPC server responding to Channelz queries using GRPC.
+	metricServer := grpc.NewServer()
+	service.RegisterChannelzServiceToServer(metricServer)
+	//	If the port in the address parameter is empty or "0", as in
+	// "127.0.0.1:" or "[::1]:0", a port number is automatically chosen
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		slog.Error("failed to listen on grpc metrics", "err", err)
+		return nil, err
+	}
+
+	go func() {
+		if err := metricServer.Serve(lis); err != nil {
+			slog.Error("error serving grpc metrics", "err", err)
+		}
+	}()
+
+	// create our global metric client
+	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		slog.Error("Error building channelz client, shutting down server now", "err", err)
+		metricServer.GracefulStop()
+		return nil, err
+	}
+	return &LocalMetricClient{
+		ChannelzClient: grpc_channelz_v1.NewChannelzClient(cc),
+		addr:           lis.Addr().String(),
+		channels:       []ChannelzChannel{},
+	}, nil
+}
+
+// Channels returns the channelz data of the grpc channels, along with their subchannels, as of their last collection.
+func (l *LocalMetricClient) Channels() []ChannelzChannel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.channels
+}
+
+// CollectMetrics collects the channelz data right away and then every interval, if positive, until ctx is done.
+func (l *LocalMetricClient) CollectMetrics(ctx context.Context, interval time.Duration) {
+	l.collect(ctx)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.collect(ctx)
+		}
+	}
+}
+
+// collect replaces the channelz data with the one currently served by the channelz server, keeping the previous one
+// when it fails.
+func (l *LocalMetricClient) collect(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, channelzTimeout)
+	defer cancel()
+	channels, err := l.fetchChannels(ctx)
+	if err != nil {
+		slog.Error("error collecting channelz data", "err", err)
+		return
+	}
+	l.mu.Lock()
+	l.channels = channels
+	l.mu.Unlock()
+}
+
+// fetchChannels queries the channelz server about all the grpc channels and their subchannels, except the ones of our
+// own channelz client.
+func (l *LocalMetricClient) fetchChannels(ctx context.Context) ([]ChannelzChannel, error) {
+	channels := make([]ChannelzChannel, 0)
+	var start int64
+	for {
+		resp, err := l.GetTopChannels(ctx, &grpc_channelz_v1.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return nil, fmt.Errorf("GetTopChannels: %w", err)
+		}
+		for _, ch := range resp.GetChannel() {
+			start = ch.GetRef().GetChannelId() + 1
+			c := newChannelzChannel(ch.GetRef().GetChannelId(), ch.GetData())
+			if c.Target == l.addr {
+				// we don't need metrics about our local metric server and metric client
+				continue
+			}
+			for _, ref := range ch.GetSubchannelRef() {
+				subr, err := l.GetSubchannel(ctx, &grpc_channelz_v1.GetSubchannelRequest{SubchannelId: ref.GetSubchannelId()})
+				if err != nil {
+					return nil, fmt.Errorf("GetSubchannel %d: %w", ref.GetSubchannelId(), err)
+				}
+				c.Subchannels = append(c.Subchannels, newChannelzChannel(ref.GetSubchannelId(), subr.GetSubchannel().GetData()))
+			}
+			channels = append(channels, c)
+		}
+		if resp.GetEnd() || len(resp.GetChannel()) == 0 {
+			return channels, nil
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (l *LocalMetricClient) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{channelzCallsStarted, channelzCallsSucceeded, channelzCallsFailed, channelzLastCallStarted, channelzState} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector, reporting the channels and subchannels by target.
+func (l *LocalMetricClient) Collect(ch chan<- prometheus.Metric) {
+	type key struct{ kind, target string }
+	byTarget := make(map[key]*ChannelzChannel)
+	add := func(kind string, c ChannelzChannel) {
+		k := key{kind, c.Target}
+		if prev, ok := byTarget[k]; ok {
+			prev.merge(c)
+			return
+		}
+		byTarget[k] = &c
+	}
+	for _, c := range l.Channels() {
+		add("channel", c)
+		for _, sc := range c.Subchannels {
+			add("subchannel", sc)
+		}
+	}
+
+	for k, c := range byTarget {
+		ch <- prometheus.MustNewConstMetric(channelzCallsStarted, prometheus.CounterValue, float64(c.CallsStarted), k.kind, k.target)
+		ch <- prometheus.MustNewConstMetric(channelzCallsSucceeded, prometheus.CounterValue, float64(c.CallsSucceeded), k.kind, k.target)
+		ch <- prometheus.MustNewConstMetric(channelzCallsFailed, prometheus.CounterValue, float64(c.CallsFailed), k.kind, k.target)
+		if !c.lastCall.IsZero() {
+			ch <- prometheus.MustNewConstMetric(channelzLastCallStarted, prometheus.GaugeValue, float64(c.lastCall.Unix()), k.kind, k.target)
+		}
+		ch <- prometheus.MustNewConstMetric(channelzState, prometheus.GaugeValue, float64(c.state), k.kind, k.target)
+	}
+}
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+// subchannel returns the collected channelz data of the subchannel to addr, if any.
+func subchannel(l *LocalMetricClient, addr string) (ChannelzChannel, bool) {
+	for _, c := range l.Channels() {
+		for _, sc := range c.Subchannels {
+			if sc.Target == addr {
+				return sc, true
+			}
+		}
+	}
+	return ChannelzChannel{}, false
+}
+
+func TestCollectMetrics(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	addr := serveMock(t, m)
+
+	c, err := NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.GetBeacon(context.Background(), m.metadata(), 5)
+	require.NoError(t, err)
+
+	mClient, err := CreateChannelzMonitor()
+	require.NoError(t, err)
+	require.Empty(t, mClient.Channels(), "expected no channelz data before the first collection")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mClient.CollectMetrics(ctx, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		sc, ok := subchannel(mClient, addr)
+		return ok && sc.CallsSucceeded > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	for _, c := range mClient.Channels() {
+		require.NotEqual(t, mClient.addr, c.Target, "expected the channelz client to be left out")
+	}
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(mClient))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	states := make(map[string]float64)
+	for _, f := range families {
+		if f.GetName() != "grpc_server_current_state" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			states[labels["kind"]+" "+labels["target"]] = metric.GetGauge().GetValue()
+		}
+	}
+	require.Equal(t, float64(3), states["channel fallback:///"+addr], "expected a READY channel")
+	require.Equal(t, float64(3), states["subchannel "+addr], "expected a READY subchannel")
+}
@@ -0,0 +1,149 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Chaos is the fault injection configuration of a Client, it is meant for rehearsing the behavior of the relay, its
+// CDN and its clients under partial failure, and must never be used in production.
+type Chaos struct {
+	// Latency is the maximum random delay added to every call
+	Latency time.Duration
+	// ErrorRate is the probability for a call to fail with an Unavailable error
+	ErrorRate float64
+	// MalformedRate is the probability for a beacon response to have its signature corrupted
+	MalformedRate float64
+}
+
+// ParseChaos parses a comma separated chaos configuration such as latency=200ms,errors=0.1,malformed=0.05
+func ParseChaos(config string) (*Chaos, error) {
+	c := &Chaos{}
+	for _, kv := range strings.Split(config, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid chaos setting %q, expected key=value", kv)
+		}
+
+		var err error
+		switch key {
+		case "latency":
+			c.Latency, err = time.ParseDuration(value)
+		case "errors":
+			c.ErrorRate, err = parseRate(value)
+		case "malformed":
+			c.MalformedRate, err = parseRate(value)
+		default:
+			return nil, fmt.Errorf("unknown chaos setting %q, expected latency, errors or malformed", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos %s: %w", key, err)
+		}
+	}
+	return c, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate %v must be between 0 and 1", rate)
+	}
+	return rate, nil
+}
+
+// WithChaos injects the configured faults in all the calls done by the Client.
+func WithChaos(c *Chaos) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.chaos = c
+	}
+}
+
+func (c *Chaos) delay(ctx context.Context) error {
+	if c.Latency <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(rand.N(c.Latency)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Chaos) fail() error {
+	if rand.Float64() < c.ErrorRate {
+		return status.Error(codes.Unavailable, "chaos: injected failure")
+	}
+	return nil
+}
+
+func (c *Chaos) corrupt(reply any) {
+	if r, ok := reply.(*proto.PublicRandResponse); ok && len(r.Signature) > 0 && rand.Float64() < c.MalformedRate {
+		sig := make([]byte, len(r.Signature))
+		copy(sig, r.Signature)
+		sig[rand.N(len(sig))] ^= 0xff
+		r.Signature = sig
+	}
+}
+
+// UnaryInterceptor delays, fails or corrupts unary calls according to the Chaos configuration.
+func (c *Chaos) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := c.delay(ctx); err != nil {
+			return err
+		}
+		if err := c.fail(); err != nil {
+			return err
+		}
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		c.corrupt(reply)
+		return nil
+	}
+}
+
+// StreamInterceptor delays, fails or corrupts the messages of streams according to the Chaos configuration.
+func (c *Chaos) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := c.fail(); err != nil {
+			return nil, err
+		}
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &chaosStream{ClientStream: s, chaos: c}, nil
+	}
+}
+
+type chaosStream struct {
+	grpc.ClientStream
+	chaos *Chaos
+}
+
+func (s *chaosStream) RecvMsg(m any) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := s.chaos.delay(s.Context()); err != nil {
+		return err
+	}
+	if err := s.chaos.fail(); err != nil {
+		return err
+	}
+	s.chaos.corrupt(m)
+	return nil
+}
@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChaos(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected *Chaos
+		wantErr  bool
+	}{
+		{
+			name:     "all",
+			config:   "latency=200ms,errors=0.1,malformed=0.05",
+			expected: &Chaos{Latency: 200 * time.Millisecond, ErrorRate: 0.1, MalformedRate: 0.05},
+		}, {
+			name:     "latency only",
+			config:   "latency=1s",
+			expected: &Chaos{Latency: time.Second},
+		}, {
+			name:    "rate out of range",
+			config:  "errors=2",
+			wantErr: true,
+		}, {
+			name:    "unknown setting",
+			config:  "drop=0.5",
+			wantErr: true,
+		}, {
+			name:    "missing value",
+			config:  "latency",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseChaos(tt.config)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// addressCredentials are the transport credentials of the Clients: the connections to the backend addresses whose
+// "tls" attribute is set use TLS, the other ones are insecure.
+type addressCredentials struct {
+	tls      credentials.TransportCredentials
+	insecure credentials.TransportCredentials
+}
+
+func newAddressCredentials() credentials.TransportCredentials {
+	return &addressCredentials{
+		tls:      credentials.NewTLS(&tls.Config{}),
+		insecure: insecure.NewCredentials(),
+	}
+}
+
+func (c *addressCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if useTLS, _ := credentials.ClientHandshakeInfoFromContext(ctx).Attributes.Value("tls").(bool); useTLS {
+		return c.tls.ClientHandshake(ctx, authority, conn)
+	}
+	return c.insecure.ClientHandshake(ctx, authority, conn)
+}
+
+func (c *addressCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("address credentials are client-side only")
+}
+
+// Info reports the connections as insecure, since they are unless a backend asks for TLS.
+func (c *addressCredentials) Info() credentials.ProtocolInfo {
+	return c.insecure.Info()
+}
+
+func (c *addressCredentials) Clone() credentials.TransportCredentials {
+	return &addressCredentials{tls: c.tls.Clone(), insecure: c.insecure.Clone()}
+}
+
+// OverrideServerName is deprecated in grpc, we only forward it to the TLS credentials.
+func (c *addressCredentials) OverrideServerName(name string) error {
+	return c.tls.OverrideServerName(name)
+}
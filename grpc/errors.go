@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors returned by the Client methods wrap one of these when their cause is known, for the callers to check it
+// using errors.Is rather than matching on the messages of the backends. The original error is wrapped too, so its
+// grpc status is preserved.
+var (
+	// ErrUnknownChain is returned when the backends don't serve the requested chainhash or beacon ID.
+	ErrUnknownChain = errors.New("unknown chain")
+	// ErrRoundNotAvailable is returned when the backends don't have the requested round.
+	ErrRoundNotAvailable = errors.New("round not available")
+	// ErrBackendUnavailable is returned when no backend could be reached.
+	ErrBackendUnavailable = errors.New("backend unavailable")
+	// ErrTimeout is returned when the call didn't complete before its deadline.
+	ErrTimeout = errors.New("timeout")
+)
+
+// wrapError wraps the provided error returned by a backend call with the matching typed error, if any.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed error
+	switch {
+	case isUnknownChain(err):
+		typed = ErrUnknownChain
+	case errors.Is(err, context.DeadlineExceeded):
+		typed = ErrTimeout
+	default:
+		switch status.Code(err) {
+		case codes.NotFound:
+			typed = ErrRoundNotAvailable
+		case codes.Unavailable:
+			typed = ErrBackendUnavailable
+		case codes.DeadlineExceeded:
+			typed = ErrTimeout
+		}
+	}
+	if typed == nil || errors.Is(err, typed) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", typed, err)
+}
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWrapError(t *testing.T) {
+	require.NoError(t, wrapError(nil))
+	tests := []struct {
+		err   error
+		typed error
+	}{
+		{status.Error(codes.InvalidArgument, "unknown chain hash"), ErrUnknownChain},
+		{status.Error(codes.InvalidArgument, "unknown beacon ID"), ErrUnknownChain},
+		{status.Error(codes.NotFound, "round 10 not available yet"), ErrRoundNotAvailable},
+		{status.Error(codes.Unavailable, "connection refused"), ErrBackendUnavailable},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), ErrTimeout},
+		{fmt.Errorf("waiting: %w", context.DeadlineExceeded), ErrTimeout},
+	}
+	for _, tt := range tests {
+		err := wrapError(tt.err)
+		require.ErrorIs(t, err, tt.typed, tt.err)
+		require.ErrorIs(t, err, tt.err)
+		require.Equal(t, status.Code(tt.err), status.Code(err), "the grpc status must be preserved")
+	}
+
+	other := status.Error(codes.Internal, "oops")
+	require.Equal(t, other, wrapError(other))
+	typed := fmt.Errorf("%w: already typed", ErrBackendUnavailable)
+	require.Equal(t, typed, wrapError(typed))
+}
+
+func TestTypedErrorsWithMockBackend(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	c, err := NewClient("fallback:///"+serveMock(t, m), slog.Default())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.GetChainInfo(ctx, &proto.Metadata{BeaconID: "unknown"})
+	require.ErrorIs(t, err, ErrUnknownChain)
+	// the cached unknown chains are reported the same way
+	_, err = c.GetChainInfo(ctx, &proto.Metadata{BeaconID: "unknown"})
+	require.ErrorIs(t, err, ErrUnknownChain)
+
+	_, err = c.GetBeacon(ctx, m.metadata(), m.current()+100)
+	require.ErrorIs(t, err, ErrRoundNotAvailable)
+	require.False(t, errors.Is(err, ErrUnknownChain))
+}
@@ -2,12 +2,17 @@ package grpc
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math/rand/v2"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	proto "github.com/drand/drand/v2/protobuf/drand"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"google.golang.org/grpc"
@@ -27,10 +32,48 @@ var (
 		},
 		[]string{"node"},
 	)
+
+	// BackendLatency is recording the latency of the unary calls done to each backend node, as seen by the picker
+	BackendLatency = defaultMetrics.backendLatency
+
+	// BackendErrors is counting the calls that failed per backend node
+	BackendErrors = defaultMetrics.backendErrors
+
+	// Retries is counting the calls that were retried on the next SubConn, per method and per node that failed them
+	Retries = defaultMetrics.retries
+
+	// CanaryCalls is counting the calls sent to the canary backend nodes for their share of the traffic
+	CanaryCalls = defaultMetrics.canaryCalls
+
+	// Spills is counting the calls sent to another backend node because the preferred one was saturated
+	Spills = defaultMetrics.spills
+
+	// BackendSubConnReady is set to 1 when the SubConn of a resolved address of a backend node is ready and 0
+	// otherwise, the health of the backend node as a whole being BackendUp
+	BackendSubConnReady = defaultMetrics.subConnReady
 )
 
 var fbLog = grpclog.Component("fallbackLB")
 
+// LatencyAware is the default of the Clients for latency-aware picking, see WithLatencyAware: the SubConn with the
+// lowest rolling latency and error rate is preferred, the configured order of the backends only being used as a
+// tie-breaker.
+var LatencyAware = false
+
+// ChainAffinity is the default of the Clients for chain-affinity, see WithChainAffinity: each chain gets pinned to the
+// first backend that successfully served it, and is unpinned as soon as that backend fails for it. This avoids
+// bouncing requests to backends that don't follow every chain in mixed deployments.
+var ChainAffinity = false
+
+// MaxInflight is the default cap of the Clients on the number of concurrent unary calls sent to each backend, see
+// WithMaxInflight: once the preferred SubConn is saturated, the excess calls spill over to the next one that isn't
+// instead of queueing on it. The calls are only queued on the preferred SubConn when all of them are saturated. There
+// is no cap when it is 0.
+var MaxInflight = 0
+
+// ewmaAlpha is the smoothing factor of the rolling latency and error rate averages kept for each SubConn.
+const ewmaAlpha = 0.2
+
 const fallbackName = "pick_first_with_fallback"
 
 // LBConfig is the balancer config for pick_first_with_fallback balancer.
@@ -40,6 +83,11 @@ type LBConfig struct {
 	// FallbackSeconds is the number of seconds the fallbackBalancer should wait
 	// before attempting to fallback to its first endpoints. If set to 0, it behaves like the pick_first balancer.
 	FallbackSeconds uint32 `json:"fallbackSeconds,omitempty"`
+	// LatencyAware, ChainAffinity and MaxInflight configure the picking of the SubConns, as documented by the package
+	// variables of the same name.
+	LatencyAware  bool `json:"latencyAware,omitempty"`
+	ChainAffinity bool `json:"chainAffinity,omitempty"`
+	MaxInflight   int  `json:"maxInflight,omitempty"`
 }
 
 // NewFallbackBuilder returns a fallback balancer builder configured with the given timeout, meant to be registered.
@@ -59,8 +107,25 @@ func (fallbackBB) Name() string {
 	return fallbackName
 }
 
+// ParseConfig parses the LBConfig provided in the service config, the fallback timeout keeps the value the builder was
+// created with if omitted.
+func (f fallbackBB) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &LBConfig{FallbackSeconds: uint32(f.timeout.Seconds())}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s config %q: %w", fallbackName, js, err)
+	}
+	return cfg, nil
+}
+
 func (f fallbackBB) Build(cc balancer.ClientConn, bOpts balancer.BuildOptions) balancer.Balancer {
-	b := &fallbackBalancer{scAddrs: make(map[balancer.SubConn]*scWithAddr), closing: make(chan struct{})}
+	b := &fallbackBalancer{
+		scAddrs:  make(map[balancer.SubConn]*scWithAddr),
+		closing:  make(chan struct{}),
+		timeouts: make(chan time.Duration),
+		target:   bOpts.Target.String(),
+		metrics:  defaultMetrics,
+	}
+	balancers.Store(b, struct{}{})
 	// we delegate the actual SubConn management to the base balancer
 	baseBuilder := base.NewBalancerBuilder(fallbackName, b,
 		base.Config{
@@ -80,13 +145,171 @@ type fallbackBalancer struct {
 
 	scAddrs map[balancer.SubConn]*scWithAddr // Hold onto SubConn address to keep track for subsequent picker updates.
 	closing chan struct{}
+	// timeouts hands the fallback timeouts provided by the service config over to the background timer
+	timeouts chan time.Duration
+
+	// latencyAware makes us sort the SubConn by their rolling latency and error rate rather than by priority alone.
+	latencyAware bool
+	// prober is the active prober of the backends provided by the resolver, if any
+	prober *prober
+	// target is the target of the ClientConn using this balancer, for introspection purposes
+	target string
+	// affinity maps the chains to the SubConn they are pinned to, it is nil when chain-affinity is disabled
+	affinity map[string]balancer.SubConn
+	// maxInflight is the maximum number of concurrent unary calls sent to a SubConn, 0 meaning there is no cap
+	maxInflight int
+	// metrics are the collectors of the Client provided by the resolver, or the default ones
+	metrics *clientMetrics
+}
+
+// pinned returns the SubConn the provided chain is pinned to, if any and if it is still available.
+func (fb *fallbackBalancer) pinned(chain string) *scWithAddr {
+	if chain == "" {
+		return nil
+	}
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	if fb.affinity == nil {
+		return nil
+	}
+	sc, ok := fb.affinity[chain]
+	if !ok {
+		return nil
+	}
+	sca, ok := fb.scAddrs[sc]
+	if !ok || !fb.prober.healthy(sca.addr) {
+		return nil
+	}
+	return sca
+}
+
+// pin pins the chain to the provided SubConn if it succeeded, or unpins it if it was pinned to it and failed.
+func (fb *fallbackBalancer) pin(chain string, sca *scWithAddr, failed bool) {
+	if chain == "" {
+		return
+	}
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.affinity == nil {
+		return
+	}
+	current, ok := fb.affinity[chain]
+	switch {
+	case failed && ok && current == sca.sc:
+		fbLog.Warning("unpinning chain from failing SubConn", "chain", chain, "addr", sca.addr)
+		delete(fb.affinity, chain)
+	case !failed && !ok:
+		fbLog.Info("pinning chain to SubConn", "chain", chain, "addr", sca.addr)
+		fb.affinity[chain] = sca.sc
+	}
 }
 
-// Function to continuously process updates
+// balancers holds all the live fallback balancers, to be able to report their state.
+var balancers sync.Map
+
+// BalancerState is the current view a fallback balancer has of its SubConns, in their picking order.
+type BalancerState struct {
+	Target       string         `json:"target"`
+	LatencyAware bool           `json:"latency_aware"`
+	SubConns     []SubConnState `json:"subconns"`
+}
+
+// SubConnState is the current view a fallback balancer has of one of its SubConns.
+type SubConnState struct {
+	Addr         string  `json:"addr"`
+	Priority     int     `json:"priority"`
+	Order        int     `json:"order"`
+	Region       string  `json:"region,omitempty"`
+	LatencyMs    float64 `json:"latency_ms"`
+	ErrorRate    float64 `json:"error_rate"`
+	ProbeHealthy bool    `json:"probe_healthy"`
+	LastError    string  `json:"last_error,omitempty"`
+	LastErrorAt  string  `json:"last_error_at,omitempty"`
+}
+
+// BalancerStates returns the state of all the live fallback balancers.
+func BalancerStates() []BalancerState {
+	var ret []BalancerState
+	balancers.Range(func(key, _ any) bool {
+		ret = append(ret, key.(*fallbackBalancer).state())
+		return true
+	})
+	return ret
+}
+
+func (fb *fallbackBalancer) state() BalancerState {
+	fb.mu.RLock()
+	scs := make([]*scWithAddr, 0, len(fb.scAddrs))
+	for _, sca := range fb.scAddrs {
+		scs = insertFunc(scs, sca, fb.cmp())
+	}
+	p, latencyAware := fb.prober, fb.latencyAware
+	fb.mu.RUnlock()
+
+	state := BalancerState{
+		Target:       fb.target,
+		LatencyAware: latencyAware,
+		SubConns:     make([]SubConnState, 0, len(scs)),
+	}
+	for _, sca := range scs {
+		sca.mu.RLock()
+		scState := SubConnState{
+			Addr:         sca.addr,
+			Priority:     sca.priority,
+			Order:        sca.order,
+			Region:       sca.region,
+			LatencyMs:    float64(sca.latency) / float64(time.Millisecond),
+			ErrorRate:    sca.errRate,
+			ProbeHealthy: p.healthy(sca.addr),
+			LastError:    sca.lastErr,
+		}
+		if !sca.lastErrAt.IsZero() {
+			scState.LastErrorAt = sca.lastErrAt.Format(time.RFC3339)
+		}
+		sca.mu.RUnlock()
+		state.SubConns = append(state.SubConns, scState)
+	}
+	return state
+}
+
+// cmp returns the comparison function to use to sort our SubConns. The backends that failed their last active probe
+// always come after the healthy ones.
+func (fb *fallbackBalancer) cmp() func(s, t *scWithAddr) int {
+	cmp := scCmp
+	if fb.latencyAware {
+		cmp = scCmpLatency
+	}
+	return func(s, t *scWithAddr) int {
+		if s != nil && t != nil {
+			if hs, ht := fb.prober.healthy(s.addr), fb.prober.healthy(t.addr); hs != ht {
+				if hs {
+					return -1
+				}
+				return 1
+			}
+		}
+		return cmp(s, t)
+	}
+}
+
+// Function to continuously process updates, the priorities are never reset when the timeout is 0
 func (fb *fallbackBalancer) runBackgroundTimer(timeout time.Duration) {
 	ticker := time.NewTimer(timeout)
+	if timeout <= 0 {
+		ticker.Stop()
+	}
 	for {
 		select {
+		case t := <-fb.timeouts:
+			if t == timeout {
+				continue
+			}
+			fbLog.Info("updating fallback timeout", "timeout", t)
+			timeout = t
+			ticker.Stop()
+			if timeout > 0 {
+				ticker.Reset(timeout)
+			}
 		case <-ticker.C:
 			fb.mu.Lock()
 			// every tick, we reset the priority of all subconn, the ones whose underlying SubConn is actually not READY
@@ -98,6 +321,7 @@ func (fb *fallbackBalancer) runBackgroundTimer(timeout time.Duration) {
 			ticker.Reset(timeout)
 		case <-fb.closing:
 			fbLog.Info("received a Close, shutting down fallback balancer")
+			balancers.Delete(fb)
 			fb.mu.Lock()
 			ticker.Stop()
 			// we empty the balancer
@@ -144,12 +368,65 @@ func (fb *fallbackBalancer) first() *scWithAddr {
 	ret := make([]*scWithAddr, 1, len(fb.scAddrs)+1)
 	for _, sca := range fb.scAddrs {
 		// we insert in correct order, by priority
-		ret = insert(ret, sca)
+		ret = insertFunc(ret, sca, fb.cmp())
 	}
 
 	return ret[0]
 }
 
+// canary returns one of the canary SubConns if the call is part of its share of the traffic, or nil otherwise.
+func (fb *fallbackBalancer) canary() *scWithAddr {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	draw := rand.Float64() * 100
+	var share float64
+	for _, sca := range fb.scAddrs {
+		if sca.canary <= 0 {
+			continue
+		}
+		if share += sca.canary; draw < share {
+			return sca
+		}
+	}
+	return nil
+}
+
+// firstExcept returns the preferred SubConn of the backend nodes other than the provided one, or nil if there is none.
+func (fb *fallbackBalancer) firstExcept(addr string) *scWithAddr {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	ret := make([]*scWithAddr, 0, len(fb.scAddrs))
+	for _, sca := range fb.scAddrs {
+		if sca.addr != addr {
+			ret = insertFunc(ret, sca, fb.cmp())
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret[0]
+}
+
+// unsaturated returns the provided SubConn if it is below the in-flight cap, or else the preferred one among the
+// others still below it. The provided SubConn is returned when all of them are saturated.
+func (fb *fallbackBalancer) unsaturated(sca *scWithAddr) *scWithAddr {
+	fb.mu.RLock()
+	defer fb.mu.RUnlock()
+	if fb.maxInflight <= 0 || sca.inflight.Load() < int64(fb.maxInflight) {
+		return sca
+	}
+	ret := make([]*scWithAddr, 0, len(fb.scAddrs))
+	for _, other := range fb.scAddrs {
+		if other != sca && other.inflight.Load() < int64(fb.maxInflight) {
+			ret = insertFunc(ret, other, fb.cmp())
+		}
+	}
+	if len(ret) == 0 {
+		return sca
+	}
+	return ret[0]
+}
+
 func (fb *fallbackBalancer) second() *scWithAddr {
 	fb.mu.RLock()
 	defer fb.mu.RUnlock()
@@ -160,7 +437,7 @@ func (fb *fallbackBalancer) second() *scWithAddr {
 	ret := make([]*scWithAddr, 0, len(fb.scAddrs))
 	for _, sca := range fb.scAddrs {
 		// we insert in correct order, by priority
-		ret = insert(ret, sca)
+		ret = insertFunc(ret, sca, fb.cmp())
 	}
 
 	return ret[1]
@@ -188,6 +465,31 @@ func (fb *fallbackBalancer) UpdateClientConnState(s balancer.ClientConnState) er
 		return balancer.ErrBadResolverState
 	}
 
+	fb.mu.Lock()
+	fb.prober, _ = s.ResolverState.Attributes.Value(proberKey{}).(*prober)
+	if m, ok := s.ResolverState.Attributes.Value(metricsKey{}).(*clientMetrics); ok {
+		fb.metrics = m
+	}
+	fb.mu.Unlock()
+
+	// the picking settings and the fallback timeout are provided by the service config, the latter being applied by
+	// the background timer
+	if cfg, ok := s.BalancerConfig.(*LBConfig); ok {
+		fb.mu.Lock()
+		fb.latencyAware, fb.maxInflight = cfg.LatencyAware, cfg.MaxInflight
+		switch {
+		case cfg.ChainAffinity && fb.affinity == nil:
+			fb.affinity = make(map[string]balancer.SubConn)
+		case !cfg.ChainAffinity:
+			fb.affinity = nil
+		}
+		fb.mu.Unlock()
+		select {
+		case fb.timeouts <- time.Duration(cfg.FallbackSeconds) * time.Second:
+		case <-fb.closing:
+		}
+	}
+
 	return fb.Balancer.UpdateClientConnState(s)
 }
 
@@ -195,10 +497,28 @@ type scWithAddr struct {
 	sc balancer.SubConn
 	// the underlying target's address
 	addr string
+	// ip is the resolved address of the SubConn, one of the addresses of the target
+	ip string
 	// whether this SubConn is currently considered ready or not. Negative priority disables it.
 	priority int
 	// order is used to prioritize the SubConn to use, a negative one leads to it not being used at all
 	order int
+	// region is the region of the backend, as provided by the resolver
+	region string
+	// canary is the percentage of the calls sent to this SubConn whatever its priority
+	canary float64
+	// inflight is the number of unary calls currently in-flight on this SubConn
+	inflight atomic.Int64
+
+	// latency is the rolling average latency of the unary calls done on this SubConn
+	latency time.Duration
+	// errRate is the rolling average of failed calls on this SubConn, between 0 and 1
+	errRate float64
+	// sampled is set once we have observed at least one call on this SubConn
+	sampled bool
+	// lastErr and lastErrAt are recording the last error seen on this SubConn
+	lastErr   string
+	lastErrAt time.Time
 
 	// we can have concurrent updates of the priority, so we need to guard our scWithAddr with a mutex
 	mu sync.RWMutex
@@ -222,6 +542,38 @@ func (s *scWithAddr) UpdatePriority(update int) {
 	s.priority += update
 }
 
+// observe updates the rolling latency and error rate of the SubConn with the outcome of a call.
+func (s *scWithAddr) observe(latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var e float64
+	if failed {
+		e = 1
+	}
+	if !s.sampled {
+		s.latency, s.errRate, s.sampled = latency, e, true
+		return
+	}
+	s.latency = time.Duration(ewmaAlpha*float64(latency) + (1-ewmaAlpha)*float64(s.latency))
+	s.errRate = ewmaAlpha*e + (1-ewmaAlpha)*s.errRate
+}
+
+// failed records the last error seen on the SubConn.
+func (s *scWithAddr) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err.Error()
+	s.lastErrAt = time.Now()
+}
+
+// score is the rolling latency penalized by the rolling error rate, along with whether the SubConn was sampled at all,
+// the score of a SubConn without any call observed being meaningless.
+func (s *scWithAddr) score() (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Duration(float64(s.latency) * (1 + 10*s.errRate)), s.sampled
+}
+
 // scCmp should return 0 if the slice element s matches
 // the target t, a negative number if the slice element s precedes the target t,
 // or a positive number if the slice element s follows the target t.
@@ -239,12 +591,42 @@ func scCmp(s, t *scWithAddr) int {
 	return s.priority - t.priority
 }
 
+// scCmpLatency is a comparison function like scCmp, but sorting the SubConns by their latency score first and only
+// using their priority as a tie-breaker. The SubConns that weren't sampled yet come after the sampled ones, so that a
+// new backend doesn't take over the measured ones before proving itself, e.g. when they fail.
+func scCmpLatency(s, t *scWithAddr) int {
+	if s == nil {
+		return 1
+	} else if t == nil {
+		return -1
+	}
+	ss, sSampled := s.score()
+	ts, tSampled := t.score()
+	switch {
+	case sSampled != tSampled:
+		if sSampled {
+			return -1
+		}
+		return 1
+	case ss < ts:
+		return -1
+	case ss > ts:
+		return 1
+	}
+	return scCmp(s, t)
+}
+
 // insert will insert s in scs in a sorted way, relying on the above comparison function. It will be in ascending order.
 func insert(scs []*scWithAddr, s *scWithAddr) []*scWithAddr {
+	return insertFunc(scs, s, scCmp)
+}
+
+// insertFunc is like insert, but using the provided comparison function.
+func insertFunc(scs []*scWithAddr, s *scWithAddr, cmp func(s, t *scWithAddr) int) []*scWithAddr {
 	if s == nil {
 		return scs
 	}
-	i, _ := slices.BinarySearchFunc(scs, s, scCmp) // find slot
+	i, _ := slices.BinarySearchFunc(scs, s, cmp) // find slot
 	return slices.Insert(scs, i, s)
 }
 
@@ -265,6 +647,7 @@ func (fb *fallbackBalancer) Build(info base.PickerBuildInfo) balancer.Picker {
 			// but most likely means a connection is failing temporarily.
 			// We rely on the grpc built-in reconnect backoff process to re-trigger this through the baseBalancer.
 			fbLog.Warning("SubConn not ready anymore", "addr", sca.addr)
+			fb.metrics.subConnReady.WithLabelValues(sca.addr, sca.ip).Set(0)
 			delete(fb.scAddrs, sc)
 		}
 	}
@@ -278,27 +661,49 @@ func (fb *fallbackBalancer) Build(info base.PickerBuildInfo) balancer.Picker {
 			continue
 		}
 
+		// we track SubConns by backend name rather than by resolved IP address, if available
+		name, ok := addr.Address.Attributes.Value("backend").(string)
+		if !ok {
+			name = addr.Address.Addr
+		}
+
+		region, _ := addr.Address.Attributes.Value("region").(string)
+		canary, _ := addr.Address.Attributes.Value("canary").(float64)
+
 		sca := &scWithAddr{
 			sc:       sc,
-			addr:     addr.Address.Addr,
+			addr:     name,
+			ip:       addr.Address.Addr,
 			priority: order,
 			order:    order,
+			region:   region,
+			canary:   canary,
+		}
+		// we keep the rolling statistics of a SubConn we already knew about
+		if old, ok := fb.scAddrs[sc]; ok {
+			old.mu.RLock()
+			sca.latency, sca.errRate, sca.sampled = old.latency, old.errRate, old.sampled
+			sca.lastErr, sca.lastErrAt = old.lastErr, old.lastErrAt
+			old.mu.RUnlock()
 		}
 
 		fbLog.Info("Processing Ready SubConn", "addr", addr.Address, "order", order)
 		// we replace the sca in our LB in case its addr or order was changed
 		fb.scAddrs[sc] = sca
+		fb.metrics.subConnReady.WithLabelValues(name, addr.Address.Addr).Set(1)
 	}
 
 	fbLog.Info("Prepared fallback LB picker with ready SubConns", "scs", scs)
 
 	return &picker{
-		fb: fb,
+		fb:      fb,
+		metrics: fb.metrics,
 	}
 }
 
 type picker struct {
-	fb *fallbackBalancer
+	fb      *fallbackBalancer
+	metrics *clientMetrics
 }
 
 func (p *picker) String() string {
@@ -317,12 +722,82 @@ func (p *picker) String() string {
 
 type SkipCtxKey struct{}
 
+// chainCtxKey is used to provide the chain targeted by a call to the picker, for chain-affinity.
+type chainCtxKey struct{}
+
+// withChain adds the chain designated in the Metadata to the context, as a hex-encoded chainhash or a beacon ID.
+func withChain(ctx context.Context, m *proto.Metadata) context.Context {
+	return context.WithValue(ctx, chainCtxKey{}, chainKey(m))
+}
+
+// chainKey returns the chainhash in hex of the provided metadata, or its beacon ID if it has no chainhash.
+func chainKey(m *proto.Metadata) string {
+	if chain := hex.EncodeToString(m.GetChainHash()); chain != "" {
+		return chain
+	}
+	return m.GetBeaconID()
+}
+
+// pickedCtxKey is used to let the picker report the backend node it picked for a call back to its caller.
+type pickedCtxKey struct{}
+
+// pickedNode holds the address of the last backend node picked for the calls done with its context, the picks after
+// the first one being counted as retries.
+type pickedNode struct {
+	addr atomic.Value
+}
+
+// String returns the address of the picked node, or "unknown" if none was picked.
+func (n *pickedNode) String() string {
+	if addr, ok := n.addr.Load().(string); ok {
+		return addr
+	}
+	return "unknown"
+}
+
+// load returns the address of the picked node, if any was picked, it is safe to call on a nil pickedNode.
+func (n *pickedNode) load() (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	addr, ok := n.addr.Load().(string)
+	return addr, ok
+}
+
+// withPickedNode returns a context in which the picker records the node it picked in the returned pickedNode.
+func withPickedNode(ctx context.Context) (context.Context, *pickedNode) {
+	n := &pickedNode{}
+	return context.WithValue(ctx, pickedCtxKey{}, n), n
+}
+
 func (p *picker) Pick(b balancer.PickInfo) (balancer.PickResult, error) {
 	// we rely on the 0 value of int being 0 when the key isn't set
 	skip, _ := b.Ctx.Value(SkipCtxKey{}).(bool)
+	chain, _ := b.Ctx.Value(chainCtxKey{}).(string)
 
 	picked := p.fb.first()
-	fbLog.Info("considering to pick", "first", picked, "skip", skip)
+	if pinned := p.fb.pinned(chain); pinned != nil && !skip {
+		picked = pinned
+	}
+	// the canaries get their share of the calls, except the retries which must go to another backend
+	var canary bool
+	if c := p.fb.canary(); c != nil && !skip {
+		picked, canary = c, true
+	}
+	// the hedged calls go to the preferred backend other than the one the call is hedging
+	if hedging, ok := b.Ctx.Value(hedgeCtxKey{}).(string); ok {
+		if other := p.fb.firstExcept(hedging); other != nil {
+			picked, canary = other, false
+		}
+	}
+	// the retry attempts of a call go to the preferred backend other than the one that just failed it
+	n, _ := b.Ctx.Value(pickedCtxKey{}).(*pickedNode)
+	if prev, ok := n.load(); ok {
+		if other := p.fb.firstExcept(prev); other != nil {
+			picked, canary = other, false
+		}
+	}
+	fbLog.Info("considering to pick", "first", picked, "skip", skip, "chain", chain)
 	// we got a skip context, so we'll try to see if there is a next subconn
 	if skip {
 		second := p.fb.second()
@@ -338,15 +813,51 @@ func (p *picker) Pick(b balancer.PickInfo) (balancer.PickResult, error) {
 		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
 	}
 
+	// streams are long-lived, they would hold their in-flight slot for good
+	unary := !strings.HasSuffix(b.FullMethodName, "Stream")
+	if unary {
+		if other := p.fb.unsaturated(picked); other != picked {
+			p.metrics.spills.With(prometheus.Labels{"method": b.FullMethodName, "node": picked.addr}).Inc()
+			picked, canary = other, false
+		}
+		picked.inflight.Add(1)
+	}
+
 	// The metric for a subchannel should be atomically incremented by one
 	// after it has been successfully picked by the picker
 	RequestsCounter.With(prometheus.Labels{"node": picked.addr}).Inc()
+	if n != nil {
+		// a node was already picked for this call, so it is being retried
+		if prev, ok := n.addr.Swap(picked.addr).(string); ok {
+			p.metrics.retries.With(prometheus.Labels{"method": b.FullMethodName, "node": prev}).Inc()
+		}
+	}
 	fbLog.Info("Picked SubConn", "addr", picked.addr, "skipped", skip)
+	start := time.Now()
 	return balancer.PickResult{
 		SubConn: picked.sc,
 		Done: func(info balancer.DoneInfo) {
+			if canary {
+				result := "success"
+				if info.Err != nil {
+					result = "error"
+				}
+				p.metrics.canaryCalls.With(prometheus.Labels{"method": b.FullMethodName, "node": picked.addr, "result": result}).Inc()
+			} else {
+				// a canary only serves its share, it mustn't take the whole traffic of a chain over
+				p.fb.pin(chain, picked, info.Err != nil)
+			}
 			if info.Err != nil {
 				p.fb.dec(picked.sc)
+				picked.failed(info.Err)
+				p.metrics.backendErrors.With(prometheus.Labels{"node": picked.addr, "method": b.FullMethodName}).Inc()
+			}
+			// streams are long-lived, their duration tells us nothing about the backend latency
+			if unary {
+				picked.inflight.Add(-1)
+				latency := time.Since(start)
+				picked.observe(latency, info.Err != nil)
+				observeWithExemplar(b.Ctx, p.metrics.backendLatency.With(prometheus.Labels{"node": picked.addr, "method": b.FullMethodName}), latency.Seconds())
 			}
 		},
 		Metadata: metadata.MD{"target": []string{picked.addr}},
@@ -354,12 +865,36 @@ func (p *picker) Pick(b balancer.PickInfo) (balancer.PickResult, error) {
 }
 
 // UsedEndpointInterceptor is a gRPC client-side interceptor that provides reporting for which endpoint is being used by each RPC.
+// The endpoint of the successful RPCs is also recorded in the contexts returned by WithUsedEndpoint.
 func UsedEndpointInterceptor(l logger) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		usedEndpoint := grpc.PeerCallOption{PeerAddr: &peer.Peer{}}
 		opts = append(opts, usedEndpoint)
 		err := invoker(ctx, method, req, reply, cc, opts...)
 		l.Debug("Fallback UsedEndpointInterceptor", "method", method, "remote", usedEndpoint.PeerAddr.String())
+		if used, ok := ctx.Value(usedEndpointKey{}).(*atomic.Pointer[string]); ok && err == nil && usedEndpoint.PeerAddr.Addr != nil {
+			addr := usedEndpoint.PeerAddr.Addr.String()
+			used.Store(&addr)
+		}
 		return err
 	}
 }
+
+type usedEndpointKey struct{}
+
+// WithUsedEndpoint returns a context in which the address of the backend serving the last successful unary RPC is
+// recorded, to be retrieved using UsedEndpoint.
+func WithUsedEndpoint(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usedEndpointKey{}, new(atomic.Pointer[string]))
+}
+
+// UsedEndpoint returns the address of the backend that served the last successful unary RPC made using a context
+// returned by WithUsedEndpoint, or an empty string if there is none, e.g. when the answer was cached.
+func UsedEndpoint(ctx context.Context) string {
+	if used, ok := ctx.Value(usedEndpointKey{}).(*atomic.Pointer[string]); ok {
+		if addr := used.Load(); addr != nil {
+			return *addr
+		}
+	}
+	return ""
+}
@@ -1,10 +1,20 @@
 package grpc
 
 import (
+	"context"
+	"encoding/json"
+	"log/slog"
 	"math/rand"
 	"testing"
+	"time"
 
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
 )
 
 func TestInsertSca(t *testing.T) {
@@ -63,3 +73,210 @@ func TestInsertNilsAreLast(t *testing.T) {
 	}
 	assert.Len(t, scs, 20)
 }
+
+func TestInsertLatencyAware(t *testing.T) {
+	fast := &scWithAddr{addr: "fast", priority: 2, order: 2}
+	slow := &scWithAddr{addr: "slow", priority: 0, order: 0}
+	failing := &scWithAddr{addr: "failing", priority: 1, order: 1}
+	for i := 0; i < 10; i++ {
+		fast.observe(5*time.Millisecond, false)
+		slow.observe(50*time.Millisecond, false)
+		failing.observe(5*time.Millisecond, true)
+	}
+
+	scs := make([]*scWithAddr, 0, 3)
+	for _, sca := range []*scWithAddr{slow, failing, fast} {
+		scs = insertFunc(scs, sca, scCmpLatency)
+	}
+	assert.Equal(t, []*scWithAddr{fast, slow, failing}, scs)
+
+	// equal latencies are sorted by priority
+	tie := &scWithAddr{addr: "tie", priority: 0, order: 0}
+	for i := 0; i < 10; i++ {
+		tie.observe(5*time.Millisecond, false)
+	}
+	scs = insertFunc(scs[:1], tie, scCmpLatency)
+	assert.Equal(t, "tie", scs[0].addr)
+
+	// sub-millisecond latencies are still told apart
+	faster := &scWithAddr{addr: "faster", priority: 2, order: 2}
+	slower := &scWithAddr{addr: "slower", priority: 0, order: 0}
+	faster.observe(300*time.Microsecond, false)
+	slower.observe(700*time.Microsecond, false)
+	assert.Negative(t, scCmpLatency(faster, slower))
+
+	// a SubConn without samples doesn't take over the measured ones
+	unsampled := &scWithAddr{addr: "unsampled", priority: 0, order: 0}
+	scs = make([]*scWithAddr, 0, 3)
+	for _, sca := range []*scWithAddr{unsampled, slow, fast} {
+		scs = insertFunc(scs, sca, scCmpLatency)
+	}
+	assert.Equal(t, []*scWithAddr{fast, slow, unsampled}, scs)
+}
+
+func TestInsertProbedHealth(t *testing.T) {
+	p := &prober{}
+	p.health.Store("stuck", false)
+	fb := &fallbackBalancer{prober: p}
+
+	stuck := &scWithAddr{addr: "stuck", priority: 0, order: 0}
+	healthy := &scWithAddr{addr: "healthy", priority: 2, order: 2}
+	scs := make([]*scWithAddr, 0, 2)
+	for _, sca := range []*scWithAddr{stuck, healthy} {
+		scs = insertFunc(scs, sca, fb.cmp())
+	}
+	assert.Equal(t, []*scWithAddr{healthy, stuck}, scs)
+
+	// the balancers of the clients without prober only rely on the priorities
+	fb = &fallbackBalancer{}
+	scs = scs[:0]
+	for _, sca := range []*scWithAddr{healthy, stuck} {
+		scs = insertFunc(scs, sca, fb.cmp())
+	}
+	assert.Equal(t, []*scWithAddr{stuck, healthy}, scs)
+}
+
+// fakeSubConn only serves to tell SubConns apart, none of its methods are called by the affinity logic.
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func TestChainAffinity(t *testing.T) {
+	a := &scWithAddr{sc: &fakeSubConn{name: "a"}, addr: "a"}
+	b := &scWithAddr{sc: &fakeSubConn{name: "b"}, addr: "b"}
+	p := &prober{}
+	fb := &fallbackBalancer{
+		scAddrs:  map[balancer.SubConn]*scWithAddr{a.sc: a, b.sc: b},
+		affinity: make(map[string]balancer.SubConn),
+		prober:   p,
+	}
+
+	assert.Nil(t, fb.pinned("quicknet"))
+	fb.pin("quicknet", b, false)
+	assert.Same(t, b, fb.pinned("quicknet"))
+	// the first successful SubConn keeps the chain, and only its failures unpin it
+	fb.pin("quicknet", a, false)
+	fb.pin("quicknet", a, true)
+	assert.Same(t, b, fb.pinned("quicknet"))
+	// a chain isn't served by a backend the prober found unhealthy
+	p.health.Store("b", false)
+	assert.Nil(t, fb.pinned("quicknet"))
+	p.health.Store("b", true)
+	fb.pin("quicknet", b, true)
+	assert.Nil(t, fb.pinned("quicknet"))
+
+	assert.Nil(t, fb.pinned(""), "calls without chain are never pinned")
+	fb = &fallbackBalancer{scAddrs: fb.scAddrs}
+	fb.pin("quicknet", a, false)
+	assert.Nil(t, fb.pinned("quicknet"), "chain-affinity is disabled without affinity map")
+}
+
+func TestWithChain(t *testing.T) {
+	ctx := withChain(context.Background(), &proto.Metadata{ChainHash: []byte{0xab, 0xcd}, BeaconID: "quicknet"})
+	assert.Equal(t, "abcd", ctx.Value(chainCtxKey{}))
+	ctx = withChain(context.Background(), &proto.Metadata{BeaconID: "quicknet"})
+	assert.Equal(t, "quicknet", ctx.Value(chainCtxKey{}))
+}
+
+func TestPickedNode(t *testing.T) {
+	ctx, node := withPickedNode(context.Background())
+	assert.Equal(t, "unknown", node.String())
+
+	a := &scWithAddr{sc: &fakeSubConn{name: "a"}, addr: "a"}
+	p := &picker{fb: &fallbackBalancer{scAddrs: map[balancer.SubConn]*scWithAddr{a.sc: a}}, metrics: defaultMetrics}
+	_, err := p.Pick(balancer.PickInfo{FullMethodName: proto.Public_PublicRand_FullMethodName, Ctx: ctx})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.String())
+}
+
+func TestParseConfig(t *testing.T) {
+	p := NewFallbackBuilder(3 * time.Second).(balancer.ConfigParser)
+	cfg, err := p.ParseConfig(json.RawMessage(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &LBConfig{FallbackSeconds: 3}, cfg)
+
+	cfg, err = p.ParseConfig(json.RawMessage(`{"fallbackSeconds": 10}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &LBConfig{FallbackSeconds: 10}, cfg)
+
+	_, err = p.ParseConfig(json.RawMessage(`{"fallbackSeconds": "soon"}`))
+	assert.Error(t, err)
+
+	// the logging balancer hands the config over to the registered fallback balancer
+	cfg, err = NewLoggingBalancerBuilder(fallbackName, slog.Default()).(balancer.ConfigParser).ParseConfig(json.RawMessage(`{"fallbackSeconds": 0}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &LBConfig{FallbackSeconds: 0}, cfg)
+}
+
+func TestCanary(t *testing.T) {
+	primary := &scWithAddr{sc: &fakeSubConn{name: "primary"}, addr: "primary", priority: 0, order: 0}
+	canary := &scWithAddr{sc: &fakeSubConn{name: "canary"}, addr: "canary", priority: 1, order: 1, canary: 100}
+	fb := &fallbackBalancer{scAddrs: map[balancer.SubConn]*scWithAddr{primary.sc: primary, canary.sc: canary}}
+	p := &picker{fb: fb, metrics: defaultMetrics}
+
+	assert.Same(t, canary, fb.canary())
+	res, err := p.Pick(balancer.PickInfo{FullMethodName: proto.Public_PublicRand_FullMethodName, Ctx: context.Background()})
+	assert.NoError(t, err)
+	assert.Same(t, canary.sc, res.SubConn)
+
+	canary.canary = 0
+	assert.Nil(t, fb.canary())
+	res, err = p.Pick(balancer.PickInfo{FullMethodName: proto.Public_PublicRand_FullMethodName, Ctx: context.Background()})
+	assert.NoError(t, err)
+	assert.Same(t, primary.sc, res.SubConn)
+}
+
+func TestMaxInflight(t *testing.T) {
+	primary := &scWithAddr{sc: &fakeSubConn{name: "primary"}, addr: "primary", priority: 0, order: 0}
+	secondary := &scWithAddr{sc: &fakeSubConn{name: "secondary"}, addr: "secondary", priority: 1, order: 1}
+	fb := &fallbackBalancer{scAddrs: map[balancer.SubConn]*scWithAddr{primary.sc: primary, secondary.sc: secondary}, maxInflight: 1}
+	p := &picker{fb: fb, metrics: defaultMetrics}
+	info := balancer.PickInfo{FullMethodName: proto.Public_PublicRand_FullMethodName, Ctx: context.Background()}
+
+	first, err := p.Pick(info)
+	assert.NoError(t, err)
+	assert.Same(t, primary.sc, first.SubConn)
+	// the primary is saturated, so the next call spills over to the secondary
+	second, err := p.Pick(info)
+	assert.NoError(t, err)
+	assert.Same(t, secondary.sc, second.SubConn)
+	// both are saturated, so the call queues on the primary
+	third, err := p.Pick(info)
+	assert.NoError(t, err)
+	assert.Same(t, primary.sc, third.SubConn)
+	assert.EqualValues(t, 2, primary.inflight.Load())
+
+	first.Done(balancer.DoneInfo{})
+	third.Done(balancer.DoneInfo{})
+	second.Done(balancer.DoneInfo{})
+	assert.Zero(t, primary.inflight.Load())
+	assert.Zero(t, secondary.inflight.Load())
+
+	// the streams don't count against the cap
+	stream := balancer.PickInfo{FullMethodName: proto.Public_PublicRandStream_FullMethodName, Ctx: context.Background()}
+	for i := 0; i < 2; i++ {
+		res, err := p.Pick(stream)
+		assert.NoError(t, err)
+		assert.Same(t, primary.sc, res.SubConn)
+	}
+}
+
+func TestBuildSubConnReady(t *testing.T) {
+	m := newClientMetrics()
+	fb := &fallbackBalancer{scAddrs: make(map[balancer.SubConn]*scWithAddr), metrics: m}
+	addr := func(ip string, order int) base.SubConnInfo {
+		attrs := attributes.New("order", order).WithValue("backend", "drand.example.com:443")
+		return base.SubConnInfo{Address: resolver.Address{Addr: ip, Attributes: attrs}}
+	}
+	first, second := &fakeSubConn{name: "first"}, &fakeSubConn{name: "second"}
+	fb.Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		first:  addr("192.0.2.1:443", 0),
+		second: addr("192.0.2.2:443", 1),
+	}})
+	// one of the IPs of the backend going away doesn't mark the backend down, only its SubConn
+	fb.Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{second: addr("192.0.2.2:443", 1)}})
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.subConnReady.WithLabelValues("drand.example.com:443", "192.0.2.1:443")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.subConnReady.WithLabelValues("drand.example.com:443", "192.0.2.2:443")))
+	assert.Zero(t, testutil.CollectAndCount(m.backendUp), "the backend health is left to the prober")
+}
@@ -1,31 +1,110 @@
 package grpc
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/attributes"
 	"google.golang.org/grpc/resolver"
 )
 
 func init() {
-	resolver.Register(&FallbackResolver{})
+	resolver.Register(&FallbackResolver{resolveInterval: ResolveInterval})
+	resolver.Register(&SRVResolverBuilder{resolveInterval: ResolveInterval})
 }
 
+// ResolveInterval is the default interval at which the Clients re-resolve the host names of their backends, see
+// WithResolveInterval, pushing the updated addresses to the balancer when they changed. Disabled when set to 0.
+var ResolveInterval = 5 * time.Minute
+
 // FallbackResolver implements both resolver.Resolver and resolver.Builder since there is no special handling required
 // when building one. Most notably, it currently doesn't support any resolver.BuildOptions.
 type FallbackResolver struct {
 	target resolver.Target
 	cc     resolver.ClientConn
+	// backends returns the backends to resolve, in their order of preference, along with the duration for which they
+	// are valid, if known
+	backends func() ([]Backend, time.Duration, error)
+	// probing holds the settings of the active probing of the backends of the resolvers built by this one
+	probing probing
+	// resolveInterval is the interval at which the resolvers built by this one re-resolve their backends
+	resolveInterval time.Duration
+	// prober checks the resolved backends and is handed over to the fallback balancer along with the addresses, if
+	// probing is enabled
+	prober *prober
+
+	// resolveNow is used to trigger a re-resolution from ResolveNow
+	resolveNow chan struct{}
+	closing    chan struct{}
+	// last holds the resolved addresses last pushed to the ClientConn
+	last []string
+	// ttl is the duration for which the last resolved backends are valid, 0 if unknown
+	ttl time.Duration
+}
+
+// proberKey is the resolver.State attribute holding the active prober of the backends.
+type proberKey struct{}
+
+// metricsKey is the resolver.State attribute holding the collectors the fallback balancer records its metrics into.
+type metricsKey struct{}
+
+// probing holds the settings of the active probing of the backends. The resolvers registered globally don't probe
+// their backends, NewClient provides its own resolvers to the connections of its clients.
+type probing struct {
+	interval time.Duration
+	log      logger
+	dialOpts []grpc.DialOption
+	// metrics are the collectors of the Client, used by the prober and handed over to the fallback balancer, the
+	// default ones being used when nil
+	metrics *clientMetrics
+}
+
+func (b *FallbackResolver) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	return newFallbackResolver(target, cc, b.probing, b.resolveInterval, func() ([]Backend, time.Duration, error) {
+		backends, err := ParseBackends(target.Endpoint())
+		return backends, 0, err
+	})
 }
 
-func (*FallbackResolver) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+// newFallbackResolver resolves the provided backends and starts watching them at the provided interval, along with
+// probing them if enabled.
+func newFallbackResolver(target resolver.Target, cc resolver.ClientConn, p probing, interval time.Duration, backends func() ([]Backend, time.Duration, error)) (*FallbackResolver, error) {
 	r := &FallbackResolver{
-		target: target,
-		cc:     cc,
+		target:     target,
+		cc:         cc,
+		backends:   backends,
+		probing:    p,
+		resolveNow: make(chan struct{}, 1),
+		closing:    make(chan struct{}),
+	}
+	if p.interval > 0 {
+		r.prober = newProber(p.interval, time.Second, p.log, p.metrics, p.dialOpts...)
+	}
+
+	if err := r.start(); err != nil {
+		if r.prober != nil {
+			r.prober.Close()
+		}
+		return r, err
 	}
 
-	return r, r.start()
+	if r.prober != nil {
+		go r.prober.run()
+	}
+	go r.watch(interval)
+	return r, nil
 }
 
 const FallbackResolverName = "fallback"
@@ -35,18 +114,432 @@ func (*FallbackResolver) Scheme() string {
 }
 
 func (r *FallbackResolver) start() error {
-	addrStrs := strings.Split(r.target.Endpoint(), ",")
-	addrs := make([]resolver.Address, len(addrStrs))
-	for i, a := range addrStrs {
-		slog.Info("Adding backend address to pool", "host", a, "order", i)
-		addrs[i] = resolver.Address{Addr: a, ServerName: a, Attributes: attributes.New("order", i)}
+	backends, ttl, err := r.backends()
+	if err != nil {
+		return err
 	}
+	r.ttl = ttl
+
+	if r.prober != nil {
+		if err := r.prober.update(backends); err != nil {
+			return err
+		}
+	}
+
+	var addrs []resolver.Address
+	for _, b := range backends {
+		slog.Debug("Resolving backend address for pool", "host", b.Addr, "priority", b.Priority)
+		for _, a := range resolve(b.Addr) {
+			// every address gets its own order, so that the IPs of a backend don't tie in the balancer
+			attrs := attributes.New("order", len(addrs)).WithValue("backend", b.Addr).
+				WithValue("tls", b.TLS).WithValue("region", b.Region).WithValue("canary", b.Canary)
+			addrs = append(addrs, resolver.Address{Addr: a, ServerName: b.Addr, Attributes: attrs})
+		}
+	}
+
+	resolved := make([]string, len(addrs))
+	for i, a := range addrs {
+		resolved[i] = a.Addr
+	}
+	if slices.Equal(resolved, r.last) {
+		return nil
+	}
+	slog.Info("Updating backend addresses in pool", "previous", r.last, "addresses", resolved)
+	r.last = resolved
+
 	// If a resolver sets Addresses but does not set Endpoints, one Endpoint
 	// will be created for each Address before the State is passed to the LB
 	// policy.
-	return r.cc.UpdateState(resolver.State{Addresses: addrs})
+	state := resolver.State{Addresses: addrs}
+	if r.probing.metrics != nil {
+		state.Attributes = state.Attributes.WithValue(metricsKey{}, r.probing.metrics)
+	}
+	if r.prober != nil {
+		state.Attributes = state.Attributes.WithValue(proberKey{}, r.prober)
+	}
+	return r.cc.UpdateState(state)
+}
+
+// resolve looks up the IP addresses of the provided host:port address. If the lookup fails, the address is returned
+// as is and grpc will resolve it when dialing.
+func resolve(addr string) []string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return []string{addr}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil || len(ips) == 0 {
+		slog.Warn("unable to resolve backend address", "host", host, "err", err)
+		return []string{addr}
+	}
+
+	// we want a stable order to be able to detect changes
+	slices.Sort(ips)
+	ret := make([]string, len(ips))
+	for i, ip := range ips {
+		ret[i] = net.JoinHostPort(ip, port)
+	}
+	return ret
+}
+
+// minTTL is the shortest interval at which the backends are re-resolved because of the TTL of their records.
+const minTTL = 5 * time.Second
+
+// nextResolve returns the delay before re-resolving the backend addresses: the provided interval, shortened to the
+// TTL of the last resolved backends when it is known. Re-resolving stays disabled when the interval is 0.
+func (r *FallbackResolver) nextResolve(interval time.Duration) time.Duration {
+	if interval <= 0 || r.ttl <= 0 {
+		return interval
+	}
+	return min(interval, max(r.ttl, minTTL))
+}
+
+// watch re-resolves the backend addresses at the provided interval, or sooner when the TTL of the backends is
+// shorter, or when ResolveNow is called.
+func (r *FallbackResolver) watch(interval time.Duration) {
+	for {
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if next := r.nextResolve(interval); next > 0 {
+			timer = time.NewTimer(next)
+			tick = timer.C
+		}
+		select {
+		case <-tick:
+		case <-r.resolveNow:
+		case <-r.closing:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := r.start(); err != nil {
+			slog.Error("error updating resolved backend addresses", "err", err)
+		}
+	}
+}
+
+// Backend is a backend address along with its priority, backends with a higher priority are preferred.
+type Backend struct {
+	Addr     string
+	Priority int
+	// Weight orders the backends of the same priority, the ones with a higher weight being preferred
+	Weight int
+	// TLS makes the connections to the backend use TLS rather than being insecure
+	TLS bool
+	// Region is the region of the backend, it is only reported along with the balancer state
+	Region string
+	// Canary is the percentage of the calls sent to the backend whatever its priority, to roll out a new node safely
+	Canary float64
+}
+
+// ParseBackends parses a comma separated list of backends, each optionally followed by |-separated attributes, e.g.
+// "local:4444|10,remote:443|priority=1|weight=5|tls=true|region=eu-west,new:443|0|canary=5". A bare number is the priority of the
+// backend, backends without priority have a priority of 1 and a weight of 0. The returned backends are sorted by
+// decreasing priority then weight, backends with the same priority and weight keeping the order in which they were
+// provided. The balancer only relies on that order, trying the next backend when the previous ones are unavailable.
+func ParseBackends(endpoint string) ([]Backend, error) {
+	addrStrs := strings.Split(endpoint, ",")
+	backends := make([]Backend, len(addrStrs))
+	for i, a := range addrStrs {
+		fields := strings.Split(a, "|")
+		b := Backend{Addr: fields[0], Priority: 1}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				key, value = "priority", field
+			}
+			var err error
+			switch key {
+			case "priority":
+				b.Priority, err = strconv.Atoi(value)
+			case "weight":
+				b.Weight, err = strconv.Atoi(value)
+			case "tls":
+				b.TLS, err = strconv.ParseBool(value)
+			case "region":
+				b.Region = value
+			case "canary":
+				b.Canary, err = strconv.ParseFloat(value, 64)
+				if err == nil && (b.Canary < 0 || b.Canary > 100) {
+					err = errors.New("not a percentage")
+				}
+			default:
+				err = errors.New("unknown attribute")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s for backend %q: %w", key, a, err)
+			}
+		}
+		backends[i] = b
+	}
+
+	slices.SortStableFunc(backends, func(a, b Backend) int {
+		if a.Priority != b.Priority {
+			return b.Priority - a.Priority
+		}
+		return b.Weight - a.Weight
+	})
+
+	return backends, nil
+}
+
+// ResolveNow triggers a re-resolution of the backend addresses, it is a no-op if one is already pending.
+func (r *FallbackResolver) ResolveNow(_ resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *FallbackResolver) Close() {
+	close(r.closing)
+	if r.prober != nil {
+		r.prober.Close()
+	}
+}
+
+const SRVResolverName = "srv"
+
+// SRVResolverBuilder builds FallbackResolvers discovering their backends using the DNS SRV records of the target,
+// e.g. srv:///_drand._tcp.example.com. The backends are ordered by SRV priority, and randomly by weight within a priority
+// as RFC 2782 requires, and the records are looked up again at the resolve interval, or when their TTL expires if it is
+// shorter.
+type SRVResolverBuilder struct {
+	// probing holds the settings of the active probing of the discovered backends
+	probing probing
+	// resolveInterval is the interval at which the discovered backends are looked up again
+	resolveInterval time.Duration
+}
+
+func (b *SRVResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	return newFallbackResolver(target, cc, b.probing, b.resolveInterval, func() ([]Backend, time.Duration, error) {
+		return lookupSRV(target.Endpoint())
+	})
+}
+
+func (*SRVResolverBuilder) Scheme() string {
+	return SRVResolverName
+}
+
+// srvLookup looks up the SRV records of a name, it is replaced in tests.
+var srvLookup = net.DefaultResolver.LookupSRV
+
+// srvTTL looks up the TTL of the SRV records of a name, asking each nameserver in turn, it is replaced in tests.
+var srvTTL = func(ctx context.Context, name string) (time.Duration, error) {
+	servers, err := nameservers("/etc/resolv.conf")
+	if err != nil {
+		return 0, err
+	}
+	for _, server := range servers {
+		var ttl time.Duration
+		if ttl, err = lookupSRVTTL(ctx, server, name); err == nil {
+			return ttl, nil
+		}
+	}
+	return 0, err
 }
 
-func (*FallbackResolver) ResolveNow(_ resolver.ResolveNowOptions) {}
+// lookupSRV returns the backends advertised in the SRV records of the provided name, in their order of preference,
+// along with the TTL of the records if it could be found.
+func lookupSRV(name string) ([]Backend, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, srvs, err := srvLookup(ctx, "", "", name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to lookup SRV records for %q: %w", name, err)
+	}
+
+	// the Go resolver doesn't expose the TTL, we only query it ourselves for the name as is, without the search domains
+	// and options of resolv.conf, and fall back to the resolve interval alone when we can't get it
+	ttl, err := srvTTL(ctx, name)
+	if err != nil {
+		slog.Debug("unable to get the TTL of the SRV records", "name", name, "err", err)
+	}
+
+	orderSRV(srvs)
 
-func (*FallbackResolver) Close() {}
+	backends := make([]Backend, len(srvs))
+	for i, srv := range srvs {
+		backends[i] = Backend{
+			Addr:     net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+			Priority: len(srvs) - i,
+		}
+	}
+	return backends, ttl, nil
+}
+
+// orderSRV orders the SRV records by ascending priority, and randomly within a priority, picking each record in turn
+// with a probability proportional to its weight, as described in RFC 2782.
+func orderSRV(srvs []*net.SRV) {
+	slices.SortStableFunc(srvs, func(a, b *net.SRV) int {
+		return int(a.Priority) - int(b.Priority)
+	})
+	for i := 0; i < len(srvs); {
+		j := i + 1
+		for j < len(srvs) && srvs[j].Priority == srvs[i].Priority {
+			j++
+		}
+		shuffleSRV(srvs[i:j])
+		i = j
+	}
+}
+
+// shuffleSRV orders SRV records of the same priority randomly, the records with a higher weight being more likely to
+// come first. The records with a zero weight are placed first before picking, so that they have a small chance of being
+// picked as the RFC requires.
+func shuffleSRV(srvs []*net.SRV) {
+	slices.SortStableFunc(srvs, func(a, b *net.SRV) int {
+		return int(min(a.Weight, 1)) - int(min(b.Weight, 1))
+	})
+	for i := range srvs {
+		sum := 0
+		for _, srv := range srvs[i:] {
+			sum += int(srv.Weight)
+		}
+		n := rand.IntN(sum + 1)
+		for j := i; j < len(srvs); j++ {
+			if n -= int(srvs[j].Weight); n <= 0 {
+				// move the picked record in place, keeping the order of the others
+				picked := srvs[j]
+				copy(srvs[i+1:j+1], srvs[i:j])
+				srvs[i] = picked
+				break
+			}
+		}
+	}
+}
+
+// nameservers returns the addresses of the nameservers of the provided resolv.conf file.
+func nameservers(resolvConf string) ([]string, error) {
+	conf, err := os.ReadFile(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, line := range strings.Split(string(conf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameserver in %s", resolvConf)
+	}
+	return servers, nil
+}
+
+// lookupSRVTTL queries the provided DNS server for the SRV records of a name, returning their lowest TTL.
+func lookupSRVTTL(ctx context.Context, server, name string) (time.Duration, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return 0, err
+	}
+
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET}); err != nil {
+		return 0, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return 0, err
+	}
+
+	// the answer is asked again over TCP when it doesn't fit in a UDP datagram
+	var p dnsmessage.Parser
+	var h dnsmessage.Header
+	for _, network := range []string{"udp", "tcp"} {
+		answer, err := dnsExchange(ctx, network, server, query)
+		if err != nil {
+			return 0, err
+		}
+		if h, err = p.Start(answer); err != nil {
+			return 0, err
+		}
+		if !h.Truncated {
+			break
+		}
+	}
+	if h.Truncated {
+		return 0, fmt.Errorf("truncated DNS answer for %q", name)
+	}
+	if h.ID != id || h.RCode != dnsmessage.RCodeSuccess {
+		return 0, fmt.Errorf("unexpected DNS answer for %q: %v", name, h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return 0, err
+	}
+
+	var ttl uint32
+	found := false
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		if rh.Type == dnsmessage.TypeSRV && (!found || rh.TTL < ttl) {
+			ttl, found = rh.TTL, true
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return 0, err
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no SRV records for %q", name)
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// dnsExchange sends the DNS query to the server over UDP or TCP, returning its answer.
+func dnsExchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// the messages are prefixed with their length over TCP
+	if _, err := conn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, int(length[0])<<8|int(length[1]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,349 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestParseBackends(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		expected []Backend
+		wantErr  bool
+	}{
+		{
+			name:     "single",
+			endpoint: "localhost:4444",
+			expected: []Backend{{Addr: "localhost:4444", Priority: 1}},
+		}, {
+			name:     "list order",
+			endpoint: "a:1,b:2,c:3",
+			expected: []Backend{{Addr: "a:1", Priority: 1}, {Addr: "b:2", Priority: 1}, {Addr: "c:3", Priority: 1}},
+		}, {
+			name:     "priorities",
+			endpoint: "remote:443|1,local:4444|10",
+			expected: []Backend{{Addr: "local:4444", Priority: 10}, {Addr: "remote:443", Priority: 1}},
+		}, {
+			name:     "same priorities keep order",
+			endpoint: "a:1|5,b:2,c:3|5",
+			expected: []Backend{{Addr: "a:1", Priority: 5}, {Addr: "c:3", Priority: 5}, {Addr: "b:2", Priority: 1}},
+		}, {
+			name:     "attributes",
+			endpoint: "a:1|priority=5|region=eu-west,b:443|5|weight=2|tls=true",
+			expected: []Backend{
+				{Addr: "b:443", Priority: 5, Weight: 2, TLS: true},
+				{Addr: "a:1", Priority: 5, Region: "eu-west"},
+			},
+		}, {
+			name:     "canary",
+			endpoint: "a:1,b:2|0|canary=2.5",
+			expected: []Backend{{Addr: "a:1", Priority: 1}, {Addr: "b:2", Priority: 0, Canary: 2.5}},
+		}, {
+			name:     "invalid canary",
+			endpoint: "a:1|canary=120",
+			wantErr:  true,
+		}, {
+			name:     "invalid priority",
+			endpoint: "a:1|high",
+			wantErr:  true,
+		}, {
+			name:     "invalid tls",
+			endpoint: "a:1|tls=maybe",
+			wantErr:  true,
+		}, {
+			name:     "unknown attribute",
+			endpoint: "a:1|zone=a",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBackends(tt.endpoint)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+// statesRecorder is a resolver.ClientConn recording the states pushed by a resolver.
+type statesRecorder struct {
+	resolver.ClientConn
+	states chan resolver.State
+}
+
+func (s *statesRecorder) UpdateState(state resolver.State) error {
+	s.states <- state
+	return nil
+}
+
+func TestFallbackResolverResolves(t *testing.T) {
+	u, err := url.Parse("fallback:///127.0.0.1:5555|tls=true|region=eu-west,localhost:4444")
+	require.NoError(t, err)
+	cc := &statesRecorder{states: make(chan resolver.State, 10)}
+	r, err := (&FallbackResolver{}).Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	state := <-cc.states
+	require.GreaterOrEqual(t, len(state.Addresses), 2)
+	require.Equal(t, "127.0.0.1:5555", state.Addresses[0].Addr)
+	// the attributes of the backends are attached to their addresses
+	require.Equal(t, true, state.Addresses[0].Attributes.Value("tls"))
+	require.Equal(t, "eu-west", state.Addresses[0].Attributes.Value("region"))
+	require.Equal(t, false, state.Addresses[1].Attributes.Value("tls"))
+	for _, a := range state.Addresses[1:] {
+		// the host names are resolved, keeping them as server name and backend
+		require.NotEqual(t, "localhost:4444", a.Addr)
+		require.Equal(t, "localhost:4444", a.ServerName)
+		require.Equal(t, "localhost:4444", a.Attributes.Value("backend"))
+	}
+	// every address has its own order, even the IPs of the same host
+	for i, a := range state.Addresses {
+		require.Equal(t, i, a.Attributes.Value("order"))
+	}
+
+	// the same addresses aren't pushed again
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	select {
+	case state := <-cc.states:
+		t.Fatalf("unexpected state update with unchanged addresses: %v", state)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFallbackResolverProbes(t *testing.T) {
+	u, err := url.Parse("fallback:///127.0.0.1:5555,127.0.0.1:4444")
+	require.NoError(t, err)
+
+	// the globally registered resolver doesn't probe the backends
+	cc := &statesRecorder{states: make(chan resolver.State, 10)}
+	r, err := (&FallbackResolver{}).Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	state := <-cc.states
+	require.Nil(t, state.Attributes.Value(proberKey{}))
+	r.Close()
+
+	cc = &statesRecorder{states: make(chan resolver.State, 10)}
+	r, err = (&FallbackResolver{probing: probing{interval: time.Minute, log: slog.Default()}}).Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	state = <-cc.states
+	p, ok := state.Attributes.Value(proberKey{}).(*prober)
+	require.True(t, ok)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	require.Len(t, p.conns, 2)
+	require.Contains(t, p.conns, "127.0.0.1:5555")
+	require.Contains(t, p.conns, "127.0.0.1:4444")
+}
+
+func TestResolve(t *testing.T) {
+	require.Equal(t, []string{"10.0.0.1:443"}, resolve("10.0.0.1:443"))
+	require.Equal(t, []string{"[::1]:443"}, resolve("[::1]:443"))
+	// the unresolvable addresses are left to grpc
+	require.Equal(t, []string{"unknown.invalid:443"}, resolve("unknown.invalid:443"))
+}
+
+func TestSRVResolver(t *testing.T) {
+	defer func(lookup func(context.Context, string, string, string) (string, []*net.SRV, error)) {
+		srvLookup = lookup
+	}(srvLookup)
+	defer func(lookup func(context.Context, string) (time.Duration, error)) {
+		srvTTL = lookup
+	}(srvTTL)
+	srvTTL = func(context.Context, string) (time.Duration, error) {
+		return 30 * time.Second, nil
+	}
+	srvLookup = func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		require.Equal(t, "_drand._tcp.example.com", name)
+		return "", []*net.SRV{
+			{Target: "10.0.0.3.", Port: 443, Priority: 20, Weight: 100},
+			{Target: "10.0.0.1.", Port: 443, Priority: 10, Weight: 1},
+			{Target: "10.0.0.2.", Port: 4444, Priority: 10, Weight: 50},
+		}, nil
+	}
+
+	u, err := url.Parse("srv:///_drand._tcp.example.com")
+	require.NoError(t, err)
+	cc := &statesRecorder{states: make(chan resolver.State, 10)}
+	r, err := (&SRVResolverBuilder{probing: probing{interval: time.Minute, log: slog.Default()}}).Build(resolver.Target{URL: *u}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	// the backends are ordered by priority first, and randomly by weight within a priority
+	state := <-cc.states
+	var addrs []string
+	for _, a := range state.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	require.Len(t, addrs, 3)
+	require.ElementsMatch(t, []string{"10.0.0.2:4444", "10.0.0.1:443"}, addrs[:2])
+	require.Equal(t, "10.0.0.3:443", addrs[2])
+
+	// the discovered backends are probed
+	p, ok := state.Attributes.Value(proberKey{}).(*prober)
+	require.True(t, ok)
+	p.mu.Lock()
+	require.Len(t, p.conns, 3)
+	require.Contains(t, p.conns, "10.0.0.3:443")
+	p.mu.Unlock()
+
+	// the records are looked up again when their TTL expires
+	require.Equal(t, 30*time.Second, r.(*FallbackResolver).nextResolve(5*time.Minute))
+
+	srvLookup = func(context.Context, string, string, string) (string, []*net.SRV, error) {
+		return "", nil, errors.New("no such host")
+	}
+	_, _, err = lookupSRV("_drand._tcp.example.com")
+	require.Error(t, err)
+}
+
+func TestNextResolve(t *testing.T) {
+	r := &FallbackResolver{}
+	require.Equal(t, time.Minute, r.nextResolve(time.Minute))
+	require.Zero(t, r.nextResolve(0))
+
+	r.ttl = 30 * time.Second
+	require.Equal(t, 30*time.Second, r.nextResolve(time.Minute))
+	require.Equal(t, 10*time.Second, r.nextResolve(10*time.Second))
+	// the TTL doesn't enable re-resolving when it is disabled
+	require.Zero(t, r.nextResolve(0))
+
+	r.ttl = time.Second
+	require.Equal(t, minTTL, r.nextResolve(time.Minute))
+}
+
+func TestOrderSRV(t *testing.T) {
+	first := make(map[string]int)
+	for range 1000 {
+		srvs := []*net.SRV{
+			{Target: "backup.", Priority: 20, Weight: 100},
+			{Target: "light.", Priority: 10, Weight: 10},
+			{Target: "zero.", Priority: 10, Weight: 0},
+			{Target: "heavy.", Priority: 10, Weight: 30},
+		}
+		orderSRV(srvs)
+		require.Equal(t, "backup.", srvs[3].Target, "the records are ordered by priority")
+		first[srvs[0].Target]++
+	}
+	// the records are picked with a probability proportional to their weight, the zero weight ones rarely
+	require.InDelta(t, 730, first["heavy."], 100)
+	require.InDelta(t, 245, first["light."], 100)
+	require.Less(t, first["zero."], 100)
+}
+
+// srvAnswer returns the answer to a DNS query for SRV records with 2 records of different TTLs, or with none and the
+// truncated bit set if truncated is set.
+func srvAnswer(query []byte, truncated bool) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Truncated: truncated})
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if !truncated {
+		for _, ttl := range []uint32{300, 42} {
+			b.SRVResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl},
+				dnsmessage.SRVResource{Priority: 10, Weight: 1, Port: 443, Target: dnsmessage.MustNewName("node.example.com.")})
+		}
+	}
+	msg, _ := b.Finish()
+	return msg
+}
+
+// serveDNS answers a single DNS query on the provided UDP connection, truncating the answer if truncated is set.
+func serveDNS(conn net.PacketConn, truncated bool) {
+	buf := make([]byte, 512)
+	n, addr, err := conn.ReadFrom(buf)
+	if err != nil {
+		return
+	}
+	conn.WriteTo(srvAnswer(buf[:n], truncated), addr)
+}
+
+func TestLookupSRVTTL(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go serveDNS(conn, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ttl, err := lookupSRVTTL(ctx, conn.LocalAddr().String(), "_drand._tcp.example.com")
+	require.NoError(t, err)
+	require.Equal(t, 42*time.Second, ttl)
+}
+
+func TestLookupSRVTTLTruncated(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	conn, err := net.ListenPacket("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the UDP answer is truncated, the TCP one is complete
+	go serveDNS(conn, true)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var length [2]byte
+		if _, err := io.ReadFull(c, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, int(length[0])<<8|int(length[1]))
+		if _, err := io.ReadFull(c, query); err != nil {
+			return
+		}
+		answer := srvAnswer(query, false)
+		c.Write(append([]byte{byte(len(answer) >> 8), byte(len(answer))}, answer...))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ttl, err := lookupSRVTTL(ctx, l.Addr().String(), "_drand._tcp.example.com")
+	require.NoError(t, err)
+	require.Equal(t, 42*time.Second, ttl)
+}
+
+func TestNameservers(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(conf, []byte("# comment\nsearch example.com\nnameserver 10.0.0.53\nnameserver 10.0.0.54\n"), 0o600))
+	servers, err := nameservers(conf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.53:53", "10.0.0.54:53"}, servers)
+
+	require.NoError(t, os.WriteFile(conf, []byte("search example.com\n"), 0o600))
+	_, err = nameservers(conf)
+	require.Error(t, err)
+}
@@ -5,18 +5,24 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"slices"
 	"sync"
 	"time"
 
 	proto "github.com/drand/drand/v2/protobuf/drand"
 	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
 	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/protoadapt"
 )
@@ -29,7 +35,7 @@ func init() {
 	balancer.Register(NewFallbackBuilder(FallbackTimeout))
 	// registers the logging_pick_first_with_fallback balancer
 	balancer.Register(NewLoggingBalancerBuilder("pick_first_with_fallback", slog.With("service", "balancer")))
-	if err := bindMetrics(); err != nil {
+	if _, err := bindMetrics(ClientMetrics); err != nil {
 		slog.Error("Failed to bind metrics during grpc init", "err", err)
 	}
 	clock = time.Now
@@ -50,15 +56,204 @@ type Client struct {
 	pc            proto.PublicClient
 	serverAddr    string
 	knownChains   sync.Map
+	unknown       unknownChains
 	healthTimeout time.Duration
 	log           logger
+
+	// closing is closed when the Client is closed, to stop its background tasks such as the chain info refresh
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	// refreshMu serializes the refreshes of the knownChains triggered by unknown chainhashes, done at most once every
+	// ChainsRefreshInterval as tracked by refreshed
+	refreshMu sync.Mutex
+	refreshed time.Time
+
+	// chainsMu guards the cached list of chains served by GetChains, fetched at chainsAt and being refreshed in the
+	// background when refreshing is set
+	chainsMu   sync.Mutex
+	chains     []string
+	chainsAt   time.Time
+	refreshing bool
+	chainsTTL  time.Duration
+
+	// verify makes the Client check the signature of the beacons it gets, see WithVerification
+	verify bool
+	// hedgeDelay is the delay after which the GetBeacon calls are hedged, see WithHedging
+	hedgeDelay time.Duration
+	// retryAttempts is the maximum number of attempts of the calls according to the retry policy of the Client
+	retryAttempts int
+	// metrics are the collectors of the registry of the Client, see WithRegistry
+	metrics *clientMetrics
+}
+
+// ChainsTTL is how long the Clients serve their cached list of chains before refreshing it in the background by
+// default, see WithChainsTTL. The list is fetched on every call when set to 0.
+var ChainsTTL = 30 * time.Second
+
+// chainsRefreshTimeout bounds the background refreshes of the cached list of chains.
+const chainsRefreshTimeout = 10 * time.Second
+
+// ChainsRefreshInterval is the minimum interval between two refreshes of the chains known by a Client triggered by
+// requests for unknown chainhashes, to avoid hitting the backends for every random chainhash probed.
+var ChainsRefreshInterval = time.Minute
+
+// ClientOption allows to customize the underlying grpc connection of a Client when calling NewClient.
+type ClientOption func(*clientConfig)
+
+type clientConfig struct {
+	dialOpts         []grpc.DialOption
+	probeInterval    time.Duration
+	chaos            *Chaos
+	recorder         *recorder
+	registry         prometheus.Registerer
+	lb               LBConfig
+	retryPolicy      string
+	hedgeDelay       time.Duration
+	verify           bool
+	resolveInterval  time.Duration
+	unknownChainTTL  time.Duration
+	chainsTTL        time.Duration
+	chainInfoRefresh time.Duration
+}
+
+// WithKeepalive enables client-side keepalive pings on the connection: a ping is sent after `interval` without
+// activity and the connection is closed if it isn't acknowledged within `timeout`. When permitWithoutStream is true,
+// pings are sent even if there are no active RPCs, which keeps idle connections alive through NAT and load balancers.
+func WithKeepalive(interval, timeout time.Duration, permitWithoutStream bool) ClientOption {
+	return func(c *clientConfig) {
+		c.dialOpts = append(c.dialOpts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                interval,
+			Timeout:             timeout,
+			PermitWithoutStream: permitWithoutStream,
+		}))
+	}
+}
+
+// WithCompression enables gzip compression on all the calls done to the backends. It is mostly useful when talking
+// to distant nodes over constrained links, since chain lists and chain info packets compress well.
+func WithCompression() ClientOption {
+	return func(c *clientConfig) {
+		c.dialOpts = append(c.dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	}
+}
+
+// WithActiveProbing makes the Client check all its backends at the provided interval, rather than only the one
+// currently in use, so that a recovered backend is promoted quickly and a stuck one is demoted before requests hit it.
+func WithActiveProbing(interval time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.probeInterval = interval
+	}
+}
+
+// WithRegistry registers the metrics of the Client on the provided registerer instead of ClientMetrics, e.g. to serve
+// them along with the metrics of a program embedding the relay. Several Clients can share the same registerer.
+func WithRegistry(reg prometheus.Registerer) ClientOption {
+	return func(c *clientConfig) {
+		c.registry = reg
+	}
+}
+
+// WithLatencyAware enables or disables latency-aware picking, see LatencyAware.
+func WithLatencyAware(enabled bool) ClientOption {
+	return func(c *clientConfig) {
+		c.lb.LatencyAware = enabled
+	}
+}
+
+// WithChainAffinity enables or disables chain-affinity, see ChainAffinity.
+func WithChainAffinity(enabled bool) ClientOption {
+	return func(c *clientConfig) {
+		c.lb.ChainAffinity = enabled
+	}
+}
+
+// WithMaxInflight caps the number of concurrent unary calls sent to each backend, see MaxInflight.
+func WithMaxInflight(limit int) ClientOption {
+	return func(c *clientConfig) {
+		c.lb.MaxInflight = limit
+	}
+}
+
+// WithRetryPolicy sets the grpc retry policy of the PublicRand and health Check calls, see RetryPolicy. The retries are
+// disabled when it is empty.
+func WithRetryPolicy(policy string) ClientOption {
+	return func(c *clientConfig) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithHedging sets the delay after which a GetBeacon call still waiting for its backend is also sent to the next one,
+// see HedgeDelay. Hedging is disabled when it is 0.
+func WithHedging(delay time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.hedgeDelay = delay
+	}
+}
+
+// WithVerification enables or disables the verification of the beacons, see VerifyBeacons.
+func WithVerification(enabled bool) ClientOption {
+	return func(c *clientConfig) {
+		c.verify = enabled
+	}
+}
+
+// WithResolveInterval sets the interval at which the host names of the backends are re-resolved, see
+// ResolveInterval. Disabled when set to 0.
+func WithResolveInterval(interval time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.resolveInterval = interval
+	}
+}
+
+// WithUnknownChainTTL sets how long the chains unknown to the backends are remembered, see UnknownChainTTL. Disabled
+// when set to 0.
+func WithUnknownChainTTL(ttl time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.unknownChainTTL = ttl
+	}
+}
+
+// WithChainsTTL sets how long the list of chains is cached, see ChainsTTL. It is fetched on every call when set to 0.
+func WithChainsTTL(ttl time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.chainsTTL = ttl
+	}
+}
+
+// WithChainInfoRefresh sets the interval at which the cached chain infos are revalidated, see ChainInfoRefresh.
+// Disabled when set to 0.
+func WithChainInfoRefresh(interval time.Duration) ClientOption {
+	return func(c *clientConfig) {
+		c.chainInfoRefresh = interval
+	}
 }
 
-// NewClient establishes a new non-TLS grpc connection to the provided server address. It takes a logger and uses
-// a default value for healthTimeout.
-func NewClient(serverAddr string, l logger) (*Client, error) {
+// NewClient establishes a new grpc connection to the provided server address, which is non-TLS unless the backends
+// ask for TLS using the tls attribute of the fallback:/// target. It takes a logger and uses
+// a default value for healthTimeout. Extra ClientOption can be provided to customize the grpc connection.
+func NewClient(serverAddr string, l logger, opts ...ClientOption) (*Client, error) {
 	l.Debug("NewClient", "serverAddr", serverAddr)
 
+	cfg := &clientConfig{
+		registry:         ClientMetrics,
+		lb:               LBConfig{LatencyAware: LatencyAware, ChainAffinity: ChainAffinity, MaxInflight: MaxInflight},
+		retryPolicy:      RetryPolicy,
+		hedgeDelay:       HedgeDelay,
+		verify:           VerifyBeacons,
+		resolveInterval:  ResolveInterval,
+		unknownChainTTL:  UnknownChainTTL,
+		chainsTTL:        ChainsTTL,
+		chainInfoRefresh: ChainInfoRefresh,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	metrics, err := bindMetrics(cfg.registry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register the grpc metrics: %w", err)
+	}
+
 	// setup metrics for GRPC calls
 	clMetrics := grpcprom.NewClientMetrics(
 		grpcprom.WithClientHandlingTimeHistogram(
@@ -70,21 +265,50 @@ func NewClient(serverAddr string, l logger) (*Client, error) {
 		),
 	)
 
-	// register client metrics
-	ClientMetrics.Register(clMetrics)
+	// register client metrics, the Clients sharing a registry share their metrics
+	clMetrics, err = Register(cfg.registry, clMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register the grpc client metrics: %w", err)
+	}
 
-	conn, err := grpc.NewClient(serverAddr,
-		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"logging_pick_first_with_fallback"}`),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	dialOpts := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(serviceConfig(cfg.retryPolicy, &cfg.lb)),
+		grpc.WithTransportCredentials(newAddressCredentials()),
 		grpc.WithChainUnaryInterceptor(
-			clMetrics.UnaryClientInterceptor(),
+			clMetrics.UnaryClientInterceptor(grpcprom.WithExemplarFromContext(TraceExemplar)),
 			UsedEndpointInterceptor(l),
 		),
 		grpc.WithChainStreamInterceptor(
-			clMetrics.StreamClientInterceptor(),
+			clMetrics.StreamClientInterceptor(grpcprom.WithExemplarFromContext(TraceExemplar)),
 		),
 		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
-	)
+	}
+
+	if cfg.recorder != nil {
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(cfg.recorder.UnaryInterceptor()),
+			grpc.WithChainStreamInterceptor(cfg.recorder.StreamInterceptor()),
+		)
+	}
+
+	// the chaos interceptors come last to act as if the faults came from the backends
+	if cfg.chaos != nil {
+		l.Warn("chaos mode enabled, injecting faults in grpc calls", "chaos", *cfg.chaos)
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(cfg.chaos.UnaryInterceptor()),
+			grpc.WithChainStreamInterceptor(cfg.chaos.StreamInterceptor()),
+		)
+	}
+
+	// our own resolvers re-resolve the backends at our interval, and probe them if enabled, handing their prober and
+	// the metrics of the Client over to the fallback balancer
+	p := probing{interval: cfg.probeInterval, log: l, dialOpts: cfg.dialOpts, metrics: metrics}
+	dialOpts = append(dialOpts, grpc.WithResolvers(
+		&FallbackResolver{probing: p, resolveInterval: cfg.resolveInterval},
+		&SRVResolverBuilder{probing: p, resolveInterval: cfg.resolveInterval},
+	))
+
+	conn, err := grpc.NewClient(serverAddr, append(dialOpts, cfg.dialOpts...)...)
 	if err != nil {
 		l.Error("Unable to dial new grpc client", "err", err)
 	}
@@ -94,6 +318,16 @@ func NewClient(serverAddr string, l logger) (*Client, error) {
 		serverAddr:    serverAddr,
 		healthTimeout: time.Second,
 		log:           l,
+		closing:       make(chan struct{}),
+		unknown:       unknownChains{ttl: cfg.unknownChainTTL},
+		chainsTTL:     cfg.chainsTTL,
+		verify:        cfg.verify,
+		hedgeDelay:    cfg.hedgeDelay,
+		retryAttempts: retryAttempts(cfg.retryPolicy),
+		metrics:       metrics,
+	}
+	if cfg.chainInfoRefresh > 0 {
+		go client.runChainInfoRefresh(cfg.chainInfoRefresh)
 	}
 
 	// we do a GetChains call to pre-populate the knownChains, note that we have a 500ms healthTimeout built-in above
@@ -111,6 +345,11 @@ func (c *Client) SetTimeout(timeout time.Duration) {
 func (c *Client) Close() error {
 	c.log.Debug("Client Closing")
 
+	c.closeOnce.Do(func() {
+		if c.closing != nil {
+			close(c.closing)
+		}
+	})
 	return c.conn.Close()
 }
 
@@ -123,45 +362,85 @@ func (c *Client) GetBeacon(ctx context.Context, m *proto.Metadata, round uint64)
 		Round:    round,
 		Metadata: m,
 	}
+	ctx = withChain(ctx, m)
+	// the failed calls are retried on the next subconn according to the retry policy, thanks to the fallback LB
+	rctx, node := withPickedNode(ctx)
 
-	randResp, err := c.pc.PublicRand(ctx, in)
+	randResp, err := c.publicRand(rctx, in, node)
 	if err != nil {
-		c.log.Debug("GetBeacon failed once")
-		// we do 1 retry (automagically with the next subconn thanks to the fallback LB) if it failed
-		randResp, err = c.pc.PublicRand(ctx, in)
+		return nil, wrapError(err)
+	}
+
+	beacon := NewHexBeacon(randResp)
+	beacon.ApplyScheme(c.scheme(ctx, m))
+
+	if c.verify {
+		info, err := c.GetChainInfo(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		// we retry with the next subconns according to the retry policy, in case only the current backend is corrupted,
+		// as long as the request deadline isn't reached
+		err = c.verifyBeacon(info, beacon)
+		for attempt := 1; err != nil && attempt < c.retryAttempts && ctx.Err() == nil; attempt++ {
+			randResp, err = c.pc.PublicRand(context.WithValue(rctx, SkipCtxKey{}, true), in)
+			if err != nil {
+				return nil, wrapError(err)
+			}
+			beacon = NewHexBeacon(randResp)
+			beacon.ApplyScheme(info.Scheme)
+			err = c.verifyBeacon(info, beacon)
+		}
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return NewHexBeacon(randResp), nil
+	return beacon, nil
+}
+
+// scheme returns the scheme ID of the chain designated in the Metadata, relying on the cached chain info. It returns
+// an empty string if the chain info isn't available.
+func (c *Client) scheme(ctx context.Context, m *proto.Metadata) string {
+	info, err := c.GetChainInfo(ctx, m)
+	if err != nil {
+		c.log.Debug("unable to get chain info to retrieve scheme", "err", err)
+		return ""
+	}
+	return info.Scheme
 }
 
-// Watch returns new randomness as it becomes available.
+// Watch returns new randomness as it becomes available. A failed stream is re-established with an exponential backoff,
+// resuming from the round after the last one delivered, and the returned channel is only closed once the context is
+// canceled or after WatchAttempts consecutive attempts failed without delivering any beacon.
 func (c *Client) Watch(ctx context.Context, m *proto.Metadata) <-chan *HexBeacon {
 	c.log.Debug("Client Watch")
-	stream, err := c.pc.PublicRandStream(ctx, &proto.PublicRandRequest{Round: 0, Metadata: m})
 	ch := make(chan *HexBeacon, 1)
-	if err != nil {
-		close(ch)
-		return ch
-	}
 	go func() {
 		defer close(ch)
-		for {
-			next, err := stream.Recv()
-			switch {
-			case err != nil:
-				c.log.Error("public rand stream error", "err", err)
+		chain := chainKey(m)
+		backoff := WatchBackoff
+		var last uint64
+		for failures := 0; ; {
+			delivered, err := c.watchStream(ctx, m, &last, ch, failures > 0)
+			if ctx.Err() != nil {
 				return
-			case stream.Context().Err() != nil:
-				c.log.Error("public rand stream Ctx error", "err", stream.Context().Err())
+			}
+			if delivered {
+				failures, backoff = 0, WatchBackoff
+			}
+			if failures++; failures >= WatchAttempts {
+				c.log.Error("giving up on the public rand stream", "chain", chain, "attempts", failures, "err", err)
 				return
-			case ctx.Err() != nil:
-				c.log.Error("watch outer Ctx error", "err", stream.Context().Err())
+			}
+			c.log.Warn("public rand stream failed, reconnecting", "chain", chain, "after", backoff, "err", err)
+			select {
+			case <-ctx.Done():
 				return
+			case <-time.After(backoff):
 			}
-			ch <- NewHexBeacon(next)
+			backoff = min(2*backoff, WatchMaxBackoff)
+			c.metrics.watchReconnects.WithLabelValues(chain).Inc()
 		}
 	}()
 	return ch
@@ -190,20 +469,18 @@ func (c *Client) Check(ctx context.Context) error {
 
 	client := healthgrpc.NewHealthClient(c.conn)
 
-	tctx, cancel := context.WithTimeout(ctx, c.healthTimeout)
+	// the failed calls are retried on the next subconn according to the retry policy, thanks to the fallback LB
+	ctx, _ = withPickedNode(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.healthTimeout)
 	defer cancel()
 
-	resp, err := client.Check(tctx, &healthgrpc.HealthCheckRequest{})
+	resp, err := client.Check(ctx, &healthgrpc.HealthCheckRequest{})
 	if err != nil {
-		// we do 1 retry (automagically with the next subconn thanks to the fallback LB) if it failed
-		resp, err = client.Check(ctx, &healthgrpc.HealthCheckRequest{})
-		if err != nil {
-			return err
-		}
+		return wrapError(err)
 	}
 
 	if resp.GetStatus() != healthgrpc.HealthCheckResponse_SERVING {
-		return fmt.Errorf("grpc health: not serving")
+		return fmt.Errorf("%w: grpc health: not serving", ErrBackendUnavailable)
 	}
 
 	return nil
@@ -251,6 +528,18 @@ func (info *JsonInfoV2) ExpectedNext() (expectedTime int64, expectedRound uint64
 	return current*p + info.GenesisTime, uint64(current) + 1
 }
 
+// RoundTime returns the unix time at which the provided round is emitted, round 1 being emitted at GenesisTime. It
+// saturates at math.MaxInt64 for the rounds too far in the future to be represented.
+func (info *JsonInfoV2) RoundTime(round uint64) int64 {
+	if round == 0 {
+		return info.GenesisTime
+	}
+	if info.Period != 0 && round-1 > uint64(math.MaxInt64-info.GenesisTime)/uint64(info.Period) {
+		return math.MaxInt64
+	}
+	return info.GenesisTime + int64(round-1)*int64(info.Period)
+}
+
 func (j *JsonInfoV2) V1() *JsonInfoV1 {
 	return &JsonInfoV1{
 		PublicKey:   j.PublicKey,
@@ -281,13 +570,18 @@ func (c *Client) GetChainInfo(ctx context.Context, m *proto.Metadata) (*JsonInfo
 	c.log.Debug("Client GetChainInfo")
 
 	// typically either chain hash or beacon id are set, not both, unless the API is misused
-	if info, ok := c.knownChains.Load(hex.EncodeToString(m.GetChainHash()) + m.GetBeaconID()); ok {
+	key := hex.EncodeToString(m.GetChainHash()) + m.GetBeaconID()
+	if info, ok := c.knownChains.Load(key); ok {
 		res, ok := info.(*JsonInfoV2)
 		if ok {
 			return res, nil
 		}
 		c.log.Error("Client GetChainInfo: unexpected non-JsonInfoV2 content in map", "res", res)
 	}
+	if err := c.unknown.get(key); err != nil {
+		c.log.Debug("Client GetChainInfo unknown chain", "cache", "HIT", "chain", key)
+		return nil, err
+	}
 
 	c.log.Debug("Client GetChainInfo knownChains", "cache", "MISS")
 
@@ -295,8 +589,12 @@ func (c *Client) GetChainInfo(ctx context.Context, m *proto.Metadata) (*JsonInfo
 		Metadata: m,
 	}
 
-	resp, err := c.pc.ChainInfo(ctx, in)
+	resp, err := c.pc.ChainInfo(withChain(ctx, m), in)
 	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, ErrUnknownChain) {
+			c.unknown.add(key, err)
+		}
 		return nil, err
 	}
 
@@ -317,7 +615,7 @@ func (c *Client) GetBeaconIds(ctx context.Context) ([]string, []*proto.Metadata,
 	resp, err := c.pc.ListBeaconIDs(ctx, &proto.ListBeaconIDsRequest{})
 	if err != nil {
 		c.log.Error("client.GetBeaconIds", "err", err)
-		return nil, nil, err
+		return nil, nil, wrapError(err)
 	}
 
 	beaconIds := resp.GetIds()
@@ -330,12 +628,49 @@ func (c *Client) GetBeaconIds(ctx context.Context) ([]string, []*proto.Metadata,
 	return beaconIds, metadatas, nil
 }
 
-// GetChains returns an array of chain-hashes available on that grpc node. It does 1 ListBeaconIDs call and n calls to
-// get the ChainInfo, so it's a relatively noisy path. It uses an internal sync.Map in the Client to keep a cache of
-// valid chain info data, since the chain infos are stable and do not change over time.
+// GetChains returns an array of chain-hashes available on that grpc node. The list is cached for its TTL, after
+// which the cached list is still served while it is refreshed in the background. See fetchChains for the calls it
+// relies on when the list isn't cached.
 func (c *Client) GetChains(ctx context.Context) ([]string, error) {
 	c.log.Debug("Client GetChains")
 
+	c.chainsMu.Lock()
+	if c.chains != nil && c.chainsTTL > 0 {
+		chains := slices.Clone(c.chains)
+		if time.Since(c.chainsAt) >= c.chainsTTL && !c.refreshing {
+			c.refreshing = true
+			go c.refreshChains()
+		}
+		c.chainsMu.Unlock()
+		return chains, nil
+	}
+	c.chainsMu.Unlock()
+
+	return c.fetchChains(ctx)
+}
+
+// refreshChains refreshes the cached list of chains in the background.
+func (c *Client) refreshChains() {
+	ctx, cancel := context.WithTimeout(context.Background(), chainsRefreshTimeout)
+	defer cancel()
+	if _, err := c.fetchChains(ctx); err != nil {
+		c.log.Warn("unable to refresh cached chains, serving stale ones", "err", err)
+	}
+	c.chainsMu.Lock()
+	c.refreshing = false
+	c.chainsMu.Unlock()
+}
+
+// chainInfoWorkers bounds the number of concurrent ChainInfo calls done by fetchChains.
+const chainInfoWorkers = 8
+
+// fetchChains returns an array of chain-hashes available on that grpc node, and caches it for GetChains. It does 1
+// ListBeaconIDs call and n concurrent calls to get the ChainInfo, so it's a relatively noisy path. It uses an internal
+// sync.Map in the Client to keep a cache of valid chain info data, since the chain infos are stable and only change
+// across reshares, see ChainInfoRefresh. All the chains failing are reported in the returned error.
+func (c *Client) fetchChains(ctx context.Context) ([]string, error) {
+	c.log.Debug("Client fetchChains")
+
 	beaconIds, metadatas, err := c.GetBeaconIds(ctx)
 	if err != nil {
 		c.log.Error("client.ListBeaconIDs error when getting beacon IDs", "err", err)
@@ -343,6 +678,9 @@ func (c *Client) GetChains(ctx context.Context) ([]string, error) {
 	}
 
 	chains := make([]string, 0, len(metadatas))
+	errs := make([]error, len(metadatas))
+	var g errgroup.Group
+	g.SetLimit(chainInfoWorkers)
 	for i, meta := range metadatas {
 		chain := meta.GetChainHash()
 		strChain := hex.EncodeToString(chain)
@@ -352,31 +690,78 @@ func (c *Client) GetChains(ctx context.Context) ([]string, error) {
 			continue
 		}
 
-		in := &proto.ChainInfoRequest{
-			Metadata: &proto.Metadata{ChainHash: chain},
-		}
+		g.Go(func() error {
+			errs[i] = c.fetchChainInfo(ctx, chain, beaconIds[i])
+			return nil
+		})
+	}
+	g.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
-		info, err := c.pc.ChainInfo(ctx, in)
-		if err != nil {
-			c.log.Error("invalid call to ChainInfo", "err", err)
-			return nil, err
-		}
+	c.chainsMu.Lock()
+	c.chains = slices.Clone(chains)
+	c.chainsAt = time.Now()
+	c.chainsMu.Unlock()
 
-		hash := info.GetHash()
-		if !bytes.Equal(chain, hash) {
-			return nil, fmt.Errorf("invalid chainhash %q for chain %q", hash, chain)
-		}
-		c.knownChains.Store(strChain, NewInfoV2(info))
+	return chains, err
+}
 
-		if id := info.GetMetadata().GetBeaconID(); id != "" {
-			if beaconIds[i] != id {
-				c.log.Warn("potential mismatch of beacon ID and chain hash", "metadata", info.GetMetadata(), "index", i, "beaconIds", beaconIds, "chain", strChain)
-			}
-			c.knownChains.Store(id, NewInfoV2(info))
+// fetchChainInfo fetches the chain info of the provided chainhash and caches it, along with its beacon ID which is
+// expected to be the provided one.
+func (c *Client) fetchChainInfo(ctx context.Context, chain []byte, beaconID string) error {
+	in := &proto.ChainInfoRequest{
+		Metadata: &proto.Metadata{ChainHash: chain},
+	}
+
+	info, err := c.pc.ChainInfo(withChain(ctx, in.GetMetadata()), in)
+	if err != nil {
+		c.log.Error("invalid call to ChainInfo", "err", err)
+		return wrapError(err)
+	}
+
+	hash := info.GetHash()
+	if !bytes.Equal(chain, hash) {
+		return fmt.Errorf("invalid chainhash %q for chain %q", hash, chain)
+	}
+	strChain := hex.EncodeToString(chain)
+	c.knownChains.Store(strChain, NewInfoV2(info))
+
+	if id := info.GetMetadata().GetBeaconID(); id != "" {
+		if beaconID != id {
+			c.log.Warn("potential mismatch of beacon ID and chain hash", "metadata", info.GetMetadata(), "beaconID", beaconID, "chain", strChain)
 		}
+		c.knownChains.Store(id, NewInfoV2(info))
 	}
+	return nil
+}
 
-	return chains, err
+// Knows checks whether the provided hex-encoded chainhash is one of the chains served by the backends, relying on
+// the knownChains and refreshing them at most once every ChainsRefreshInterval for unknown chainhashes. It reports
+// the chainhash as known when the backends can't be reached, to let the callers deal with their errors themselves.
+func (c *Client) Knows(ctx context.Context, chain string) bool {
+	if _, ok := c.knownChains.Load(chain); ok {
+		return true
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	// another request might have refreshed the known chains while we were waiting
+	if _, ok := c.knownChains.Load(chain); ok {
+		return true
+	}
+	if time.Since(c.refreshed) < ChainsRefreshInterval {
+		return false
+	}
+
+	if _, err := c.fetchChains(ctx); err != nil {
+		c.log.Warn("unable to refresh known chains", "err", err)
+		return true
+	}
+	c.refreshed = time.Now()
+	_, ok := c.knownChains.Load(chain)
+	return ok
 }
 
 func (c *Client) String() string {
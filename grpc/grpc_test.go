@@ -1,14 +1,26 @@
 package grpc
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestNextBeaconTime(t *testing.T) {
 	clock = func() time.Time {
 		return time.Unix(1718551765, 0)
 	}
+	defer func() { clock = time.Now }()
 
 	tests := []struct {
 		name          string
@@ -74,3 +86,112 @@ func TestNextBeaconTime(t *testing.T) {
 		})
 	}
 }
+
+func TestRoundTime(t *testing.T) {
+	info := &JsonInfoV2{Period: 30, GenesisTime: 1595431050}
+	if got := info.RoundTime(1); got != info.GenesisTime {
+		t.Errorf("round 1 should be emitted at genesis, got %d", got)
+	}
+	if got := info.RoundTime(4104025); got != 1718551770 {
+		t.Errorf("unexpected round time: got = %v, want %v", got, 1718551770)
+	}
+	if got := info.RoundTime(math.MaxUint64); got != math.MaxInt64 {
+		t.Errorf("the round time should saturate instead of overflowing, got %d", got)
+	}
+}
+
+func TestGetChainsCached(t *testing.T) {
+	mock, addr, err := StartMockBackend("localhost:0", time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	c, err := NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	defer c.Close()
+
+	chains, err := c.GetChains(context.Background())
+	require.NoError(t, err)
+	require.Len(t, chains, 1)
+
+	// the cached list is served without the backend, even once stale
+	mock.Stop()
+	c.chainsMu.Lock()
+	c.chainsAt = time.Now().Add(-c.chainsTTL)
+	c.chainsMu.Unlock()
+	cached, err := c.GetChains(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, chains, cached)
+
+	c.chainsTTL = 0
+	_, err = c.GetChains(context.Background())
+	require.Error(t, err)
+}
+
+func TestUsedEndpoint(t *testing.T) {
+	mock, addr, err := StartMockBackend("localhost:0", time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	defer mock.Stop()
+	c, err := NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Empty(t, UsedEndpoint(context.Background()))
+	ctx := WithUsedEndpoint(context.Background())
+	require.Empty(t, UsedEndpoint(ctx), "no RPC was made yet")
+	_, err = c.GetBeacon(ctx, &proto.Metadata{BeaconID: "default"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, addr, UsedEndpoint(ctx))
+}
+
+// chainsClient is a PublicClient serving the chains with the provided chainhashes, failing the ChainInfo calls of the
+// ones without beacon ID, and recording the maximum number of concurrent ChainInfo calls.
+type chainsClient struct {
+	proto.PublicClient
+	chains   map[string]string
+	inflight atomic.Int32
+	maxSeen  atomic.Int32
+}
+
+func (s *chainsClient) ListBeaconIDs(context.Context, *proto.ListBeaconIDsRequest, ...grpc.CallOption) (*proto.ListBeaconIDsResponse, error) {
+	resp := &proto.ListBeaconIDsResponse{}
+	for hash, id := range s.chains {
+		resp.Ids = append(resp.Ids, id)
+		resp.Metadatas = append(resp.Metadatas, &proto.Metadata{ChainHash: []byte(hash), BeaconID: id})
+	}
+	return resp, nil
+}
+
+func (s *chainsClient) ChainInfo(_ context.Context, in *proto.ChainInfoRequest, _ ...grpc.CallOption) (*proto.ChainInfoPacket, error) {
+	n := s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	for seen := s.maxSeen.Load(); n > seen && !s.maxSeen.CompareAndSwap(seen, n); seen = s.maxSeen.Load() {
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	hash := in.GetMetadata().GetChainHash()
+	if s.chains[string(hash)] == "" {
+		return nil, status.Errorf(codes.Internal, "broken chain %s", hash)
+	}
+	return &proto.ChainInfoPacket{Hash: hash, Metadata: &proto.Metadata{ChainHash: hash, BeaconID: s.chains[string(hash)]}}, nil
+}
+
+func TestFetchChainsConcurrently(t *testing.T) {
+	pc := &chainsClient{chains: make(map[string]string)}
+	for i := 0; i < 3*chainInfoWorkers; i++ {
+		pc.chains[fmt.Sprintf("chain-%02d", i)] = fmt.Sprintf("id-%02d", i)
+	}
+	c := &Client{pc: pc, log: slog.Default(), metrics: defaultMetrics}
+
+	chains, err := c.fetchChains(context.Background())
+	require.NoError(t, err)
+	require.Len(t, chains, 3*chainInfoWorkers)
+	require.Greater(t, pc.maxSeen.Load(), int32(1), "expected concurrent ChainInfo calls")
+	require.LessOrEqual(t, pc.maxSeen.Load(), int32(chainInfoWorkers))
+	info, err := c.GetChainInfo(context.Background(), &proto.Metadata{BeaconID: "id-05"})
+	require.NoError(t, err)
+	require.Equal(t, "chain-05", string(info.Hash))
+
+	// all the failing chains are reported
+	pc.chains["broken-1"], pc.chains["broken-2"] = "", ""
+	_, err = c.fetchChains(context.Background())
+	require.ErrorContains(t, err, "broken-1")
+	require.ErrorContains(t, err, "broken-2")
+}
@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+)
+
+// HedgeDelay is the default delay of the Clients after which a GetBeacon call still waiting for its backend is also
+// sent to the next one, see WithHedging, the first answer being used and the other call canceled. It reduces the tail
+// latency when the preferred backend is slow but not dead. Hedging is disabled when it is 0.
+var HedgeDelay time.Duration
+
+// Hedges is counting the hedged calls, per method and per call that answered first
+var Hedges = defaultMetrics.hedges
+
+// hedgeCtxKey is used to make the picker avoid the backend node the hedged call was sent to, which is its value.
+type hedgeCtxKey struct{}
+
+// publicRand calls PublicRand, hedging it if the Client has a hedge delay. The picked node records the backend of the
+// call that answered, or of the primary one if both failed.
+func (c *Client) publicRand(ctx context.Context, in *proto.PublicRandRequest, node *pickedNode) (*proto.PublicRandResponse, error) {
+	if c.hedgeDelay <= 0 {
+		return c.pc.PublicRand(ctx, in)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp   *proto.PublicRandResponse
+		err    error
+		hedged bool
+	}
+	results := make(chan result, 2)
+	go func() {
+		resp, err := c.pc.PublicRand(ctx, in)
+		results <- result{resp, err, false}
+	}()
+
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+	pending, hedged := 1, false
+	var primaryErr error
+	for {
+		select {
+		case <-timer.C:
+			pending, hedged = pending+1, true
+			hctx, hnode := withPickedNode(context.WithValue(ctx, hedgeCtxKey{}, node.String()))
+			go func() {
+				resp, err := c.pc.PublicRand(hctx, in)
+				if err == nil {
+					node.addr.Store(hnode.String())
+				}
+				results <- result{resp, err, true}
+			}()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if hedged {
+					winner := "primary"
+					if res.hedged {
+						winner = "hedge"
+					}
+					c.metrics.hedges.WithLabelValues(proto.Public_PublicRand_FullMethodName, winner).Inc()
+				}
+				return res.resp, nil
+			}
+			if !res.hedged {
+				primaryErr = res.err
+			}
+			// a failure before the hedge delay is handled by the usual retry instead
+			if !hedged || pending == 0 {
+				if primaryErr == nil {
+					primaryErr = res.err
+				}
+				return nil, primaryErr
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// slowServer is a MockServer taking its time to answer the PublicRand calls.
+type slowServer struct {
+	*MockServer
+	delay time.Duration
+}
+
+func (s *slowServer) PublicRand(ctx context.Context, in *proto.PublicRandRequest) (*proto.PublicRandResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.MockServer.PublicRand(ctx, in)
+}
+
+func serveMock(t *testing.T, srv proto.PublicServer) string {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	proto.RegisterPublicServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestHedgedGetBeacon(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	slow := serveMock(t, &slowServer{MockServer: m, delay: 5 * time.Second})
+	fast := serveMock(t, m)
+
+	c, err := NewClient("fallback:///"+slow+"|10,"+fast+"|1", slog.Default(), WithHedging(50*time.Millisecond))
+	require.NoError(t, err)
+	defer c.Close()
+
+	hedges := testutil.ToFloat64(Hedges.WithLabelValues(proto.Public_PublicRand_FullMethodName, "hedge"))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	beacon, err := c.GetBeacon(ctx, m.metadata(), 5)
+	require.NoError(t, err, "expected the hedged call to answer before the slow backend")
+	require.Equal(t, uint64(5), beacon.Round)
+	require.Equal(t, hedges+1, testutil.ToFloat64(Hedges.WithLabelValues(proto.Public_PublicRand_FullMethodName, "hedge")))
+}
@@ -1,8 +1,11 @@
 package grpc
 
 import (
+	"encoding/json"
+
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
 )
 
 type loggingBalancerBuilder struct {
@@ -28,6 +31,14 @@ func (b *loggingBalancerBuilder) Name() string {
 	return "logging_" + b.sub
 }
 
+// ParseConfig hands the balancer config over to the underlying balancer, if it supports it.
+func (b *loggingBalancerBuilder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	if p, ok := balancer.Get(b.sub).(balancer.ConfigParser); ok {
+		return p.ParseConfig(js)
+	}
+	return nil, nil
+}
+
 type loggingBalancer struct {
 	sub balancer.Balancer
 	log logger
@@ -2,140 +2,156 @@ package grpc
 
 import (
 	"context"
-	"log/slog"
-	"net"
+	"errors"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/channelz/grpc_channelz_v1"
-	"google.golang.org/grpc/channelz/service"
-	"google.golang.org/grpc/credentials/insecure"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	// ClientMetrics about the drand client requests to servers
-	ClientMetrics = prometheus.NewRegistry()
-
-	grpcServerCallsFailedTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "grpc_server_calls_failed_total",
-		Help: "The total number of gRPC server failed calls.",
-	}, []string{"target"})
-
-	grpcServerCallsStartedTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "grpc_server_calls_started_total",
-		Help: "The total number of gRPC server calls started.",
-	}, []string{"target"})
-
-	grpcServerLastCallStartedSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "grpc_server_last_call_started_seconds",
-		Help: "The timestamp of the last gRPC call started.",
-	}, []string{"target"})
-
-	grpcServerCurrentState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "grpc_server_current_state",
-		Help: "Current state of the gRPC server's subchannel. 0: UNKNOWN; 1: IDLE; 2: CONNECTING; 3: READY; 4: TRANSIENT_FAILURE; 5: SHUTDOWN",
-	}, []string{"target"})
-)
-
-type LocalMetricClient struct {
-	grpc_channelz_v1.ChannelzClient
-	addr string
+// ClientMetrics about the drand client requests to servers, unless the Clients are given another registry using
+// WithRegistry.
+var ClientMetrics = prometheus.NewRegistry()
+
+// clientMetrics are the collectors a Client records its metrics into. The Clients using the same registry share them,
+// the ones of ClientMetrics being the package variables such as BackendLatency.
+type clientMetrics struct {
+	backendLatency     *prometheus.HistogramVec
+	backendErrors      *prometheus.CounterVec
+	retries            *prometheus.CounterVec
+	canaryCalls        *prometheus.CounterVec
+	hedges             *prometheus.CounterVec
+	spills             *prometheus.CounterVec
+	watchStreams       *prometheus.GaugeVec
+	watchReconnects    *prometheus.CounterVec
+	chainInfoChanges   *prometheus.CounterVec
+	invalidBeacons     *prometheus.CounterVec
+	backendUp          *prometheus.GaugeVec
+	subConnReady       *prometheus.GaugeVec
+	backendLatestRound *prometheus.GaugeVec
 }
 
-func (l *LocalMetricClient) getAddr() string {
-	return l.addr
+// defaultMetrics are the collectors registered on ClientMetrics, also used by the balancers and probers of the
+// connections not created by NewClient.
+var defaultMetrics = newClientMetrics()
+
+// newClientMetrics returns new collectors for the metrics of the package, not registered anywhere yet.
+func newClientMetrics() *clientMetrics {
+	return &clientMetrics{
+		backendLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_client_backend_latency_seconds",
+			Help:    "Histogram of the latency of the unary calls done per backend node",
+			Buckets: []float64{.002, .007, .02, .05, .125, .5, 1, 2, 5, 10, 25},
+		}, []string{"node", "method"}),
+		backendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_backend_errors_total",
+			Help: "The total number of failed calls per backend node",
+		}, []string{"node", "method"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_retries_total",
+			Help: "The total number of calls retried on the next backend, per method and per backend node that failed them",
+		}, []string{"method", "node"}),
+		canaryCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_canary_calls_total",
+			Help: "The total number of calls sent to each canary backend node for its share of the traffic, per method and result",
+		}, []string{"method", "node", "result"}),
+		hedges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_hedged_calls_total",
+			Help: "The total number of calls also sent to the next backend after the hedge delay, per method and winner, i.e. primary or hedge",
+		}, []string{"method", "winner"}),
+		spills: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_spilled_calls_total",
+			Help: "The total number of calls sent to the next backend because the preferred one reached --grpc-max-inflight, per saturated backend node",
+		}, []string{"method", "node"}),
+		watchStreams: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_client_watch_streams",
+			Help: "The number of PublicRandStream streams currently established with the backends, per chain",
+		}, []string{"chain"}),
+		watchReconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_watch_reconnects_total",
+			Help: "The total number of attempts to re-establish a failed PublicRandStream stream, per chain",
+		}, []string{"chain"}),
+		chainInfoChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_client_chain_info_changes_total",
+			Help: "The total number of changes of the cached chain infos found when revalidating them with the backends, per beacon ID",
+		}, []string{"chain"}),
+		invalidBeacons: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_invalid_beacons_total",
+			Help: "Number of beacons received from the backends whose signature failed verification.",
+		}, []string{"chain"}),
+		backendUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "drand_backend_up",
+			Help: "Whether the backend node is healthy (1) or not (0), as seen by the active prober",
+		}, []string{"node"}),
+		subConnReady: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "drand_backend_subconn_ready",
+			Help: "Whether the connection to each resolved address of the backend node is ready (1) or not (0), as seen by the balancer",
+		}, []string{"node", "addr"}),
+		backendLatestRound: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "drand_backend_latest_round",
+			Help: "The latest round of the chain served by the backend node, as seen by the active prober",
+		}, []string{"node", "chain"}),
+	}
 }
 
-func bindMetrics() error {
-	// grpc metrics
-	g := []prometheus.Collector{
-		grpcServerCallsFailedTotal,
-		grpcServerCallsStartedTotal,
-		grpcServerLastCallStartedSeconds,
-		grpcServerCurrentState,
-	}
-	for _, c := range g {
-		if err := ClientMetrics.Register(c); err != nil {
-			return err
-		}
+// bindMetrics returns the collectors of the metrics of the package registered on the provided registerer, which are
+// the ones it already holds, if any, so that the Clients using different registries don't share their metrics.
+func bindMetrics(reg prometheus.Registerer) (*clientMetrics, error) {
+	m := newClientMetrics()
+	if reg == ClientMetrics {
+		*m = *defaultMetrics
 	}
-	return nil
+	err := errors.Join(
+		register(reg, &m.backendLatency),
+		register(reg, &m.backendErrors),
+		register(reg, &m.retries),
+		register(reg, &m.canaryCalls),
+		register(reg, &m.hedges),
+		register(reg, &m.spills),
+		register(reg, &m.watchStreams),
+		register(reg, &m.watchReconnects),
+		register(reg, &m.chainInfoChanges),
+		register(reg, &m.invalidBeacons),
+		register(reg, &m.backendUp),
+		register(reg, &m.subConnReady),
+		register(reg, &m.backendLatestRound),
+	)
+	return m, err
 }
 
-// CreateChannelzMonitor creates a localhost channelz server and a `metricClient` for it.
-func CreateChannelzMonitor() (*LocalMetricClient, error) {
-	// Channelz monitoring works by having a local GRPC server responding to Channelz queries using GRPC.
-	metricServer := grpc.NewServer()
-	service.RegisterChannelzServiceToServer(metricServer)
-	//	If the port in the address parameter is empty or "0", as in
-	// "127.0.0.1:" or "[::1]:0", a port number is automatically chosen
-	lis, err := net.Listen("tcp", "localhost:0")
-	if err != nil {
-		slog.Error("failed to listen on grpc metrics", "err", err)
-		return nil, err
-	}
+// register registers *c on reg using Register, replacing it with the equivalent collector already registered, if any.
+func register[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	var err error
+	*c, err = Register(reg, *c)
+	return err
+}
 
-	go func() {
-		if err := metricServer.Serve(lis); err != nil {
-			slog.Error("error serving grpc metrics", "err", err)
+// Register registers c on reg, returning the equivalent collector already registered on reg, if any, instead of
+// failing. This allows several Clients, or several relays embedded in the same program, to share a registry.
+func Register[T prometheus.Collector](reg prometheus.Registerer, c T) (T, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing, nil
 		}
-	}()
-
-	// create our global metric client
-	cc, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		slog.Error("Error building channelz client, shutting down server now", "err", err)
-		metricServer.GracefulStop()
-		return nil, err
 	}
-	return &LocalMetricClient{
-		grpc_channelz_v1.NewChannelzClient(cc),
-		lis.Addr().String(),
-	}, nil
+	return c, err
 }
 
-func UpdateMetrics(metricClient *LocalMetricClient) string {
-	// we need to get all root channels
-	resp, err := metricClient.GetTopChannels(context.Background(), &grpc_channelz_v1.GetTopChannelsRequest{})
-	if err != nil {
-		slog.Error("Error GetTopChannels", "err", err)
-		return "Error GetTopChannels"
+// TraceExemplar returns the trace ID of the span found in the provided context as exemplar labels, so that the slow
+// buckets of our histograms link to their trace. It returns nil when the context isn't traced.
+func TraceExemplar(ctx context.Context) prometheus.Labels {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return prometheus.Labels{"trace_id": sc.TraceID().String()}
 	}
+	return nil
+}
 
-	ret := make([]*grpc_channelz_v1.GetSubchannelResponse, 0)
-	for _, respCh := range resp.GetChannel() {
-		for _, sc := range respCh.GetSubchannelRef() {
-			subr, err := metricClient.GetSubchannel(context.Background(), &grpc_channelz_v1.GetSubchannelRequest{SubchannelId: sc.GetSubchannelId()})
-			if err != nil {
-				slog.Error("Error GetChannel", "err", err)
-				return "Error GetChannel"
-			}
-			ret = append(ret, subr)
-
-			target := subr.GetSubchannel().GetData().GetTarget()
-			if target == metricClient.getAddr() {
-				// we don't need metrics about our local metric server and metric client
-				continue
-			}
-
-			grpcServerCallsFailedTotal.With(prometheus.Labels{
-				"target": target,
-			}).Set(float64(subr.GetSubchannel().GetData().GetCallsFailed()))
-
-			grpcServerCallsStartedTotal.With(prometheus.Labels{
-				"target": target,
-			}).Set(float64(subr.GetSubchannel().GetData().GetCallsStarted()))
-
-			grpcServerLastCallStartedSeconds.With(prometheus.Labels{
-				"target": target,
-			}).Set(float64(subr.GetSubchannel().GetData().GetLastCallStartedTimestamp().GetSeconds()))
-
-			currentState := subr.GetSubchannel().GetData().GetState()
-			grpcServerCurrentState.With(prometheus.Labels{
-				"target": target,
-			}).Set(float64(currentState.GetState()))
-		}
+// observeWithExemplar records v in the provided histogram along with the trace ID of ctx as exemplar, if any.
+func observeWithExemplar(ctx context.Context, h prometheus.Observer, v float64) {
+	if e, ok := h.(prometheus.ExemplarObserver); ok {
+		e.ObserveWithExemplar(v, TraceExemplar(ctx))
+		return
 	}
-
-	return ToJSON(ret)
+	h.Observe(v)
 }
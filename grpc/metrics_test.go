@@ -0,0 +1,79 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRegistry(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	addr := serveMock(t, m)
+
+	// both clients share the registry of the program embedding them
+	reg := prometheus.NewRegistry()
+	for i := 0; i < 2; i++ {
+		c, err := NewClient("fallback:///"+addr, slog.Default(), WithRegistry(reg))
+		require.NoError(t, err)
+		defer c.Close()
+		_, err = c.GetBeacon(context.Background(), m.metadata(), 5)
+		require.NoError(t, err)
+	}
+
+	count, err := testutil.GatherAndCount(reg, "grpc_client_backend_latency_seconds")
+	require.NoError(t, err)
+	require.NotZero(t, count, "expected the package metrics on the provided registry")
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var handled float64
+	for _, f := range families {
+		if f.GetName() == "grpc_client_handled_total" {
+			for _, metric := range f.GetMetric() {
+				handled += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	require.GreaterOrEqual(t, handled, float64(2), "expected the calls of both clients")
+}
+
+func TestRegister(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+	second := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+
+	c, err := Register(reg, first)
+	require.NoError(t, err)
+	require.Same(t, first, c)
+	c, err = Register(reg, second)
+	require.NoError(t, err)
+	require.Same(t, first, c, "expected the collector already registered")
+
+	_, err = Register(reg, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_total", Help: "other"}))
+	require.Error(t, err)
+}
+
+func TestBindMetrics(t *testing.T) {
+	m, err := bindMetrics(ClientMetrics)
+	require.NoError(t, err)
+	require.Same(t, Hedges, m.hedges, "expected the package metrics on ClientMetrics")
+
+	// the Clients using the same registry share their metrics, but not with the ones using another registry
+	reg := prometheus.NewRegistry()
+	first, err := bindMetrics(reg)
+	require.NoError(t, err)
+	second, err := bindMetrics(reg)
+	require.NoError(t, err)
+	require.Same(t, first.hedges, second.hedges)
+	require.NotSame(t, Hedges, first.hedges)
+
+	first.hedges.WithLabelValues("method", "hedge").Inc()
+	require.Equal(t, 1.0, testutil.ToFloat64(second.hedges.WithLabelValues("method", "hedge")))
+	require.Zero(t, testutil.ToFloat64(Hedges.WithLabelValues("method", "hedge")))
+}
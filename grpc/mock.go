@@ -0,0 +1,196 @@
+package grpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/kyber"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// mockSecret is the private key of the mock chain, so that its beacons are deterministic.
+const mockSecret = 0xd7a4d
+
+// MockServer is a fake drand node serving a single unchained chain with the default beacon ID, producing
+// deterministic beacons with valid signatures. It is meant for tests and local development only.
+type MockServer struct {
+	proto.UnimplementedPublicServer
+
+	scheme  *crypto.Scheme
+	priv    kyber.Scalar
+	info    *proto.ChainInfoPacket
+	genesis time.Time
+	period  time.Duration
+}
+
+// NewMockServer returns a MockServer whose chain starts at the provided genesis time, emitting a beacon every period.
+func NewMockServer(genesis time.Time, period time.Duration) (*MockServer, error) {
+	scheme, err := crypto.SchemeFromName(crypto.UnchainedSchemeID)
+	if err != nil {
+		return nil, err
+	}
+	priv := scheme.KeyGroup.Scalar().SetInt64(mockSecret)
+	pubKey := scheme.KeyGroup.Point().Mul(priv, nil)
+	pub, err := pubKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MockServer{
+		scheme:  scheme,
+		priv:    priv,
+		genesis: genesis.Truncate(time.Second),
+		period:  period.Truncate(time.Second),
+	}
+	if m.period <= 0 {
+		return nil, fmt.Errorf("mock period must be at least 1s")
+	}
+
+	// the chain hash is computed by drand itself, so that the mock chain info verifies like a real one
+	seed := sha256.Sum256([]byte("drand-http-relay mock chain"))
+	info := &chain.Info{
+		PublicKey:   pubKey,
+		ID:          common.DefaultBeaconID,
+		Period:      m.period,
+		Scheme:      scheme.Name,
+		GenesisTime: m.genesis.Unix(),
+		GenesisSeed: seed[:],
+	}
+	hash := info.Hash()
+
+	m.info = &proto.ChainInfoPacket{
+		PublicKey:   pub,
+		Period:      uint32(m.period.Seconds()),
+		GenesisTime: m.genesis.Unix(),
+		Hash:        hash,
+		GroupHash:   info.GenesisSeed,
+		SchemeID:    scheme.Name,
+		Metadata:    &proto.Metadata{BeaconID: common.DefaultBeaconID, ChainHash: hash},
+	}
+	return m, nil
+}
+
+// StartMockBackend serves a MockServer, along with the grpc health service, on the provided address, which can be
+// localhost:0 to pick a free port. It returns the grpc server to Stop it and the address it listens on.
+func StartMockBackend(addr string, genesis time.Time, period time.Duration) (*grpc.Server, string, error) {
+	m, err := NewMockServer(genesis, period)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	srv := grpc.NewServer()
+	proto.RegisterPublicServer(srv, m)
+	healthgrpc.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+
+	return srv, lis.Addr().String(), nil
+}
+
+// ChainHash returns the hash of the mock chain.
+func (m *MockServer) ChainHash() []byte {
+	return m.info.GetHash()
+}
+
+func (m *MockServer) metadata() *proto.Metadata {
+	return &proto.Metadata{BeaconID: "default", ChainHash: m.ChainHash()}
+}
+
+// current returns the latest round emitted by the mock chain.
+func (m *MockServer) current() uint64 {
+	if time.Now().Before(m.genesis) {
+		return 0
+	}
+	return uint64(time.Since(m.genesis)/m.period) + 1
+}
+
+// beacon returns the deterministic beacon of the provided round.
+func (m *MockServer) beacon(round uint64) (*proto.PublicRandResponse, error) {
+	b := &HexBeacon{Round: round}
+	sig, err := m.scheme.AuthScheme.Sign(m.priv, m.scheme.DigestBeacon(b))
+	if err != nil {
+		return nil, err
+	}
+	return &proto.PublicRandResponse{
+		Round:     round,
+		Signature: sig,
+		Metadata:  m.metadata(),
+	}, nil
+}
+
+func (m *MockServer) checkChain(md *proto.Metadata) error {
+	if hash := md.GetChainHash(); len(hash) > 0 && string(hash) != string(m.ChainHash()) {
+		return status.Error(codes.InvalidArgument, "unknown chain hash")
+	}
+	if id := md.GetBeaconID(); id != "" && id != "default" {
+		return status.Error(codes.InvalidArgument, "unknown beacon ID")
+	}
+	return nil
+}
+
+func (m *MockServer) PublicRand(_ context.Context, in *proto.PublicRandRequest) (*proto.PublicRandResponse, error) {
+	if err := m.checkChain(in.GetMetadata()); err != nil {
+		return nil, err
+	}
+
+	current := m.current()
+	round := in.GetRound()
+	if round == 0 {
+		round = current
+	}
+	if round == 0 || round > current {
+		return nil, status.Errorf(codes.NotFound, "round %d not available yet, current round is %d", round, current)
+	}
+	return m.beacon(round)
+}
+
+func (m *MockServer) PublicRandStream(in *proto.PublicRandRequest, stream proto.Public_PublicRandStreamServer) error {
+	if err := m.checkChain(in.GetMetadata()); err != nil {
+		return err
+	}
+
+	last := m.current()
+	for {
+		next := m.genesis.Add(time.Duration(last) * m.period)
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-time.After(time.Until(next)):
+		}
+
+		last++
+		b, err := m.beacon(last)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(b); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *MockServer) ChainInfo(_ context.Context, in *proto.ChainInfoRequest) (*proto.ChainInfoPacket, error) {
+	if err := m.checkChain(in.GetMetadata()); err != nil {
+		return nil, err
+	}
+	return m.info, nil
+}
+
+func (m *MockServer) ListBeaconIDs(context.Context, *proto.ListBeaconIDsRequest) (*proto.ListBeaconIDsResponse, error) {
+	return &proto.ListBeaconIDsResponse{Ids: []string{"default"}, Metadatas: []*proto.Metadata{m.metadata()}}, nil
+}
@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockServerBeacons(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	info := NewInfoV2(m.info)
+
+	resp, err := m.beacon(5)
+	require.NoError(t, err)
+	require.NoError(t, info.Verify(NewHexBeacon(resp)))
+
+	again, err := m.beacon(5)
+	require.NoError(t, err)
+	require.Equal(t, resp.GetSignature(), again.GetSignature(), "beacons must be deterministic")
+
+	_, next := info.ExpectedNext()
+	require.Equal(t, next-1, m.current())
+}
+
+func TestMockServerChainHash(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+
+	// drand derives the same chain hash from the served chain info
+	scheme, err := crypto.SchemeFromName(m.info.GetSchemeID())
+	require.NoError(t, err)
+	pub := scheme.KeyGroup.Point()
+	require.NoError(t, pub.UnmarshalBinary(m.info.GetPublicKey()))
+	info := &chain.Info{
+		PublicKey:   pub,
+		ID:          m.info.GetMetadata().GetBeaconID(),
+		Period:      time.Duration(m.info.GetPeriod()) * time.Second,
+		Scheme:      m.info.GetSchemeID(),
+		GenesisTime: m.info.GetGenesisTime(),
+		GenesisSeed: m.info.GetGroupHash(),
+	}
+	require.Equal(t, info.Hash(), m.ChainHash())
+	require.Equal(t, m.ChainHash(), m.info.GetMetadata().GetChainHash())
+}
@@ -0,0 +1,202 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	// BackendUp is set to 1 when a backend node is healthy and 0 otherwise, as seen by the prober
+	BackendUp = defaultMetrics.backendUp
+
+	// BackendLatestRound is the latest round of each chain served by a backend node, as seen by the prober
+	BackendLatestRound = defaultMetrics.backendLatestRound
+)
+
+// prober periodically checks all the backends of a Client using dedicated connections, so that the fallback balancer
+// knows about the state of the backends it is not currently using. The backends to probe are set by the resolver that
+// owns it, every time it resolves them.
+type prober struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	// health holds the outcome of the last probe of each backend address
+	health   sync.Map
+	interval time.Duration
+	timeout  time.Duration
+	log      logger
+	dialOpts []grpc.DialOption
+	metrics  *clientMetrics
+	stop     chan struct{}
+}
+
+// newProber returns a prober recording its results in the provided collectors, or in the default ones if nil.
+func newProber(interval, timeout time.Duration, l logger, m *clientMetrics, dialOpts ...grpc.DialOption) *prober {
+	if m == nil {
+		m = defaultMetrics
+	}
+	return &prober{
+		conns:    make(map[string]*grpc.ClientConn),
+		interval: interval,
+		timeout:  timeout,
+		log:      l,
+		dialOpts: dialOpts,
+		metrics:  m,
+		stop:     make(chan struct{}),
+	}
+}
+
+// update sets the backends to probe, dialing the new ones and dropping the ones that are gone.
+func (p *prober) update(backends []Backend) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keep := make(map[string]bool, len(backends))
+	for _, b := range backends {
+		keep[b.Addr] = true
+		if _, ok := p.conns[b.Addr]; ok {
+			continue
+		}
+		creds := insecure.NewCredentials()
+		if b.TLS {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+		conn, err := grpc.NewClient("passthrough:///"+b.Addr, append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, p.dialOpts...)...)
+		if err != nil {
+			return err
+		}
+		p.conns[b.Addr] = conn
+	}
+
+	for addr, conn := range p.conns {
+		if keep[addr] {
+			continue
+		}
+		conn.Close()
+		delete(p.conns, addr)
+		p.health.Delete(addr)
+		p.metrics.backendUp.DeleteLabelValues(addr)
+		p.metrics.backendLatestRound.DeletePartialMatch(prometheus.Labels{"node": addr})
+	}
+	return nil
+}
+
+func (p *prober) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.probeAll()
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *prober) probeAll() {
+	p.mu.Lock()
+	conns := maps.Clone(p.conns)
+	p.mu.Unlock()
+
+	for addr, conn := range conns {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		rounds, err := p.probe(ctx, conn)
+		cancel()
+
+		healthy := err == nil
+		if was := p.healthy(addr); was != healthy {
+			p.log.Warn("backend health changed", "addr", addr, "healthy", healthy, "err", err)
+		}
+		p.health.Store(addr, healthy)
+
+		if healthy {
+			p.metrics.backendUp.WithLabelValues(addr).Set(1)
+		} else {
+			p.metrics.backendUp.WithLabelValues(addr).Set(0)
+		}
+		for chain, round := range rounds {
+			p.metrics.backendLatestRound.WithLabelValues(addr, chain).Set(float64(round))
+		}
+	}
+}
+
+// healthy returns whether the last probe of the provided backend address succeeded. Addresses that were never probed,
+// or all of them without prober, are considered healthy.
+func (p *prober) healthy(addr string) bool {
+	if p == nil {
+		return true
+	}
+	healthy, ok := p.health.Load(addr)
+	if !ok {
+		return true
+	}
+	return healthy.(bool)
+}
+
+// probe checks that the backend is serving and that it isn't stuck on an old round, on any of its chains. It returns
+// the latest round of the chains it got, by hex-encoded chainhash.
+func (p *prober) probe(ctx context.Context, conn *grpc.ClientConn) (map[string]uint64, error) {
+	resp, err := healthgrpc.NewHealthClient(conn).Check(ctx, &healthgrpc.HealthCheckRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.GetStatus() != healthgrpc.HealthCheckResponse_SERVING {
+		return nil, fmt.Errorf("grpc health: not serving")
+	}
+
+	pc := proto.NewPublicClient(conn)
+	ids, err := pc.ListBeaconIDs(ctx, &proto.ListBeaconIDsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids.GetMetadatas()) == 0 {
+		return nil, fmt.Errorf("backend serves no beacon")
+	}
+
+	rounds := make(map[string]uint64, len(ids.GetMetadatas()))
+	for _, m := range ids.GetMetadatas() {
+		info, err := pc.ChainInfo(ctx, &proto.ChainInfoRequest{Metadata: m})
+		if err != nil {
+			return rounds, err
+		}
+
+		latest, err := pc.PublicRand(ctx, &proto.PublicRandRequest{Metadata: m})
+		if err != nil {
+			return rounds, err
+		}
+		chain := NewInfoV2(info)
+		rounds[chain.Hash.String()] = latest.GetRound()
+
+		_, next := chain.ExpectedNext()
+		if latest.GetRound()+2 < next {
+			return rounds, fmt.Errorf("backend is stuck at round %d of %s, expected %d", latest.GetRound(), m.GetBeaconID(), next-1)
+		}
+	}
+
+	return rounds, nil
+}
+
+func (p *prober) Close() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for addr, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, addr)
+	}
+}
@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProberGauges(t *testing.T) {
+	genesis := time.Now().Add(-time.Hour)
+	mock, addr, err := StartMockBackend("localhost:0", genesis, 3*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(mock.Stop)
+
+	// nothing listens on that port once the listener is closed
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	down := lis.Addr().String()
+	lis.Close()
+
+	p := newProber(time.Minute, time.Second, slog.Default(), nil)
+	t.Cleanup(p.Close)
+	require.NoError(t, p.update([]Backend{{Addr: addr}, {Addr: down}}))
+	p.probeAll()
+
+	require.True(t, p.healthy(addr))
+	require.False(t, p.healthy(down))
+	require.Equal(t, 1.0, testutil.ToFloat64(BackendUp.WithLabelValues(addr)))
+	require.Equal(t, 0.0, testutil.ToFloat64(BackendUp.WithLabelValues(down)))
+
+	m, err := NewMockServer(genesis, 3*time.Second)
+	require.NoError(t, err)
+	round := testutil.ToFloat64(BackendLatestRound.WithLabelValues(addr, hex.EncodeToString(m.ChainHash())))
+	require.InDelta(t, float64(m.current()), round, 1)
+
+	// the backends that are gone aren't probed nor reported anymore
+	require.NoError(t, p.update([]Backend{{Addr: addr}}))
+	require.Len(t, p.conns, 1)
+	require.True(t, p.healthy(down))
+	require.False(t, BackendUp.DeleteLabelValues(down), "the gauge of a removed backend must be gone")
+}
@@ -0,0 +1,152 @@
+package grpc
+
+import (
+	"context"
+	"net/netip"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Proxy implements the drand Public grpc service by relaying the calls to the Backends, so that grpc clients also
+// benefit from the fallback and caching mechanisms of the relay.
+type Proxy struct {
+	proto.UnimplementedPublicServer
+	b *Backends
+}
+
+// ProxyOption customizes the proxy server returned by NewProxyServer.
+type ProxyOption func(*proxyConfig)
+
+type proxyConfig struct {
+	allowPeer func(netip.Addr) bool
+}
+
+// WithPeerFilter rejects the calls of the peers whose address isn't allowed with a PermissionDenied status.
+func WithPeerFilter(allowed func(netip.Addr) bool) ProxyOption {
+	return func(cfg *proxyConfig) {
+		cfg.allowPeer = allowed
+	}
+}
+
+// NewProxyServer returns a grpc server serving the drand Public service as well as the grpc health service using the
+// provided Backends, restricted to their allowed chains. It is up to the caller to Serve it on a listener. The server
+// doesn't authenticate nor rate limit its clients, see WithPeerFilter to restrict who can use it.
+func NewProxyServer(b *Backends, opts ...ProxyOption) *grpc.Server {
+	cfg := &proxyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var srvOpts []grpc.ServerOption
+	if cfg.allowPeer != nil {
+		srvOpts = append(srvOpts,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if !peerAllowed(ctx, cfg.allowPeer) {
+					return nil, status.Error(codes.PermissionDenied, "forbidden")
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if !peerAllowed(ss.Context(), cfg.allowPeer) {
+					return status.Error(codes.PermissionDenied, "forbidden")
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	srv := grpc.NewServer(srvOpts...)
+	proto.RegisterPublicServer(srv, &Proxy{b: b})
+	healthgrpc.RegisterHealthServer(srv, health.NewServer())
+	return srv
+}
+
+// peerAllowed returns whether the address of the peer of the call is allowed, the peers without an IP address never
+// are.
+func peerAllowed(ctx context.Context, allowed func(netip.Addr) bool) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return false
+	}
+	addr, err := netip.ParseAddrPort(p.Addr.String())
+	if err != nil {
+		return false
+	}
+	return allowed(addr.Addr().Unmap())
+}
+
+// errNotServed is returned for the chains the Backends aren't allowed to serve, as if they didn't exist.
+var errNotServed = status.Error(codes.NotFound, "unknown chain")
+
+func (p *Proxy) PublicRand(ctx context.Context, in *proto.PublicRandRequest) (*proto.PublicRandResponse, error) {
+	if !p.b.Allowed(ctx, in.GetMetadata()) {
+		return nil, errNotServed
+	}
+	beacon, err := p.b.GetBeacon(ctx, in.GetMetadata(), in.GetRound())
+	if err != nil {
+		return nil, err
+	}
+	return beacon.toProto(in.GetMetadata()), nil
+}
+
+func (p *Proxy) PublicRandStream(in *proto.PublicRandRequest, stream proto.Public_PublicRandStreamServer) error {
+	if !p.b.Allowed(stream.Context(), in.GetMetadata()) {
+		return errNotServed
+	}
+	for beacon := range p.b.Watch(stream.Context(), in.GetMetadata()) {
+		if err := stream.Send(beacon.toProto(in.GetMetadata())); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	// the watch only ends before the client is gone when the backends failed to provide the beacons
+	return status.Error(codes.Unavailable, "unable to watch the beacons of the backends")
+}
+
+func (p *Proxy) ChainInfo(ctx context.Context, in *proto.ChainInfoRequest) (*proto.ChainInfoPacket, error) {
+	if !p.b.Allowed(ctx, in.GetMetadata()) {
+		return nil, errNotServed
+	}
+	info, err := p.b.GetChainInfo(ctx, in.GetMetadata())
+	if err != nil {
+		return nil, err
+	}
+	return info.toProto(), nil
+}
+
+func (p *Proxy) ListBeaconIDs(ctx context.Context, _ *proto.ListBeaconIDsRequest) (*proto.ListBeaconIDsResponse, error) {
+	ids, metadatas, err := p.b.GetBeaconIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ListBeaconIDsResponse{Ids: ids, Metadatas: metadatas}, nil
+}
+
+func (h *HexBeacon) toProto(m *proto.Metadata) *proto.PublicRandResponse {
+	return &proto.PublicRandResponse{
+		Round:             h.Round,
+		Signature:         h.Signature,
+		PreviousSignature: h.PreviousSignature,
+		Randomness:        h.Randomness,
+		Metadata:          m,
+	}
+}
+
+func (j *JsonInfoV2) toProto() *proto.ChainInfoPacket {
+	return &proto.ChainInfoPacket{
+		PublicKey:   j.PublicKey,
+		Period:      j.Period,
+		GenesisTime: j.GenesisTime,
+		Hash:        j.Hash,
+		GroupHash:   j.GenesisSeed,
+		SchemeID:    j.Scheme,
+		Metadata:    &proto.Metadata{BeaconID: j.BeaconId, ChainHash: j.Hash},
+	}
+}
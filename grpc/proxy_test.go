@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRandStream is the server side of a PublicRandStream call, it records the beacons sent to the client.
+type fakeRandStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*proto.PublicRandResponse
+}
+
+func (s *fakeRandStream) Context() context.Context { return s.ctx }
+
+func (s *fakeRandStream) Send(r *proto.PublicRandResponse) error {
+	s.sent = append(s.sent, r)
+	return nil
+}
+
+func TestProxyStreamUnavailableBackend(t *testing.T) {
+	// nothing listens there, so the watch of the backend fails
+	c, _ := NewClient("localhost:1", slog.Default())
+	b := NewBackends(c, slog.Default())
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := &fakeRandStream{ctx: ctx}
+	err := (&Proxy{b: b}).PublicRandStream(&proto.PublicRandRequest{Metadata: &proto.Metadata{BeaconID: "default"}}, stream)
+	require.Equal(t, codes.Unavailable, status.Code(err), err)
+	require.Empty(t, stream.sent)
+
+	// the client going away isn't reported as an unavailable backend
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = (&Proxy{b: b}).PublicRandStream(&proto.PublicRandRequest{}, &fakeRandStream{ctx: canceled})
+	require.Equal(t, codes.Canceled, status.Code(err), err)
+}
+
+func TestProxyAllowedChains(t *testing.T) {
+	mock, addr, err := StartMockBackend("localhost:0", time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	defer mock.Stop()
+	c, err := NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	b := NewBackends(c, slog.Default())
+	defer b.Close()
+	p := &Proxy{b: b}
+	m := &proto.Metadata{BeaconID: "default"}
+
+	_, err = p.ChainInfo(context.Background(), &proto.ChainInfoRequest{Metadata: m})
+	require.NoError(t, err)
+
+	b.Allow("quicknet")
+	_, err = p.ChainInfo(context.Background(), &proto.ChainInfoRequest{Metadata: m})
+	require.Equal(t, codes.NotFound, status.Code(err), err)
+	_, err = p.PublicRand(context.Background(), &proto.PublicRandRequest{Metadata: m})
+	require.Equal(t, codes.NotFound, status.Code(err), err)
+	err = p.PublicRandStream(&proto.PublicRandRequest{Metadata: m}, &fakeRandStream{ctx: context.Background()})
+	require.Equal(t, codes.NotFound, status.Code(err), err)
+
+	b.Allow("default")
+	_, err = p.PublicRand(context.Background(), &proto.PublicRandRequest{Metadata: m})
+	require.NoError(t, err)
+}
+
+func TestProxyPeerFilter(t *testing.T) {
+	c, _ := NewClient("localhost:1", slog.Default())
+	b := NewBackends(c, slog.Default())
+	defer b.Close()
+
+	var seen atomic.Value
+	srv := NewProxyServer(b, WithPeerFilter(func(addr netip.Addr) bool {
+		seen.Store(addr)
+		return false
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewPublicClient(conn)
+
+	_, err = client.ChainInfo(context.Background(), &proto.ChainInfoRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err), err)
+	require.Equal(t, netip.MustParseAddr("127.0.0.1"), seen.Load())
+	stream, err := client.PublicRandStream(context.Background(), &proto.PublicRandRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err), err)
+}
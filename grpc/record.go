@@ -0,0 +1,243 @@
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// recordedCall is a backend response, recorded as a json line along with the call it answers. The messages are
+// binary protobuf encoded, the request deterministically so that it can be matched when replaying.
+type recordedCall struct {
+	// At is the time elapsed since the recording started
+	At       time.Duration `json:"at"`
+	Method   string        `json:"method"`
+	Request  []byte        `json:"request"`
+	Response []byte        `json:"response,omitempty"`
+	Code     codes.Code    `json:"code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// recorder writes all the backend responses received by a Client, to be replayed later using StartReplayBackend.
+type recorder struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	start time.Time
+}
+
+// WithRecording records all the backend responses to the provided writer, as json lines.
+func WithRecording(w io.Writer) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.recorder = &recorder{enc: json.NewEncoder(w), start: time.Now()}
+	}
+}
+
+func (r *recorder) record(method string, req, resp any, err error) {
+	call := recordedCall{At: time.Since(r.start), Method: method}
+	if m, ok := req.(protobuf.Message); ok {
+		call.Request, _ = protobuf.MarshalOptions{Deterministic: true}.Marshal(m)
+	}
+	if err != nil {
+		s := status.Convert(err)
+		call.Code, call.Error = s.Code(), s.Message()
+	} else if m, ok := resp.(protobuf.Message); ok {
+		call.Response, _ = protobuf.Marshal(m)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(&call)
+}
+
+// UnaryInterceptor records the responses of the unary calls.
+func (r *recorder) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		r.record(method, req, reply, err)
+		return err
+	}
+}
+
+// StreamInterceptor records the messages received on streams, along with the request that opened them.
+func (r *recorder) StreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &recordedStream{ClientStream: s, recorder: r, method: method}, nil
+	}
+}
+
+type recordedStream struct {
+	grpc.ClientStream
+	recorder *recorder
+	method   string
+	req      any
+}
+
+func (s *recordedStream) SendMsg(m any) error {
+	s.req = m
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *recordedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if !errors.Is(err, io.EOF) && status.Code(err) != codes.Canceled {
+		s.recorder.record(s.method, s.req, m, err)
+	}
+	return err
+}
+
+// ReplayServer is a fake drand node answering with the responses of a recording, following their original timing: a
+// call gets the latest response recorded for the same request at that point of the replay.
+type ReplayServer struct {
+	proto.UnimplementedPublicServer
+
+	calls []recordedCall
+	start time.Time
+}
+
+// NewReplayServer loads a recording done using WithRecording, the replay starts right away.
+func NewReplayServer(r io.Reader) (*ReplayServer, error) {
+	s := &ReplayServer{start: time.Now()}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var call recordedCall
+		if err := json.Unmarshal(scanner.Bytes(), &call); err != nil {
+			return nil, err
+		}
+		s.calls = append(s.calls, call)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.calls) == 0 {
+		return nil, errors.New("empty recording")
+	}
+	return s, nil
+}
+
+// StartReplayBackend serves a ReplayServer of the provided recording, along with the grpc health service, on the
+// provided address. It returns the grpc server to Stop it and the address it listens on.
+func StartReplayBackend(addr string, recording io.Reader) (*grpc.Server, string, error) {
+	s, err := NewReplayServer(recording)
+	if err != nil {
+		return nil, "", err
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	srv := grpc.NewServer()
+	proto.RegisterPublicServer(srv, s)
+	healthgrpc.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+
+	return srv, lis.Addr().String(), nil
+}
+
+func (s *ReplayServer) matches(call *recordedCall, method string, req []byte) bool {
+	return call.Method == method && bytes.Equal(call.Request, req)
+}
+
+// unary answers a unary call with the latest matching response at this point of the replay, or the first one if
+// none was recorded yet.
+func (s *ReplayServer) unary(method string, in, out protobuf.Message) error {
+	req, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	elapsed := time.Since(s.start)
+	var found *recordedCall
+	for i := range s.calls {
+		call := &s.calls[i]
+		if !s.matches(call, method, req) {
+			continue
+		}
+		if found == nil || call.At <= elapsed {
+			found = call
+		}
+		if call.At > elapsed {
+			break
+		}
+	}
+
+	if found == nil {
+		return status.Errorf(codes.NotFound, "replay: no %s call recorded for this request", method)
+	}
+	if found.Error != "" {
+		return status.Error(found.Code, found.Error)
+	}
+	return protobuf.Unmarshal(found.Response, out)
+}
+
+func (s *ReplayServer) PublicRand(_ context.Context, in *proto.PublicRandRequest) (*proto.PublicRandResponse, error) {
+	out := &proto.PublicRandResponse{}
+	return out, s.unary(proto.Public_PublicRand_FullMethodName, in, out)
+}
+
+func (s *ReplayServer) ChainInfo(_ context.Context, in *proto.ChainInfoRequest) (*proto.ChainInfoPacket, error) {
+	out := &proto.ChainInfoPacket{}
+	return out, s.unary(proto.Public_ChainInfo_FullMethodName, in, out)
+}
+
+func (s *ReplayServer) ListBeaconIDs(_ context.Context, in *proto.ListBeaconIDsRequest) (*proto.ListBeaconIDsResponse, error) {
+	out := &proto.ListBeaconIDsResponse{}
+	return out, s.unary(proto.Public_ListBeaconIDs_FullMethodName, in, out)
+}
+
+// PublicRandStream sends the recorded stream messages for the same request at their original time, skipping the ones
+// that are already in the past.
+func (s *ReplayServer) PublicRandStream(in *proto.PublicRandRequest, stream proto.Public_PublicRandStreamServer) error {
+	req, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	for i := range s.calls {
+		call := &s.calls[i]
+		if !s.matches(call, proto.Public_PublicRandStream_FullMethodName, req) || call.At < time.Since(s.start) {
+			continue
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-time.After(time.Until(s.start.Add(call.At))):
+		}
+
+		if call.Error != "" {
+			return status.Error(call.Code, call.Error)
+		}
+		out := &proto.PublicRandResponse{}
+		if err := protobuf.Unmarshal(call.Response, out); err != nil {
+			return err
+		}
+		if err := stream.Send(out); err != nil {
+			return err
+		}
+	}
+
+	// the recording is over, we keep the stream open like a node would
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	mock, addr, err := StartMockBackend("localhost:0", time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	defer mock.Stop()
+
+	var recording bytes.Buffer
+	rec := &recorder{enc: json.NewEncoder(&recording), start: time.Now()}
+	conn, err := grpc.NewClient("passthrough:///"+addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(rec.UnaryInterceptor()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	pc := proto.NewPublicClient(conn)
+	ids, err := pc.ListBeaconIDs(ctx, &proto.ListBeaconIDsRequest{})
+	require.NoError(t, err)
+	first, err := pc.PublicRand(ctx, &proto.PublicRandRequest{Round: 1, Metadata: ids.GetMetadatas()[0]})
+	require.NoError(t, err)
+	_, err = pc.PublicRand(ctx, &proto.PublicRandRequest{Round: 1 << 40, Metadata: ids.GetMetadatas()[0]})
+	require.Error(t, err)
+
+	replay, err := NewReplayServer(&recording)
+	require.NoError(t, err)
+
+	replayedIDs, err := replay.ListBeaconIDs(ctx, &proto.ListBeaconIDsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, ids.GetIds(), replayedIDs.GetIds())
+
+	replayed, err := replay.PublicRand(ctx, &proto.PublicRandRequest{Round: 1, Metadata: ids.GetMetadatas()[0]})
+	require.NoError(t, err)
+	require.Equal(t, first.GetSignature(), replayed.GetSignature())
+
+	_, err = replay.PublicRand(ctx, &proto.PublicRandRequest{Round: 1 << 40, Metadata: ids.GetMetadatas()[0]})
+	require.Equal(t, codes.NotFound, status.Code(err), "recorded errors must be replayed")
+
+	_, err = replay.PublicRand(ctx, &proto.PublicRandRequest{Round: 2, Metadata: ids.GetMetadatas()[0]})
+	require.Equal(t, codes.NotFound, status.Code(err), "unrecorded calls must fail")
+}
@@ -0,0 +1,98 @@
+package grpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"google.golang.org/grpc/codes"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// RetryPolicy is the default grpc retry policy of the PublicRand and health Check calls of the Clients, in the JSON
+// format of the grpc service config, see WithRetryPolicy. The fallback balancer deprioritizing the backend that failed
+// a call, its retries go to the next one. Retries are disabled when it is empty. The hedging policy of grpc isn't
+// supported since its attempts would all go to the preferred backend, the hedging is done using WithHedging instead.
+var RetryPolicy = `{"maxAttempts":2,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE","UNKNOWN","INTERNAL","RESOURCE_EXHAUSTED","ABORTED"]}`
+
+// maxRetryAttempts is the maximum number of attempts grpc allows in a retry policy, larger values being lowered to it.
+const maxRetryAttempts = 5
+
+// retryPolicy is the grpc retry policy, as provided in RetryPolicy or WithRetryPolicy.
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// ValidateRetryPolicy returns an error if the provided retry policy would be rejected by grpc, an empty one being
+// valid since it disables the retries.
+func ValidateRetryPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	var p retryPolicy
+	if err := json.Unmarshal([]byte(policy), &p); err != nil {
+		return fmt.Errorf("it must be a JSON object: %w", err)
+	}
+	if p.MaxAttempts < 2 {
+		return errors.New("maxAttempts must be at least 2")
+	}
+	for name, backoff := range map[string]string{"initialBackoff": p.InitialBackoff, "maxBackoff": p.MaxBackoff} {
+		// grpc only accepts the durations in seconds, e.g. "0.1s"
+		if s, err := strconv.ParseFloat(strings.TrimSuffix(backoff, "s"), 64); err != nil || s <= 0 || !strings.HasSuffix(backoff, "s") {
+			return fmt.Errorf("%s must be a positive duration in seconds, such as \"0.1s\", got %q", name, backoff)
+		}
+	}
+	if p.BackoffMultiplier <= 0 {
+		return errors.New("backoffMultiplier must be positive")
+	}
+	if len(p.RetryableStatusCodes) == 0 {
+		return errors.New("retryableStatusCodes can't be empty")
+	}
+	for _, name := range p.RetryableStatusCodes {
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return fmt.Errorf("unknown status code %q in retryableStatusCodes", name)
+		}
+	}
+	return nil
+}
+
+// retryAttempts returns the maximum number of attempts of the calls according to the provided retry policy, which is 1
+// when the retries are disabled.
+func retryAttempts(policy string) int {
+	var p retryPolicy
+	if policy == "" || json.Unmarshal([]byte(policy), &p) != nil {
+		return 1
+	}
+	return min(max(p.MaxAttempts, 1), maxRetryAttempts)
+}
+
+// retryThrottling is the retry budget of the grpc clients: once too many calls fail, they stop being retried until
+// enough calls succeed again, so that we don't overload the backends that are struggling.
+const retryThrottling = `{"maxTokens":10,"tokenRatio":0.1}`
+
+// serviceConfig returns the default grpc service config of a client, with our fallback balancer configured by lb and
+// the provided retry policy.
+func serviceConfig(policy string, lb *LBConfig) string {
+	lbConfig, _ := json.Marshal([]map[string]*LBConfig{{"logging_" + fallbackName: lb}})
+	if policy == "" {
+		return fmt.Sprintf(`{"loadBalancingConfig":%s}`, lbConfig)
+	}
+	return fmt.Sprintf(`{"loadBalancingConfig":%s,"methodConfig":[{"name":[%s,%s],"retryPolicy":%s}],"retryThrottling":%s}`,
+		lbConfig,
+		methodName(proto.Public_ServiceDesc.ServiceName, "PublicRand"),
+		methodName(healthgrpc.Health_ServiceDesc.ServiceName, "Check"),
+		policy, retryThrottling)
+}
+
+func methodName(service, method string) string {
+	name, _ := json.Marshal(map[string]string{"service": service, "method": method})
+	return string(name)
+}
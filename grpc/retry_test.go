@@ -0,0 +1,65 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingServer is a MockServer failing all the PublicRand calls.
+type failingServer struct {
+	*MockServer
+}
+
+func (s *failingServer) PublicRand(context.Context, *proto.PublicRandRequest) (*proto.PublicRandResponse, error) {
+	return nil, status.Error(codes.Unavailable, "failing")
+}
+
+func TestRetryPolicy(t *testing.T) {
+	m, err := NewMockServer(time.Now().Add(-time.Minute), 3*time.Second)
+	require.NoError(t, err)
+	failing := serveMock(t, &failingServer{m})
+	working := serveMock(t, m)
+
+	c, err := NewClient("fallback:///"+failing+"|10,"+working+"|1", slog.Default())
+	require.NoError(t, err)
+	defer c.Close()
+
+	retries := testutil.ToFloat64(Retries.WithLabelValues(proto.Public_PublicRand_FullMethodName, failing))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	beacon, err := c.GetBeacon(ctx, m.metadata(), 5)
+	require.NoError(t, err, "expected the call to be retried on the working backend")
+	require.Equal(t, uint64(5), beacon.Round)
+	require.Equal(t, retries+1, testutil.ToFloat64(Retries.WithLabelValues(proto.Public_PublicRand_FullMethodName, failing)))
+
+	require.JSONEq(t, `{"loadBalancingConfig":[{"logging_pick_first_with_fallback":{"latencyAware":true,"maxInflight":4}}]}`,
+		serviceConfig("", &LBConfig{LatencyAware: true, MaxInflight: 4}))
+}
+
+func TestValidateRetryPolicy(t *testing.T) {
+	require.NoError(t, ValidateRetryPolicy(RetryPolicy))
+	require.NoError(t, ValidateRetryPolicy(""), "an empty policy disables the retries")
+	for _, policy := range []string{
+		`not json`,
+		`{"maxAttempts":1,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}`,
+		`{"maxAttempts":3,"initialBackoff":"10ms","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}`,
+		`{"maxAttempts":3,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":0,"retryableStatusCodes":["UNAVAILABLE"]}`,
+		`{"maxAttempts":3,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":[]}`,
+		`{"maxAttempts":3,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE","GONE"]}`,
+	} {
+		require.Error(t, ValidateRetryPolicy(policy), policy)
+	}
+
+	require.Equal(t, 2, retryAttempts(RetryPolicy))
+	policy := `{"maxAttempts":10,"initialBackoff":"0.01s","maxBackoff":"0.1s","backoffMultiplier":2,"retryableStatusCodes":["UNAVAILABLE"]}`
+	require.Equal(t, maxRetryAttempts, retryAttempts(policy), "grpc caps the attempts")
+	require.Equal(t, 1, retryAttempts(""))
+}
@@ -0,0 +1,122 @@
+package grpc
+
+import (
+	"fmt"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	bls "github.com/drand/kyber-bls12381"
+	"github.com/drand/kyber/pairing/bn254"
+)
+
+// JsonScheme describes the cryptography of a chain, so that clients can verify its beacons without hardcoding the
+// details of each drand scheme.
+type JsonScheme struct {
+	Name          string `json:"name"`
+	Curve         string `json:"curve"`
+	KeyGroup      string `json:"key_group"`
+	KeySize       int    `json:"key_size"`
+	SigGroup      string `json:"signature_group"`
+	SigSize       int    `json:"signature_size"`
+	DST           string `json:"dst"`
+	Chained       bool   `json:"chained"`
+	Message       string `json:"message"`
+	Randomness    string `json:"randomness"`
+	RFC9380       bool   `json:"rfc9380_compliant"`
+	Deprecated    bool   `json:"deprecated,omitempty"`
+	DeprecatedWhy string `json:"deprecated_reason,omitempty"`
+}
+
+// knownDSTs are the hash to curve domain separation tags used by the drand schemes. The one of a scheme is found by
+// matching its hash to curve, since the drand crypto package doesn't expose it.
+var knownDSTs = []string{
+	"BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_NUL_",
+	"BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_",
+	"BLS_SIG_BN254G1_XMD:KECCAK-256_SSWU_RO_NUL_",
+}
+
+// schemeDetails are the parts of the schemes that aren't exposed by the drand crypto package, as set in its scheme
+// constructors.
+var schemeDetails = map[string]JsonScheme{
+	crypto.DefaultSchemeID: {
+		Curve: "BLS12-381", KeyGroup: "G1", SigGroup: "G2", Chained: true, RFC9380: true,
+		Message: "sha256(previous_signature || round as big-endian uint64)",
+	},
+	crypto.UnchainedSchemeID: {
+		Curve: "BLS12-381", KeyGroup: "G1", SigGroup: "G2", RFC9380: true,
+		Message: "sha256(round as big-endian uint64)",
+	},
+	crypto.ShortSigSchemeID: {
+		Curve: "BLS12-381", KeyGroup: "G2", SigGroup: "G1",
+		Message:       "sha256(round as big-endian uint64)",
+		Deprecated:    true,
+		DeprecatedWhy: "hashes to G1 using the G2 DST, use " + crypto.SigsOnG1ID + " instead",
+	},
+	crypto.SigsOnG1ID: {
+		Curve: "BLS12-381", KeyGroup: "G2", SigGroup: "G1", RFC9380: true,
+		Message: "sha256(round as big-endian uint64)",
+	},
+	crypto.BN254UnchainedOnG1SchemeID: {
+		Curve: "BN254", KeyGroup: "G2", SigGroup: "G1", RFC9380: true,
+		Message: "keccak256(round as big-endian uint64)",
+	},
+}
+
+// SchemeDetails returns the cryptographic details of the scheme with the provided name.
+func SchemeDetails(name string) (*JsonScheme, error) {
+	scheme, err := crypto.SchemeFromName(name)
+	if err != nil {
+		return nil, err
+	}
+	details, ok := schemeDetails[name]
+	if !ok {
+		return nil, fmt.Errorf("no details known for scheme %q", name)
+	}
+
+	details.DST, err = schemeDST(scheme, details.Curve, details.SigGroup)
+	if err != nil {
+		return nil, err
+	}
+	details.Name = scheme.Name
+	details.KeySize = scheme.KeyGroup.PointLen()
+	details.SigSize = scheme.SigGroup.PointLen()
+	details.Randomness = "sha256(signature)"
+	return &details, nil
+}
+
+// schemeDST returns the DST the scheme uses to hash its messages to its signature group, that is the known DST with
+// which hashing a message to the same curve and group gives the same point as the scheme does.
+func schemeDST(scheme *crypto.Scheme, curve, group string) (string, error) {
+	msg := []byte("drand-http-relay scheme DST")
+	hp, ok := scheme.SigGroup.Point().(kyber.HashablePoint)
+	if !ok {
+		return "", fmt.Errorf("scheme %q can't hash to its signature group", scheme.Name)
+	}
+	expected := hp.Hash(msg)
+
+	for _, dst := range knownDSTs {
+		g, err := sigGroup(curve, group, []byte(dst))
+		if err != nil {
+			return "", err
+		}
+		if p, ok := g.Point().(kyber.HashablePoint); ok && p.Hash(msg).Equal(expected) {
+			return dst, nil
+		}
+	}
+	return "", fmt.Errorf("unknown DST for scheme %q", scheme.Name)
+}
+
+// sigGroup returns the provided group of the provided curve, hashing to it using the provided DST.
+func sigGroup(curve, group string, dst []byte) (kyber.Group, error) {
+	switch {
+	case curve == "BLS12-381" && group == "G1":
+		return bls.NewBLS12381SuiteWithDST(dst, nil).G1(), nil
+	case curve == "BLS12-381" && group == "G2":
+		return bls.NewBLS12381SuiteWithDST(nil, dst).G2(), nil
+	case curve == "BN254" && group == "G1":
+		suite := bn254.NewSuite()
+		suite.SetDomainG1(dst)
+		return suite.G1(), nil
+	}
+	return nil, fmt.Errorf("unsupported signature group %s of %s", group, curve)
+}
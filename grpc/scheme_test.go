@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemeDetails(t *testing.T) {
+	for _, name := range crypto.ListSchemes() {
+		details, err := SchemeDetails(name)
+		require.NoError(t, err, name)
+		require.Equal(t, name, details.Name)
+		require.NotEmpty(t, details.DST)
+		require.NotZero(t, details.KeySize)
+		require.NotZero(t, details.SigSize)
+	}
+
+	details, err := SchemeDetails(crypto.SigsOnG1ID)
+	require.NoError(t, err)
+	require.Equal(t, 96, details.KeySize)
+	require.Equal(t, 48, details.SigSize)
+	require.False(t, details.Chained)
+
+	_, err = SchemeDetails("unknown")
+	require.Error(t, err)
+}
+
+func TestSchemeDST(t *testing.T) {
+	expected := map[string]string{
+		crypto.DefaultSchemeID:            "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_",
+		crypto.UnchainedSchemeID:          "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_",
+		crypto.ShortSigSchemeID:           "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_",
+		crypto.SigsOnG1ID:                 "BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_NUL_",
+		crypto.BN254UnchainedOnG1SchemeID: "BLS_SIG_BN254G1_XMD:KECCAK-256_SSWU_RO_NUL_",
+	}
+	for name, dst := range expected {
+		details, err := SchemeDetails(name)
+		require.NoError(t, err, name)
+		require.Equal(t, dst, details.DST, name)
+
+		// the scheme hashes to its signature group using the served DST
+		scheme, err := crypto.SchemeFromName(name)
+		require.NoError(t, err)
+		g, err := sigGroup(details.Curve, details.SigGroup, []byte(details.DST))
+		require.NoError(t, err)
+		msg := []byte("round 42")
+		require.True(t, g.Point().(kyber.HashablePoint).Hash(msg).Equal(scheme.SigGroup.Point().(kyber.HashablePoint).Hash(msg)), name)
+	}
+}
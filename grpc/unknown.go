@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnknownChainTTL is how long the Clients remember that the backends don't know a chain by default, see
+// WithUnknownChainTTL, to avoid asking them again about the same bad chainhash or beacon ID, while still letting newly
+// added chains appear after it. Disabled when set to 0.
+var UnknownChainTTL = 10 * time.Second
+
+// isUnknownChain checks whether the error returned by a backend means it doesn't know the requested chain.
+func isUnknownChain(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.InvalidArgument {
+		return false
+	}
+	return strings.Contains(s.Message(), "unknown chain hash") || strings.Contains(s.Message(), "unknown beacon ID")
+}
+
+// unknownChains caches the errors returned by the backends for the chains they don't know, for its ttl.
+type unknownChains struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]unknownChain
+}
+
+type unknownChain struct {
+	err    error
+	expiry time.Time
+}
+
+// get returns the error cached for the chain designated by key, if any and if it hasn't expired yet.
+func (u *unknownChains) get(key string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	e, ok := u.entries[key]
+	if !ok {
+		return nil
+	}
+	if !clock().Before(e.expiry) {
+		delete(u.entries, key)
+		return nil
+	}
+	return e.err
+}
+
+// add caches the error returned for the chain designated by key, dropping the expired entries along the way so that
+// probing random chains doesn't grow the cache indefinitely.
+func (u *unknownChains) add(key string, err error) {
+	if u.ttl <= 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := clock()
+	if u.entries == nil {
+		u.entries = make(map[string]unknownChain)
+	}
+	for k, e := range u.entries {
+		if !now.Before(e.expiry) {
+			delete(u.entries, k)
+		}
+	}
+	u.entries[key] = unknownChain{err: err, expiry: now.Add(u.ttl)}
+}
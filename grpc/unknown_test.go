@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnknownChains(t *testing.T) {
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	unknown := status.Error(codes.InvalidArgument, "unknown chain hash")
+	require.True(t, isUnknownChain(unknown))
+	require.False(t, isUnknownChain(status.Error(codes.Unavailable, "unknown chain hash")))
+	require.False(t, isUnknownChain(errors.New("unknown chain hash")))
+
+	u := unknownChains{ttl: UnknownChainTTL}
+	require.NoError(t, u.get("abcd"))
+	u.add("abcd", unknown)
+	require.Equal(t, unknown, u.get("abcd"))
+
+	// the newly added chains are found once the TTL expired
+	now = now.Add(UnknownChainTTL)
+	require.NoError(t, u.get("abcd"))
+
+	// the expired entries are dropped when adding new ones
+	u.add("abcd", unknown)
+	now = now.Add(UnknownChainTTL)
+	u.add("ef01", unknown)
+	require.Len(t, u.entries, 1)
+}
@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+)
+
+// VerifyBeacons makes the Clients check the signature of the beacons they get against the public key of their chain by
+// default, see WithVerification, retrying with the next backend when it is invalid.
+var VerifyBeacons bool
+
+// ErrInvalidSignature is returned when a beacon signature doesn't verify against the public key of its chain.
+var ErrInvalidSignature = errors.New("invalid beacon signature")
+
+// InvalidBeacons (grpc) how many beacons failed signature verification, indicating a tampering or corrupted backend
+var InvalidBeacons = defaultMetrics.invalidBeacons
+
+// verifier holds the scheme and the unmarshaled public key of a chain, to avoid decoding them for every beacon.
+type verifier struct {
+	scheme *crypto.Scheme
+	pub    kyber.Point
+}
+
+// verifiers caches the verifier of each chain, by hex-encoded chainhash.
+var verifiers sync.Map
+
+func (info *JsonInfoV2) verifier() (*verifier, error) {
+	if v, ok := verifiers.Load(info.Hash.String()); ok {
+		return v.(*verifier), nil
+	}
+
+	scheme, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	pub := scheme.KeyGroup.Point()
+	if err := pub.UnmarshalBinary(info.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid chain public key: %w", err)
+	}
+
+	v := &verifier{scheme: scheme, pub: pub}
+	verifiers.Store(info.Hash.String(), v)
+	return v, nil
+}
+
+// Verify checks the signature of the beacon against the public key of the chain.
+func (info *JsonInfoV2) Verify(beacon *HexBeacon) error {
+	v, err := info.verifier()
+	if err != nil {
+		return err
+	}
+	if err := v.scheme.VerifyBeacon(beacon, v.pub); err != nil {
+		return fmt.Errorf("%w for round %d: %w", ErrInvalidSignature, beacon.Round, err)
+	}
+	return nil
+}
+
+// verifyBeacon verifies the beacon if the Client verifies them, recording the failures in the InvalidBeacons metric.
+func (c *Client) verifyBeacon(info *JsonInfoV2, beacon *HexBeacon) error {
+	if !c.verify {
+		return nil
+	}
+	if err := info.Verify(beacon); err != nil {
+		c.metrics.invalidBeacons.WithLabelValues(info.Hash.String()).Inc()
+		c.log.Error("received an invalid beacon", "round", beacon.Round, "chain", info.Hash, "err", err)
+		return err
+	}
+	return nil
+}
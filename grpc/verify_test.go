@@ -0,0 +1,99 @@
+package grpc
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// verifyFixtures returns the chain info of a pedersen-bls-chained chain along with one of its beacons.
+func verifyFixtures(t *testing.T) (*JsonInfoV2, *HexBeacon) {
+	pub, err := hex.DecodeString("868f005eb8e6e4ca0a47c8a77ceaa5309a47978a7c71bc5cce96366b5d7a569937c529eeda66c7293784a9402801af31")
+	require.NoError(t, err)
+	sig, err := hex.DecodeString("814778ed1e480406beb43b74af71ce2f0373e0ea1bfdfea8f9ed62c876c20fcbc7f0163860e3da42ed2148756015f4551451898ffe06d384b4d002245025571b6b7a752f7158b40ad92b13b6d703ad31922a617f2c7f6d960b84d56cf1d79eef")
+	require.NoError(t, err)
+	prev, err := hex.DecodeString("8bd96294383b4d1e04e736360bd7a487f9f409f1e7bd800b720656a310d577b3bdb1e1631af6c5782a1d8979c502f395036181eff4058960fc40bb7034cdae1991d3eda518ab204a077d2f7e724974cf87b407e549bd815cf0b8e5a3832f675d")
+	require.NoError(t, err)
+
+	info := &JsonInfoV2{
+		PublicKey: pub,
+		Hash:      []byte("test-verify-chain"),
+		Scheme:    "pedersen-bls-chained",
+	}
+	return info, &HexBeacon{Round: 2634945, Signature: sig, PreviousSignature: prev}
+}
+
+func TestVerify(t *testing.T) {
+	info, beacon := verifyFixtures(t)
+	require.NoError(t, info.Verify(beacon))
+
+	tampered := &HexBeacon{Round: beacon.Round + 1, Signature: beacon.Signature, PreviousSignature: beacon.PreviousSignature}
+	require.ErrorIs(t, info.Verify(tampered), ErrInvalidSignature)
+}
+
+// streamingClient is a PublicClient serving a fixed chain info and streaming fixed beacons.
+type streamingClient struct {
+	proto.PublicClient
+	info    *proto.ChainInfoPacket
+	beacons []*proto.PublicRandResponse
+}
+
+func (s *streamingClient) ChainInfo(context.Context, *proto.ChainInfoRequest, ...grpc.CallOption) (*proto.ChainInfoPacket, error) {
+	return s.info, nil
+}
+
+func (s *streamingClient) PublicRandStream(ctx context.Context, _ *proto.PublicRandRequest, _ ...grpc.CallOption) (proto.Public_PublicRandStreamClient, error) {
+	return &fixedStream{ctx: ctx, beacons: s.beacons}, nil
+}
+
+type fixedStream struct {
+	grpc.ClientStream
+	ctx     context.Context
+	beacons []*proto.PublicRandResponse
+}
+
+func (s *fixedStream) Context() context.Context { return s.ctx }
+
+func (s *fixedStream) Recv() (*proto.PublicRandResponse, error) {
+	if len(s.beacons) == 0 {
+		return nil, io.EOF
+	}
+	next := s.beacons[0]
+	s.beacons = s.beacons[1:]
+	return next, nil
+}
+
+func TestWatchDropsInvalidBeacons(t *testing.T) {
+	info, beacon := verifyFixtures(t)
+	valid := &proto.PublicRandResponse{Round: beacon.Round, Signature: beacon.Signature, PreviousSignature: beacon.PreviousSignature}
+	tampered := &proto.PublicRandResponse{Round: beacon.Round + 1, Signature: beacon.Signature, PreviousSignature: beacon.PreviousSignature}
+	c := &Client{
+		pc: &streamingClient{
+			info:    &proto.ChainInfoPacket{PublicKey: info.PublicKey, SchemeID: info.Scheme, Metadata: &proto.Metadata{ChainHash: info.Hash}},
+			beacons: []*proto.PublicRandResponse{valid, tampered, valid},
+		},
+		log:     slog.Default(),
+		verify:  true,
+		metrics: defaultMetrics,
+	}
+	invalid := testutil.ToFloat64(InvalidBeacons.WithLabelValues(info.Hash.String()))
+	defer func(backoff time.Duration, attempts int) { WatchBackoff, WatchAttempts = backoff, attempts }(WatchBackoff, WatchAttempts)
+	WatchBackoff, WatchAttempts = time.Millisecond, 2
+
+	var rounds []uint64
+	for b := range c.Watch(context.Background(), &proto.Metadata{ChainHash: info.Hash}) {
+		rounds = append(rounds, b.Round)
+	}
+	// each stream is dropped at the invalid beacon, without delivering it or the ones after it, and the streams
+	// re-established after it don't deliver the same round again
+	require.Equal(t, []uint64{beacon.Round}, rounds)
+	require.Equal(t, invalid+2, testutil.ToFloat64(InvalidBeacons.WithLabelValues(info.Hash.String())))
+}
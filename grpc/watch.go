@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+)
+
+// WatchBackoff is the delay before re-establishing a failed watch stream, it is doubled after each consecutive failure
+// up to WatchMaxBackoff.
+var WatchBackoff = 100 * time.Millisecond
+
+// WatchMaxBackoff is the maximum delay between two attempts to re-establish a failed watch stream.
+var WatchMaxBackoff = 10 * time.Second
+
+// WatchAttempts is the number of consecutive attempts to establish a watch stream failing without delivering any beacon
+// after which Watch gives up.
+var WatchAttempts = 5
+
+// WatchStreams is the number of watch streams currently established per chain
+var WatchStreams = defaultMetrics.watchStreams
+
+// WatchReconnects is counting the attempts to re-establish a failed watch stream per chain
+var WatchReconnects = defaultMetrics.watchReconnects
+
+// watchStream delivers on ch the beacons of a single PublicRandStream stream until it fails, starting after the last
+// round delivered, which it keeps up to date. The stream goes to the next backend if skip is set, after a failure. It
+// returns whether it delivered any beacon along with the error that ended the stream.
+func (c *Client) watchStream(ctx context.Context, m *proto.Metadata, last *uint64, ch chan<- *HexBeacon, skip bool) (delivered bool, err error) {
+	var info *JsonInfoV2
+	if c.verify {
+		if info, err = c.GetChainInfo(ctx, m); err != nil {
+			return false, fmt.Errorf("unable to get chain info to verify the watched beacons: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sctx := withChain(ctx, m)
+	if skip {
+		sctx = context.WithValue(sctx, SkipCtxKey{}, true)
+	}
+	// the round 0 follows the chain from its latest beacon
+	var from uint64
+	if *last > 0 {
+		from = *last + 1
+	}
+	stream, err := c.pc.PublicRandStream(sctx, &proto.PublicRandRequest{Round: from, Metadata: m})
+	if err != nil {
+		return false, err
+	}
+
+	chain := chainKey(m)
+	c.metrics.watchStreams.WithLabelValues(chain).Inc()
+	defer c.metrics.watchStreams.WithLabelValues(chain).Dec()
+	scheme := c.scheme(ctx, m)
+	for {
+		next, err := stream.Recv()
+		if err != nil {
+			return delivered, err
+		}
+		if next.GetRound() <= *last {
+			// it was already delivered using a previous stream
+			continue
+		}
+		beacon := NewHexBeacon(next)
+		beacon.ApplyScheme(scheme)
+		if info != nil {
+			if err := c.verifyBeacon(info, beacon); err != nil {
+				// an invalid beacon ends the stream like any stream error, for the next one to use another backend
+				return delivered, fmt.Errorf("dropping invalid beacon %d: %w", beacon.Round, err)
+			}
+		}
+		select {
+		case ch <- beacon:
+		case <-ctx.Done():
+			return delivered, ctx.Err()
+		}
+		*last, delivered = beacon.Round, true
+	}
+}
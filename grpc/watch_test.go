@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// resumingClient is a PublicClient streaming the rounds from the requested one up to the given last one, recording the
+// rounds requested.
+type resumingClient struct {
+	streamingClient
+	last      uint64
+	requested []uint64
+}
+
+func (s *resumingClient) PublicRandStream(ctx context.Context, in *proto.PublicRandRequest, _ ...grpc.CallOption) (proto.Public_PublicRandStreamClient, error) {
+	s.requested = append(s.requested, in.GetRound())
+	// every stream fails after 2 beacons, the first one starting from the round 1
+	from := max(in.GetRound(), 1)
+	var beacons []*proto.PublicRandResponse
+	for round := from; round < from+2 && round <= s.last; round++ {
+		beacons = append(beacons, &proto.PublicRandResponse{Round: round})
+	}
+	return &fixedStream{ctx: ctx, beacons: beacons}, nil
+}
+
+func TestWatchReconnects(t *testing.T) {
+	defer func(backoff time.Duration, attempts int) { WatchBackoff, WatchAttempts = backoff, attempts }(WatchBackoff, WatchAttempts)
+	WatchBackoff, WatchAttempts = time.Millisecond, 3
+
+	pc := &resumingClient{streamingClient: streamingClient{info: &proto.ChainInfoPacket{}}, last: 5}
+	c := &Client{pc: pc, log: slog.Default(), metrics: defaultMetrics}
+	reconnects := testutil.ToFloat64(WatchReconnects.WithLabelValues("quicknet"))
+
+	var rounds []uint64
+	for b := range c.Watch(context.Background(), &proto.Metadata{BeaconID: "quicknet"}) {
+		rounds = append(rounds, b.Round)
+	}
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, rounds, "expected the streams to resume after the last round delivered")
+	// the last stream delivering a beacon counts as the first failed attempt
+	require.Equal(t, []uint64{0, 3, 5, 6, 6}, pc.requested)
+	require.Equal(t, reconnects+4, testutil.ToFloat64(WatchReconnects.WithLabelValues("quicknet")))
+	require.Zero(t, testutil.ToFloat64(WatchStreams.WithLabelValues("quicknet")))
+
+	// the channel is closed once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	pc.last = 100
+	ch := c.Watch(ctx, &proto.Metadata{BeaconID: "quicknet"})
+	<-ch
+	cancel()
+	for range ch {
+	}
+}
@@ -15,6 +15,9 @@ import (
 var (
 	version   = "v0.0.1"
 	goVersion = flag.Bool("version", false, "Displays the current server version.")
+	subject   = flag.String("sub", "", "The subject of the JWT, identifying its holder in the per caller rate limits, quotas and audit log of the relay.")
+	rateLimit = flag.Float64("rate-limit", 0, "The rate_limit claim of the JWT, in requests per second, overriding the relay limits for its holder. Not set when 0.")
+	quota     = flag.Uint64("daily-quota", 0, "The daily_quota claim of the JWT, overriding the relay quota for its holder. Not set when 0.")
 	jwtSecret []byte
 )
 
@@ -42,8 +45,19 @@ func main() {
 		log.Fatal("drand http JWT issuer version: ", version)
 	}
 
+	claims := jwt.MapClaims{}
+	if *subject != "" {
+		claims["sub"] = *subject
+	}
+	if *rateLimit > 0 {
+		claims["rate_limit"] = *rateLimit
+	}
+	if *quota > 0 {
+		claims["daily_quota"] = *quota
+	}
+
 	// Create a new token object
-	token := jwt.New(jwt.SigningMethodHS256)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Create a JWT and send it as response
 	tokenString, err := token.SignedString(jwtSecret)
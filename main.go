@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,101 +15,311 @@ import (
 	"time"
 
 	"github.com/drand/http-server/grpc"
+	"github.com/drand/http-server/relay"
 )
 
 var (
-	version     = "drand-http-server-v2.0.1"
 	metricFlag  = flag.String("metrics", "localhost:9999", "The flag to set the interface for metrics. Defaults to localhost:9999")
+	metricsCert = flag.String("metrics-tls-cert", "", "The TLS certificate file to serve the metrics over https, along with --metrics-tls-key. The metrics can be protected using the DRAND_METRICS_TOKEN and DRAND_METRICS_BASIC_AUTH env variables.")
+	metricsKey  = flag.String("metrics-tls-key", "", "The TLS key file to serve the metrics over https, along with --metrics-tls-cert.")
+	chanzTick   = flag.Duration("channelz-interval", grpc.ChannelzInterval, "Collect the channelz data of the grpc backends served on /chanz and as grpc_server_* metrics at this interval, instead of on every scrape. Only collected once at startup when set to 0.")
+	metricsMain = flag.Bool("metrics-on-main", false, "Serve /metrics on the main http listener instead of the --metrics one, it requires the DRAND_METRICS_TOKEN or DRAND_METRICS_BASIC_AUTH env variable to be set.")
 	httpBind    = flag.String("bind", "localhost:8080", "The address to bind the http server to")
-	grpcURL     = flag.String("grpc-connect", "localhost:4444", "The URL and port to your drand node's grpc port, e.g. pl1-rpc.testnet.drand.sh:443 you can add fallback nodes by separating them with a comma: pl1-rpc.testnet.drand.sh:443,pl2-rpc.testnet.drand.sh:443")
+	grpcURL     = flag.String("grpc-connect", "localhost:4444", "The URL and port to your drand node's grpc port, e.g. pl1-rpc.testnet.drand.sh:443 you can add fallback nodes by separating them with a comma: pl1-rpc.testnet.drand.sh:443,pl2-rpc.testnet.drand.sh:443 and give them a priority to prefer some of them: local:4444|10,pl1-rpc.testnet.drand.sh:443|1 along with attributes such as a weight, TLS or a region: pl1-rpc.testnet.drand.sh:443|priority=1|weight=5|tls=true|region=eu-west, or send a canary share of the calls to a new node: new:4444|0|canary=5, or discover them using DNS SRV records: srv:///_drand._tcp.example.com")
 	goVersion   = flag.Bool("version", false, "Displays the current server version.")
-	requireAuth = flag.Bool("enable-auth", false, "Forces JWT authentication on V2 API using the JWT secret from the AUTH_TOKEN env variable.")
+	requireAuth = flag.Bool("enable-auth", false, "Forces JWT authentication on V2 API using the JWT secret from --auth-key-file or the DRAND_AUTH_KEY env variable.")
+	authKeyFile = flag.String("auth-key-file", "", "A file holding the 128 byte hex-encoded JWT secret used by --enable-auth, reloaded on SIGHUP. It takes precedence over the DRAND_AUTH_KEY env variable, which is visible in the process environment.")
+	authMode    = flag.String("auth-mode", "jwt", "The authentication used by --enable-auth, either jwt, apikey to rely on X-API-Key headers using the keys from --api-keys and the DRAND_API_KEYS env variable, or tenant to rely on X-API-Key headers using the keys of the --tenants.")
+	apiKeysFile = flag.String("api-keys", "", "A file holding the API keys allowed when using --auth-mode apikey, one per line in the form name:key or name:key:disabled.")
+	tenantsFile = flag.String("tenants", "", "A file holding the tenants allowed when using --auth-mode tenant, one per line in the form: name key rate quota [chains], where chains is a comma separated list of the chainhashes or beacon IDs the tenant may use, all of them if omitted. Their usage is reported per tenant in the metrics and on /tenants.")
+	tokenRate   = flag.Float64("token-rate", 0, "The default rate limit in requests per second of each authenticated caller, overridden by --token-limits and the rate_limit JWT claim. Unlimited when set to 0.")
+	tokenQuota  = flag.Uint64("token-quota", 0, "The default daily quota of requests of each authenticated caller, overridden by --token-limits and the daily_quota JWT claim. Unlimited when set to 0.")
+	limitsFile  = flag.String("token-limits", "", "A file holding per caller limits, one per line in the form: subject rate quota, where subject is the JWT subject or the API key name.")
+	auditFile   = flag.String("audit-log", "", "Record an audit trail of the authenticated v2 requests and of the admin endpoints requests, with their caller and result, to this file in JSON. The v2 requests are only audited with --enable-auth, disabled if empty.")
+	usageExport = flag.String("usage-export", "", "Export the usage of every caller, identified by its token or IP address, with its requests and errors per route every --usage-interval, either to a JSON lines file, to a CSV file if its name ends with .csv, or to an http(s) endpoint receiving them in JSON using POST requests, authenticated with the DRAND_USAGE_TOKEN env variable as a bearer token if set. Disabled if empty.")
+	usageTick   = flag.Duration("usage-interval", time.Hour, "The interval at which the usage is exported to --usage-export.")
 	verbose     = flag.Bool("verbose", false, "Prints as many logs as possible.")
 	jsonFlag    = flag.Bool("json", false, "Prints logs in JSON format.")
+	logFile     = flag.String("log-file", "", "Write the logs to this file instead of stdout, rotating it according to --log-max-size and --log-rotate-every.")
+	logMaxSize  = flag.Int64("log-max-size", 100, "Rotate the --log-file once it reaches this size in MB. Disabled when set to 0.")
+	logRotate   = flag.Duration("log-rotate-every", 24*time.Hour, "Rotate the --log-file once it is older than this duration. Disabled when set to 0.")
+	logBackups  = flag.Int("log-max-backups", 7, "The number of rotated log files to keep, all of them are kept when set to 0.")
+	logSample   = flag.Uint64("log-sample", 1, "Only log 1 in this many successful requests on the --log-sample-routes, failed requests are always logged. All requests are logged when set to 1.")
+	logSampleAt = flag.String("log-sample-routes", "/public/,/rounds/", "A comma separated list of path fragments identifying the high-volume routes subject to --log-sample.")
+	logSkip     = flag.String("log-skip-paths", "/ping,/health,/metrics", "A comma separated list of paths whose requests are never logged, e.g. health checks.")
+	accessLog   = flag.String("access-log-format", relay.AccessLogDefault, "The format of the request logs, either default for the httplog structure, in JSON with --json, ecs for the Elastic Common Schema in JSON or clf for the Apache Common Log Format.")
+	geoIPDB     = flag.String("geoip-db", "", "The MaxMind GeoIP2 or GeoLite2 Country or City database locating the clients in the request logs and in the http_geo_requests metric, counted per continent. Disabled if empty.")
+	geoCountry  = flag.Bool("geoip-by-country", false, "Count the requests per country rather than per continent in the http_geo_requests metric.")
+	syslogAddr  = flag.String("syslog", "", "Also send the logs to syslog, or journald, either \"local\" or a network address such as udp://host:514. Disabled if empty.")
 	frontrun    = flag.Int64("frontrun", 0, "When waiting for the next round, start the query this amount of ms earlier to counteract network latency.")
+	keepalive   = flag.Duration("grpc-keepalive", 0, "Send a keepalive ping to the grpc backends after this duration without activity, e.g. 30s. Disabled when set to 0.")
+	kaTimeout   = flag.Duration("grpc-keepalive-timeout", 20*time.Second, "How long to wait for a keepalive ping to be acknowledged before closing the connection.")
+	kaNoStream  = flag.Bool("grpc-keepalive-permit-without-stream", false, "Send keepalive pings even when there are no active RPCs on the connection.")
+	maxTimeout  = flag.Duration("max-request-timeout", time.Minute, "The maximum deadline for the backend calls of a request, consumers can ask for a shorter one using the X-Timeout-Ms or Request-Timeout headers.")
+	backendHdr  = flag.Bool("backend-header", false, "Add the X-Drand-Backend header to the responses, with the address of the grpc backend that served the request, to simplify incident triage. It discloses the backend addresses to the consumers.")
+	compress    = flag.Bool("grpc-gzip", false, "Enables gzip compression on the grpc calls to the backends, useful with distant nodes over constrained links.")
+	hedgeDelay  = flag.Duration("grpc-hedge-delay", 0, "Also send the beacon requests still waiting for their grpc backend after this delay to the next backend, using the first answer. Disabled when set to 0.")
+	retryPolicy = flag.String("grpc-retry-policy", grpc.RetryPolicy, "The grpc retry policy, in the JSON format of the grpc service config, of the beacon and health calls, which are retried on the next grpc backend. Disabled if empty.")
+	perBackend  = flag.Int("grpc-max-inflight", 0, "The maximum number of concurrent calls sent to each grpc backend, the excess ones being sent to the next backend instead of queueing on the preferred one. Disabled when set to 0.")
+	latencyLB   = flag.Bool("latency-aware", false, "Prefer the grpc backend with the lowest rolling latency and error rate instead of relying on their order in --grpc-connect only.")
+	probeEvery  = flag.Duration("grpc-probe-interval", 0, "Actively check the health of all grpc backends at this interval, e.g. 5s, instead of only the one in use. Disabled when set to 0.")
+	resolveTick = flag.Duration("grpc-resolve-interval", 5*time.Minute, "Re-resolve the grpc backends host names at this interval to follow IP changes, or sooner when the TTL of the SRV records is shorter. Disabled when set to 0.")
+	unknownTTL  = flag.Duration("unknown-chain-ttl", 10*time.Second, "Remember the chainhashes and beacon IDs the grpc backends don't know for this long, to avoid asking them again about the same bad chain. Disabled when set to 0.")
+	infoRefresh = flag.Duration("chain-info-refresh", grpc.ChainInfoRefresh, "Revalidate the cached chain infos with the grpc backends at this interval, since they can change across reshares, and look for new chains. Disabled when set to 0.")
+	chainsTTL   = flag.Duration("chains-ttl", 30*time.Second, "Serve the cached list of chains available on the grpc backends for this long before refreshing it in the background. The list is fetched on every request when set to 0.")
+	affinity    = flag.Bool("chain-affinity", false, "Pin each chain to the first grpc backend that successfully served it, useful when not every backend follows every chain.")
+	corsMaxAge  = flag.Duration("cors-max-age", 24*time.Hour, "How long the browsers and CDNs may cache the answers to the CORS preflight requests.")
+	hideRoutes  = flag.Bool("hide-routes", false, "Reply to the requests for unknown routes with a plain 404 instead of the list of the served routes, which is still served on the --private-bind listener.")
+	privateBind = flag.String("private-bind", "", "The address to bind a private http server to, e.g. an internal network address, serving all routes along with the metrics. When set, the --bind server only serves the beacon and chain info routes. Disabled if empty.")
+	grpcBind    = flag.String("grpc-bind", "", "The address to bind a grpc server serving the drand Public API through the relay to, e.g. localhost:4445. WARNING: it is NOT authenticated nor rate limited, even with --enable-auth, only --ip-allow and --ip-deny apply to it, so bind it to a private address. Disabled if empty.")
+	chainsList  = flag.String("chains", "", "A comma separated allowlist of chainhashes or beacon IDs to serve, all chains available on the backends are served if empty.")
+	cacheImmut  = flag.String("cache-immutable", relay.CacheImmutable, "The Cache-Control header value of the responses that never change, such as past beacons.")
+	cacheNone   = flag.String("cache-none", relay.CacheNone, "The Cache-Control header value of the responses that must not be cached, such as errors.")
+	cacheInfo   = flag.String("cache-info", relay.CacheInfo, "The Cache-Control header value of the chain info responses.")
+	cacheFudge  = flag.Duration("cache-latest-fudge", 0, "Subtract this duration from the max-age of the latest beacon responses, which otherwise expire right before the relay asks for the next round according to --frontrun, e.g. 1s to account for clock skew.")
+	staleReval  = flag.Duration("stale-while-revalidate", 0, "Add a stale-while-revalidate directive of this duration to the latest beacon and chain info responses, so CDNs keep serving them while revalidating. Disabled when set to 0.")
+	staleOnErr  = flag.Duration("stale-if-error", 0, "Add a stale-if-error directive of this duration to the latest beacon and chain info responses, so CDNs keep serving them during backend hiccups. Disabled when set to 0.")
+	surrogates  = flag.String("surrogate-key-headers", strings.Join(relay.SurrogateKeyHeaders, ","), "A comma separated list of headers in which to set the surrogate keys of the responses, i.e. their chainhash and round, for CDN purging. Disabled if empty.")
+	purgeURL    = flag.String("purge-url", "", "A CDN purge webhook to call when a new round is observed, in which {chainhash} and {round} are replaced, e.g. https://api.fastly.com/service/ID/purge/{chainhash}-latest. Disabled if empty.")
+	upstreamURL = flag.String("upstream", "", "The base URL of a relay, e.g. https://api.drand.sh, from which the historical rounds are read before falling back to the grpc backends. Its beacons are always verified. Disabled if empty.")
+	shadowURL   = flag.String("shadow-url", "", "The base URL of a staging relay to which a share of the GET requests is mirrored, fire-and-forget, comparing its immutable responses to ours to validate it. The request headers aren't forwarded. Disabled if empty.")
+	shadowShare = flag.Float64("shadow-percent", 1, "The percentage of the GET requests mirrored to the --shadow-url relay.")
+	purgeMethod = flag.String("purge-method", http.MethodPost, "The http method used to call the --purge-url webhook.")
+	purgeHeader = flag.String("purge-header", "Authorization", "The header in which to send the token from the DRAND_PURGE_TOKEN env variable, if set, when calling the --purge-url webhook.")
+	ipAllowList = flag.String("ip-allow", "", "A comma separated list of CIDRs allowed to use the relay, all clients are allowed if empty.")
+	ipDenyList  = flag.String("ip-deny", "", "A comma separated list of CIDRs denied from using the relay, e.g. abusive ranges.")
+	v2AllowList = flag.String("v2-ip-allow", "", "A comma separated list of CIDRs allowed to use the v2 API, e.g. internal networks, all clients are allowed if empty.")
+	proxiesList = flag.String("trusted-proxies", "", "A comma separated list of CIDRs of the reverse proxies whose X-Forwarded-For header is trusted to find the client IP for --ip-allow and --ip-deny.")
+	maxURLLen   = flag.Int("max-url-length", 2048, "Reject the requests whose URL is longer than this with a 414 status. Disabled when set to 0.")
+	maxInflight = flag.Int("max-inflight", 0, "The maximum number of requests served at the same time, further ones get a 503 status with a Retry-After header. Unlimited when set to 0.")
+	maxPerIP    = flag.Int("max-inflight-per-ip", 0, "The maximum number of requests served at the same time for a single client IP, found using --trusted-proxies, further ones get a 503 status with a Retry-After header. Unlimited when set to 0.")
+	shedFlights = flag.Int("shed-inflight", 0, "Reject the non-essential requests, i.e. historical rounds and route listing, with a 503 status while more requests than this are in flight. Disabled when set to 0.")
+	shedRoutine = flag.Int("shed-goroutines", 0, "Reject the non-essential requests with a 503 status while more goroutines than this are running. Disabled when set to 0.")
+	shedErrRate = flag.Float64("shed-error-rate", 0, "Reject the non-essential requests with a 503 status while the average error rate of the grpc backends, between 0 and 1, is above this. Disabled when set to 0.")
+	maxWaiters  = flag.Int("max-waiters", 0, "The maximum number of requests waiting for the next round of each chain at the same time, further ones get a 503 status with a Retry-After header. Unlimited when set to 0.")
+	shutdownMax = flag.Duration("shutdown-timeout", relay.ShutdownTimeout, "The grace period given to the in-flight requests to complete when shutting down. The requests waiting for a round are served normally if --long-poll-max fits in it, and get the latest beacon or a 503 status right away otherwise.")
+	maxIntJSON  = flag.Bool("maxint-json", false, "Reply to the requests for the round 18446744073709551615, caused by an underflow in the clients, with a JSON error instead of an HTML page.")
+	maxIntDelay = flag.Duration("maxint-delay", 0, "Wait this long before replying to the requests for the round 18446744073709551615, to slow down the buggy clients hammering the relay. Disabled when set to 0.")
+	longPollMax = flag.Duration("long-poll-max", relay.LongPollWait, "The maximum time a request for the latest v2 beacon using ?after=N waits for a round greater than N before getting a 204 status.")
+	acceptAfter = flag.Duration("accept-after", 0, "Reply to the requests for the next round with a 202 status, a Location and a Retry-After header when it is due in more than this duration, instead of holding them until it is emitted. Disabled when set to 0.")
+	futureLimit = flag.Uint64("future-rounds", relay.FutureRounds, "Requests for a round up to this many rounds after the next one get a 425 status with a Retry-After header, those further in the future get a 404 status.")
+	prefetch    = flag.Bool("prefetch", false, "Fetch every round from the grpc backends as soon as it is expected, minus --frontrun, so that the requests for the latest beacon at the round boundary are served from memory.")
+	verify      = flag.Bool("verify", false, "Verify the signature of the beacons received from the grpc backends, retrying with the next backend when it is invalid.")
+	chaos       = flag.String("chaos", "", "Developer mode injecting faults in the grpc calls, e.g. latency=200ms,errors=0.1,malformed=0.05 to add up to 200ms of latency, fail 10% of the calls and corrupt 5% of the beacons. Never use it in production.")
+	mockBackend = flag.Bool("mock-backend", false, "Ignore --grpc-connect and start an in-process fake drand node producing deterministic test beacons every 3s, for local development and integration tests.")
+	recordFile  = flag.String("record", "", "Record all the grpc backend responses to this file, to be replayed later using --replay.")
+	replayFile  = flag.String("replay", "", "Ignore --grpc-connect and serve the responses from a --record file, following their original timing.")
+	checkOnly   = flag.Bool("check", false, "Validate the configuration, i.e. the flags, backend addresses, TLS files and secrets, then exit with a non-zero status if it is invalid.")
+	checkDial   = flag.Bool("check-dial", false, "Along with --check, also connect to the grpc backends to make sure they are reachable and serve chains.")
 	_           = flag.Bool("insecure", false, "deprecated flag")
 	_           = flag.String("hash-list", "", "deprecated flag")
+
+	backendGroups groupsFlag
 )
 
+// groupsFlag holds the backend groups provided using the repeatable --grpc-group flag, each in the form
+// chain1,chain2=host1:port,host2:port where chains are designated by their chainhash or their beacon ID.
+type groupsFlag []string
+
+func (g *groupsFlag) String() string {
+	return strings.Join(*g, " ")
+}
+
+func (g *groupsFlag) Set(value string) error {
+	if _, _, ok := strings.Cut(value, "="); !ok {
+		return fmt.Errorf("invalid backend group %q, expected chain1,chain2=host1:port,host2:port", value)
+	}
+	*g = append(*g, value)
+	return nil
+}
+
 func init() {
+	flag.Var(&backendGroups, "grpc-group", "A group of grpc backends serving only the given chains, in the form chain1,chain2=host1:port,host2:port where chains are chainhashes or beacon IDs. "+
+		"Can be repeated, requests for other chains are sent to the --grpc-connect nodes.")
+}
+
+// config parses the command line and returns the relay configuration it holds. It isn't done in init, since the
+// testing flags are only registered once the package is initialized when running tests.
+func config() relay.Config {
 	flag.Parse()
-	slog.SetLogLoggerLevel(getLogLevel())
-	if *frontrun > 0 {
-		FrontrunTiming = time.Duration(*frontrun) * time.Millisecond
+	return relay.Config{
+		Bind:                  *httpBind,
+		PrivateBind:           *privateBind,
+		GrpcBind:              *grpcBind,
+		MetricsBind:           *metricFlag,
+		MetricsCert:           *metricsCert,
+		MetricsKey:            *metricsKey,
+		MetricsOnMain:         *metricsMain,
+		ChannelzInterval:      *chanzTick,
+		GrpcConnect:           *grpcURL,
+		Groups:                backendGroups,
+		Chains:                *chainsList,
+		Keepalive:             *keepalive,
+		KeepaliveTimeout:      *kaTimeout,
+		KeepaliveNoStream:     *kaNoStream,
+		Compress:              *compress,
+		HedgeDelay:            *hedgeDelay,
+		RetryPolicy:           *retryPolicy,
+		MaxInflightPerBackend: *perBackend,
+		LatencyAware:          *latencyLB,
+		ProbeInterval:         *probeEvery,
+		ResolveInterval:       *resolveTick,
+		UnknownChainTTL:       *unknownTTL,
+		ChainInfoRefresh:      *infoRefresh,
+		ChainsTTL:             *chainsTTL,
+		ChainAffinity:         *affinity,
+		Verify:                *verify,
+		Chaos:                 *chaos,
+		MockBackend:           *mockBackend,
+		RecordFile:            *recordFile,
+		ReplayFile:            *replayFile,
+		Upstream:              *upstreamURL,
+		RequireAuth:           *requireAuth,
+		AuthMode:              *authMode,
+		AuthKeyFile:           *authKeyFile,
+		APIKeysFile:           *apiKeysFile,
+		TenantsFile:           *tenantsFile,
+		TokenRate:             *tokenRate,
+		TokenQuota:            *tokenQuota,
+		TokenLimits:           *limitsFile,
+		AuditLog:              *auditFile,
+		UsageExport:           *usageExport,
+		UsageInterval:         *usageTick,
+		Verbose:               *verbose,
+		JSON:                  *jsonFlag,
+		LogFile:               *logFile,
+		LogMaxSize:            *logMaxSize,
+		LogRotate:             *logRotate,
+		LogBackups:            *logBackups,
+		LogSample:             *logSample,
+		LogSampleRoutes:       *logSampleAt,
+		LogSkipPaths:          *logSkip,
+		AccessLogFormat:       *accessLog,
+		GeoIPDB:               *geoIPDB,
+		GeoIPByCountry:        *geoCountry,
+		Syslog:                *syslogAddr,
+		Frontrun:              time.Duration(max(*frontrun, 0)) * time.Millisecond,
+		MaxRequestTimeout:     *maxTimeout,
+		CorsMaxAge:            *corsMaxAge,
+		HideRoutes:            *hideRoutes,
+		BackendHeader:         *backendHdr,
+		IPAllow:               *ipAllowList,
+		IPDeny:                *ipDenyList,
+		V2IPAllow:             *v2AllowList,
+		TrustedProxies:        *proxiesList,
+		MaxURLLength:          *maxURLLen,
+		MaxInflight:           *maxInflight,
+		MaxInflightPerIP:      *maxPerIP,
+		ShedInflight:          *shedFlights,
+		ShedGoroutines:        *shedRoutine,
+		ShedErrorRate:         *shedErrRate,
+		MaxWaiters:            *maxWaiters,
+		ShutdownTimeout:       *shutdownMax,
+		MaxIntJSON:            *maxIntJSON,
+		MaxIntDelay:           *maxIntDelay,
+		LongPollMax:           *longPollMax,
+		AcceptAfter:           *acceptAfter,
+		FutureRounds:          *futureLimit,
+		Prefetch:              *prefetch,
+		CacheImmutable:        *cacheImmut,
+		CacheNone:             *cacheNone,
+		CacheInfo:             *cacheInfo,
+		CacheLatestFudge:      *cacheFudge,
+		StaleWhileRevalidate:  *staleReval,
+		StaleIfError:          *staleOnErr,
+		SurrogateKeyHeaders:   *surrogates,
+		PurgeURL:              *purgeURL,
+		PurgeMethod:           *purgeMethod,
+		PurgeHeader:           *purgeHeader,
+		ShadowURL:             *shadowURL,
+		ShadowPercent:         *shadowShare,
 	}
 }
 
 func main() {
+	cfg := config()
+	if *verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
 	if *goVersion {
-		log.Fatal("drand http server version: ", version)
+		log.Fatal("drand http server version: ", relay.Version)
 	}
 
-	nodesAddr := strings.Split(*grpcURL, ",")
-	for _, nodeAdd := range nodesAddr {
-		_, _, err := net.SplitHostPort(nodeAdd)
+	if *checkOnly {
+		errs := relay.Check(cfg, *checkDial)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("configuration OK")
+		return
+	}
+
+	if *logFile != "" || *syslogAddr != "" {
+		out, err := relay.LogOutput(cfg)
 		if err != nil {
-			log.Fatalf("Unable to parse --grpc flag correctly, please provide valid node URLs. On %q, got err: %v", nodeAdd, err)
+			log.Fatal("Unable to setup logs output: ", err)
 		}
+		// the default slog logger relies on the log package output until httplog replaces it
+		log.SetOutput(out)
+		cfg.LogWriter = out
 	}
 
-	client, err := grpc.NewClient("fallback:///"+*grpcURL, slog.Default())
+	rl, err := relay.New(cfg)
 	if err != nil {
-		log.Fatal("Failed to create client", "address", nodesAddr, "error", err)
+		log.Fatal("Invalid relay configuration: ", err)
+	}
+	if err := rl.Start(); err != nil {
+		log.Fatal("Unable to start the relay: ", err)
 	}
-	defer client.Close()
-
-	go serveMetrics()
-
-	slog.Info("Starting http relay", "version", version, "client", client)
-
-	// The HTTP Server
-	server := &http.Server{Addr: *httpBind, Handler: drandHandler(client)}
 
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
+	defer serverStopCtx()
 
-	// Listen for syscall signals for process to exit gracefully
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// systemd may route traffic to us once the chains are loaded and the listener is up
 	go func() {
-		defer serverStopCtx()
-		s := <-sig
-
-		slog.Info("Caught interrupt, shutting down...", "signal", s.String())
-
-		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
-		defer cancel()
-		go func() {
-			<-shutdownCtx.Done()
-			if errors.Is(shutdownCtx.Err(), context.DeadlineExceeded) {
-				slog.Error("graceful shutdown timed out.. forcing exit")
-				return
-			}
-		}()
-
-		// Trigger graceful shutdown
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			slog.Error("server Shutdown error", "err", err)
+		select {
+		case <-rl.Ready():
+		case <-serverCtx.Done():
 			return
 		}
+		if err := sdNotify("READY=1"); err != nil {
+			slog.Error("Unable to notify systemd", "err", err)
+		}
+		go sdWatchdog(serverCtx, "http://"+rl.Addr().String()+"/ping")
 	}()
 
-	// Run the server
-	err = server.ListenAndServe()
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		slog.Error("server error", "err", err)
-		return
+	// Listen for syscall signals for process to exit gracefully, SIGHUP reloads the JWT secret from its file instead
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	s := <-sig
+	for s == syscall.SIGHUP && *requireAuth && *authMode == "jwt" && *authKeyFile != "" {
+		if err := rl.ReloadAuthKey(); err != nil {
+			slog.Error("[AddAuth] unable to reload JWT secret, keeping the current one", "file", *authKeyFile, "err", err)
+		} else {
+			slog.Info("[AddAuth] reloaded JWT secret", "file", *authKeyFile)
+		}
+		s = <-sig
 	}
 
-	// Wait for server context to be stopped
-	<-serverCtx.Done()
-	slog.Info("drand http server stopped")
-}
+	slog.Info("Caught interrupt, shutting down...", "signal", s.String())
+	if err := sdNotify("STOPPING=1"); err != nil {
+		slog.Error("Unable to notify systemd", "err", err)
+	}
 
-func getLogLevel() slog.Level {
-	if *verbose {
-		return slog.LevelDebug
+	// Shutdown signal with grace period of --shutdown-timeout
+	shutdownCtx, cancel := context.WithTimeout(serverCtx, cfg.ShutdownTimeout)
+	defer cancel()
+	if err := rl.Stop(shutdownCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			slog.Error("graceful shutdown timed out.. forcing exit")
+		} else {
+			slog.Error("server Shutdown error", "err", err)
+		}
+		return
 	}
-	return slog.LevelInfo
+	slog.Info("drand http server stopped")
 }
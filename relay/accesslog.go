@@ -0,0 +1,176 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// The access log formats, selected using AccessLogFormat.
+const (
+	// AccessLogDefault is the httplog structure, in text or JSON according to the JSON setting.
+	AccessLogDefault = "default"
+	// AccessLogECS is the Elastic Common Schema, in JSON.
+	AccessLogECS = "ecs"
+	// AccessLogCLF is the Apache Common Log Format.
+	AccessLogCLF = "clf"
+)
+
+// ecsVersion is the version of the Elastic Common Schema of the ECS access log entries.
+const ecsVersion = "8.11.0"
+
+// clfTime is the time layout of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// accessEntry is a served request, as logged by the access logger.
+type accessEntry struct {
+	r       *http.Request
+	client  string
+	start   time.Time
+	elapsed time.Duration
+	status  int
+	bytes   int
+	geo     geoInfo
+}
+
+type accessCtxKey struct{}
+
+// setAccessGeo records the location of the client in the access log entry of the request, it does nothing if the
+// request isn't logged by the access logger.
+func setAccessGeo(r *http.Request, geo geoInfo) {
+	if e, ok := r.Context().Value(accessCtxKey{}).(*accessEntry); ok {
+		e.geo = geo
+	}
+}
+
+// accessLogger writes an access log entry per request using the ECS or CLF format. Like sampledRequestLogger, only 1
+// in every `every` successful requests whose path contains one of the provided routes is logged, failed requests are
+// always logged, and requests on the skipPaths are never logged.
+func accessLogger(format string, w io.Writer, trusted []netip.Prefix, every uint64, routes, skipPaths []string) func(next http.Handler) http.Handler {
+	encode := encodeCLF
+	if format == AccessLogECS {
+		encode = encodeECS
+	}
+	var (
+		count atomic.Uint64
+		mu    sync.Mutex
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if slices.Contains(skipPaths, r.URL.Path) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(rw, r.ProtoMajor)
+			e := &accessEntry{r: r, client: r.RemoteAddr, start: time.Now()}
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessCtxKey{}, e)))
+
+			e.elapsed, e.status, e.bytes = time.Since(e.start), ww.Status(), ww.BytesWritten()
+			if e.status == 0 {
+				// nothing was written, the server answers with an empty 200
+				e.status = http.StatusOK
+			}
+			sampled := every > 1 && len(routes) > 0 && sampledRoute(r.URL.Path, routes)
+			if sampled && e.status < http.StatusBadRequest && count.Add(1)%every != 0 {
+				return
+			}
+			if addr, err := clientIP(r, trusted); err == nil {
+				e.client = addr.String()
+			}
+
+			line, err := encode(e)
+			if err != nil {
+				slog.Error("[accessLogger] unable to encode access log entry", "format", format, "err", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			w.Write(line)
+		})
+	}
+}
+
+// encodeCLF encodes the entry in the Common Log Format, e.g.
+// 192.0.2.1 - - [10/Oct/2000:13:55:36 -0700] "GET /public/latest HTTP/1.1" 200 2326
+func encodeCLF(e *accessEntry) ([]byte, error) {
+	size := "-"
+	if e.bytes > 0 {
+		size = strconv.Itoa(e.bytes)
+	}
+	return fmt.Appendf(nil, "%s - - [%s] %q %d %s\n",
+		e.client, e.start.Format(clfTime), e.r.Method+" "+e.r.RequestURI+" "+e.r.Proto, e.status, size), nil
+}
+
+// encodeECS encodes the entry as an Elastic Common Schema JSON document, on a single line.
+func encodeECS(e *accessEntry) ([]byte, error) {
+	outcome, level := "success", "info"
+	if e.status >= http.StatusBadRequest {
+		outcome, level = "failure", "warn"
+	}
+	if e.status >= http.StatusInternalServerError {
+		level = "error"
+	}
+
+	doc := map[string]any{
+		"@timestamp": e.start.UTC().Format(time.RFC3339Nano),
+		"message":    fmt.Sprintf("%s %s %d", e.r.Method, e.r.URL.Path, e.status),
+		"ecs":        map[string]any{"version": ecsVersion},
+		"log":        map[string]any{"level": level, "logger": "access"},
+		"service":    map[string]any{"name": "drand-http-relay", "version": Version},
+		"event": map[string]any{
+			"kind":     "event",
+			"category": []string{"web"},
+			"type":     []string{"access"},
+			"outcome":  outcome,
+			"duration": e.elapsed.Nanoseconds(),
+		},
+		"http": map[string]any{
+			"version": fmt.Sprintf("%d.%d", e.r.ProtoMajor, e.r.ProtoMinor),
+			"request": map[string]any{
+				"id":     middleware.GetReqID(e.r.Context()),
+				"method": e.r.Method,
+			},
+			"response": map[string]any{
+				"status_code": e.status,
+				"body":        map[string]any{"bytes": e.bytes},
+			},
+		},
+		"url": map[string]any{
+			"original": e.r.RequestURI,
+			"path":     e.r.URL.Path,
+		},
+		"client": map[string]any{"ip": e.client},
+		"source": map[string]any{"address": e.r.RemoteAddr},
+	}
+	if e.r.URL.RawQuery != "" {
+		doc["url"].(map[string]any)["query"] = e.r.URL.RawQuery
+	}
+	if e.geo != (geoInfo{}) {
+		doc["client"].(map[string]any)["geo"] = map[string]any{
+			"continent_code":   e.geo.continent,
+			"country_iso_code": e.geo.country,
+		}
+	}
+	if ua := e.r.UserAgent(); ua != "" {
+		doc["user_agent"] = map[string]any{"original": ua}
+	}
+
+	line, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,85 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogger(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/public/0" {
+			http.Error(w, "invalid round", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("beacon"))
+	})
+	serve := func(format string, every uint64, paths ...string) []string {
+		var buf bytes.Buffer
+		h := accessLogger(format, &buf, nil, every, []string{"/public/"}, []string{"/ping"})(handler)
+		for _, path := range paths {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set("User-Agent", "tester")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	lines := serve(AccessLogCLF, 1, "/public/1?x=1", "/public/0", "/ping")
+	require.Len(t, lines, 2, "the skipped paths must not be logged")
+	require.Regexp(t, regexp.MustCompile(`^192\.0\.2\.1 - - \[[^]]+\] "GET /public/1\?x=1 HTTP/1\.1" 200 6$`), lines[0])
+	require.Regexp(t, regexp.MustCompile(`^192\.0\.2\.1 - - \[[^]]+\] "GET /public/0 HTTP/1\.1" 400 14$`), lines[1])
+
+	lines = serve(AccessLogECS, 1, "/public/1?x=1")
+	require.Len(t, lines, 1)
+	var doc struct {
+		Timestamp string `json:"@timestamp"`
+		Event     struct {
+			Outcome string `json:"outcome"`
+		} `json:"event"`
+		HTTP struct {
+			Request struct {
+				Method string `json:"method"`
+			} `json:"request"`
+			Response struct {
+				StatusCode int `json:"status_code"`
+				Body       struct {
+					Bytes int `json:"bytes"`
+				} `json:"body"`
+			} `json:"response"`
+		} `json:"http"`
+		URL struct {
+			Path  string `json:"path"`
+			Query string `json:"query"`
+		} `json:"url"`
+		Client struct {
+			IP string `json:"ip"`
+		} `json:"client"`
+		UserAgent struct {
+			Original string `json:"original"`
+		} `json:"user_agent"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &doc))
+	require.NotEmpty(t, doc.Timestamp)
+	require.Equal(t, "success", doc.Event.Outcome)
+	require.Equal(t, http.MethodGet, doc.HTTP.Request.Method)
+	require.Equal(t, http.StatusOK, doc.HTTP.Response.StatusCode)
+	require.Equal(t, 6, doc.HTTP.Response.Body.Bytes)
+	require.Equal(t, "/public/1", doc.URL.Path)
+	require.Equal(t, "x=1", doc.URL.Query)
+	require.Equal(t, "192.0.2.1", doc.Client.IP)
+	require.Equal(t, "tester", doc.UserAgent.Original)
+
+	// only 1 in 3 successful requests are logged on the sampled routes, but all the failed ones
+	lines = serve(AccessLogCLF, 3, "/public/1", "/public/1", "/public/1", "/public/0", "/other")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[1], `"GET /public/0 HTTP/1.1" 400`)
+	require.Contains(t, lines[2], `"GET /other HTTP/1.1" 200`)
+}
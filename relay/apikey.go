@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKeyRequests (HTTP) how many requests were made using each API key
+var APIKeyRequests = defaultMetrics.apiKeyRequests
+
+// apiKey is an API key allowed to use the v2 API, unless disabled.
+type apiKey struct {
+	name     string
+	disabled bool
+}
+
+// apiKeys maps the sha256 of the API keys to their definition, so that the lookups don't leak timing information
+// about the keys themselves.
+type apiKeys map[[sha256.Size]byte]apiKey
+
+// parseAPIKeys reads API keys definitions, one per line in the form name:key, or name:key:disabled to disable a key
+// without removing it. Empty lines and lines starting with # are ignored.
+func parseAPIKeys(r io.Reader) (apiKeys, error) {
+	keys := make(apiKeys)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			// we don't print the line, since it may hold a key
+			return nil, fmt.Errorf("invalid API key definition on line %d, expected name:key or name:key:disabled", n)
+		}
+		key := apiKey{name: parts[0]}
+		if len(parts) == 3 {
+			if parts[2] != "disabled" {
+				return nil, fmt.Errorf("invalid API key state %q for %q, expected disabled", parts[2], parts[0])
+			}
+			key.disabled = true
+		}
+		keys[sha256.Sum256([]byte(parts[1]))] = key
+	}
+	return keys, scanner.Err()
+}
+
+// loadAPIKeys loads the API keys from the provided file, if any, and from the DRAND_API_KEYS env variable, in which
+// the definitions are comma separated.
+func loadAPIKeys(path string) (apiKeys, error) {
+	var sources []io.Reader
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		sources = append(sources, f, strings.NewReader("\n"))
+	}
+	if env, ok := os.LookupEnv("DRAND_API_KEYS"); ok {
+		sources = append(sources, strings.NewReader(strings.ReplaceAll(env, ",", "\n")))
+	}
+	return parseAPIKeys(io.MultiReader(sources...))
+}
+
+// APIKeyAuth returns a middleware relying on the API keys from the provided --api-keys file and the DRAND_API_KEYS env
+// variable to authenticate the v2 API requests using their X-API-Key header, as a simpler alternative to JWT.
+func APIKeyAuth(path string) (func(http.Handler) http.Handler, error) {
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load API keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no API keys provided using --api-keys or DRAND_API_KEYS")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return apiKeyAuth(keys, next)
+	}, nil
+}
+
+func apiKeyAuth(keys apiKeys, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests := settingsOf(r).metrics.apiKeyRequests
+		provided := r.Header.Get("X-API-Key")
+		if provided == "" {
+			slog.Error("Received invalid request, API key missing", "from", r.RemoteAddr)
+			requests.WithLabelValues("", "missing").Inc()
+			http.Error(w, "Missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		key, ok := keys[sha256.Sum256([]byte(provided))]
+		if !ok {
+			slog.Error("Received an unknown API key!", "from", r.RemoteAddr, "uri", r.RequestURI)
+			requests.WithLabelValues("", "invalid").Inc()
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if key.disabled {
+			slog.Error("Received a disabled API key!", "key", key.name, "from", r.RemoteAddr, "uri", r.RequestURI)
+			requests.WithLabelValues(key.name, "disabled").Inc()
+			http.Error(w, "Disabled API key", http.StatusForbidden)
+			return
+		}
+
+		requests.WithLabelValues(key.name, "ok").Inc()
+		next.ServeHTTP(w, withIdentity(r, key.name, nil))
+	})
+}
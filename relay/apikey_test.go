@@ -0,0 +1,47 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys(strings.NewReader("# comment\n\nalice:secret1\nbob:secret2:disabled\n"))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	alice := keys[sha256.Sum256([]byte("secret1"))]
+	require.Equal(t, "alice", alice.name)
+	require.False(t, alice.disabled)
+	bob := keys[sha256.Sum256([]byte("secret2"))]
+	require.Equal(t, "bob", bob.name)
+	require.True(t, bob.disabled)
+
+	for _, invalid := range []string{"alice", "alice:", ":secret", "alice:secret:enabled", "a:b:c:d"} {
+		_, err := parseAPIKeys(strings.NewReader(invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	_, err := APIKeyAuth("")
+	require.Error(t, err, "the API keys authentication can't be set up without keys")
+
+	t.Setenv("DRAND_API_KEYS", "alice:secret1")
+	auth, err := APIKeyAuth("")
+	require.NoError(t, err)
+	h := auth(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for key, expected := range map[string]int{"": http.StatusUnauthorized, "secret2": http.StatusUnauthorized, "secret1": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/v2/chains", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, expected, w.Code, key)
+	}
+}
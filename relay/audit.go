@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newAuditLog returns a json logger writing the audit trail to the provided file, rotated like the regular logs.
+func newAuditLog(path string, cfg *Config) (*slog.Logger, error) {
+	f, err := newRotatingFile(path, cfg.LogMaxSize<<20, cfg.LogRotate, cfg.LogBackups)
+	if err != nil {
+		return nil, err
+	}
+	return slog.New(slog.NewJSONHandler(f, nil)), nil
+}
+
+type auditCtxKey struct{}
+
+// auditEntry is filled by the authentication middlewares with the identity of the caller.
+type auditEntry struct {
+	subject string
+	claims  jwt.Claims
+}
+
+// setAuditIdentity records the identity of the caller of an audited request, it does nothing if the request isn't
+// audited.
+func setAuditIdentity(r *http.Request, subject string, claims jwt.Claims) {
+	if entry, ok := r.Context().Value(auditCtxKey{}).(*auditEntry); ok {
+		entry.subject = subject
+		entry.claims = claims
+	}
+}
+
+// auditRequests records every request along with the identity of its caller and its result in the audit log. It must
+// be used before the authentication middleware, so that rejected requests are recorded too.
+func auditRequests(l *slog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := &auditEntry{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditCtxKey{}, entry)))
+			status := ww.Status()
+			if status == 0 {
+				// nothing was written, the server answers with an empty 200
+				status = http.StatusOK
+			}
+
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"from", r.RemoteAddr,
+				"request_id", middleware.GetReqID(r.Context()),
+				"status", status,
+				"elapsed", time.Since(start),
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				attrs = append(attrs, "route", rctx.RoutePattern())
+			}
+			if entry.subject != "" {
+				attrs = append(attrs, "subject", entry.subject)
+			}
+			if entry.claims != nil {
+				attrs = append(attrs, "claims", entry.claims)
+			}
+			l.Info("audit", attrs...)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditAdminRequests(t *testing.T) {
+	t.Setenv("DRAND_METRICS_TOKEN", "")
+	t.Setenv("DRAND_METRICS_BASIC_AUTH", "admin:secret")
+	var out bytes.Buffer
+	rl := newRelay(DefaultConfig(), nil, nil)
+	rl.audit = slog.New(slog.NewJSONHandler(&out, nil))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/balancer", func(http.ResponseWriter, *http.Request) {})
+	handler := rl.adminHandler(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/balancer", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/balancer", nil)
+	req.SetBasicAuth("admin", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	dec := json.NewDecoder(&out)
+	for _, expected := range []struct {
+		status  int
+		subject string
+	}{{http.StatusUnauthorized, ""}, {http.StatusOK, "admin"}} {
+		var entry struct {
+			Path    string `json:"path"`
+			Status  int    `json:"status"`
+			Subject string `json:"subject"`
+		}
+		require.NoError(t, dec.Decode(&entry))
+		require.Equal(t, "/balancer", entry.Path)
+		require.Equal(t, expected.status, entry.Status)
+		require.Equal(t, expected.subject, entry.Subject)
+	}
+}
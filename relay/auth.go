@@ -0,0 +1,230 @@
+package relay
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// loadJWTSecret returns the hex-encoded JWT secret from the provided file, or from the DRAND_AUTH_KEY env variable if
+// no file is provided.
+func loadJWTSecret(path string) ([]byte, error) {
+	source := "DRAND_AUTH_KEY"
+	token, provided := os.LookupEnv("DRAND_AUTH_KEY")
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		source, token, provided = path, strings.TrimSpace(string(raw)), true
+	}
+	if !provided || len(token) < 256 {
+		return nil, fmt.Errorf("%s not set to a 128 byte hex-encoded secret", source)
+	}
+
+	secret, err := hex.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s as valid hex", source)
+	}
+	return secret, nil
+}
+
+// jwtKey holds the JWT secret used by AddAuth, which can be reloaded from its --auth-key-file.
+type jwtKey struct {
+	path   string
+	secret atomic.Pointer[[]byte]
+}
+
+// setupAuth validates the authentication configuration of the AuthMode and sets up the v2Auth middleware
+// accordingly, so that an invalid configuration is reported at startup rather than when serving requests.
+func (rl *Relay) setupAuth() error {
+	var err error
+	switch rl.cfg.AuthMode {
+	case "jwt":
+		if rl.authKey, err = newJWTKey(rl.cfg.AuthKeyFile); err != nil {
+			return fmt.Errorf("invalid JWT secret: %w", err)
+		}
+		rl.v2Auth, err = AddAuth(rl.authKey)
+	case "apikey":
+		rl.v2Auth, err = APIKeyAuth(rl.cfg.APIKeysFile)
+	case "tenant":
+		if rl.tenants, err = loadTenants(rl.cfg.TenantsFile); err != nil {
+			return fmt.Errorf("unable to load tenants: %w", err)
+		}
+		keys := rl.tenants.apiKeys()
+		rl.v2Auth = func(next http.Handler) http.Handler {
+			return apiKeyAuth(keys, next)
+		}
+	default:
+		err = fmt.Errorf("unknown --auth-mode %q", rl.cfg.AuthMode)
+	}
+	return err
+}
+
+// denyAll is rejecting all requests, it is used in place of the v2Auth middleware if it wasn't set up, to never serve
+// the v2 API unauthenticated when authentication is required.
+func denyAll(http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Error("[denyAll] authentication required but not set up", "from", r.RemoteAddr, "uri", r.RequestURI)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func newJWTKey(path string) (*jwtKey, error) {
+	k := &jwtKey{path: path}
+	return k, k.reload()
+}
+
+// reload loads the JWT secret again, keeping the current one if it fails.
+func (k *jwtKey) reload() error {
+	secret, err := loadJWTSecret(k.path)
+	if err != nil {
+		return err
+	}
+	k.secret.Store(&secret)
+	return nil
+}
+
+// AddAuth returns a middleware relying on the provided JWT secret, loaded from the --auth-key-file or the
+// DRAND_AUTH_KEY env variable, to setup JWT authentication on the v2 API endpoints.
+func AddAuth(k *jwtKey) (func(http.Handler) http.Handler, error) {
+	if k == nil || k.secret.Load() == nil {
+		return nil, errors.New("no JWT secret loaded")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return jwtAuth(k, next)
+	}, nil
+}
+
+func jwtAuth(k *jwtKey, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := strings.Split(r.Header.Get("Authorization"), "Bearer ")
+		if len(authHeader) != 2 {
+			slog.Error("Received invalid request, JWT not recognized", "Authorization", authHeader)
+
+			http.Error(w, "Missing JWT", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := jwt.Parse(authHeader[1], func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return *k.secret.Load(), nil
+		}, jwt.WithValidMethods([]string{"HS256", "HS384"}))
+		if err != nil {
+			slog.Error("Unable to parse JWT!", "err", err)
+			http.Error(w, "Invalid JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !token.Valid {
+			slog.Error("Received an invalid JWT!", "from", r.RemoteAddr, "uri", r.RequestURI)
+
+			http.Error(w, "Invalid JWT", http.StatusUnauthorized)
+			return
+		}
+
+		subject, _ := token.Claims.GetSubject()
+		next.ServeHTTP(w, withIdentity(r, subject, token.Claims))
+	})
+}
+
+// metricsAuth protects the metrics endpoints using the bearer token from the DRAND_METRICS_TOKEN env variable and/or
+// the user:password basic auth credentials from the DRAND_METRICS_BASIC_AUTH env variable. The endpoints are left
+// unprotected if neither is set.
+func metricsAuth(next http.Handler) http.Handler {
+	token, hasToken := os.LookupEnv("DRAND_METRICS_TOKEN")
+	creds, hasCreds := os.LookupEnv("DRAND_METRICS_BASIC_AUTH")
+	// an empty token would match any empty bearer
+	hasToken = hasToken && token != ""
+	hasCreds = hasCreds && creds != ""
+	if !hasToken && !hasCreds {
+		return next
+	}
+	user, password, ok := strings.Cut(creds, ":")
+	if hasCreds && !ok {
+		log.Fatal("DRAND_METRICS_BASIC_AUTH must be in the form user:password")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasToken {
+			bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if found && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if hasCreds {
+			u, p, found := r.BasicAuth()
+			if found && subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1 {
+				setAuditIdentity(r, u, nil)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+
+		slog.Error("Received unauthenticated metrics request", "from", r.RemoteAddr, "uri", r.RequestURI)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+type identityCtxKey struct{}
+
+// identity is the authenticated caller of a request, as set by the authentication middlewares.
+type identity struct {
+	subject string
+	claims  jwt.Claims
+}
+
+// withIdentity records the authenticated caller of the request in its context, in the audit log and in the usage
+// meter, if any.
+func withIdentity(r *http.Request, subject string, claims jwt.Claims) *http.Request {
+	setAuditIdentity(r, subject, claims)
+	id := &identity{subject: subject, claims: claims}
+	setUsageCaller(r, id.limitKey())
+	return r.WithContext(context.WithValue(r.Context(), identityCtxKey{}, id))
+}
+
+// limitKey returns the key of the caller in the per caller limits: its subject, or else the jti claim or a hash of
+// the claims of its JWT, so that the callers without subject don't all share the same rate limit and quota. Since all
+// the JWTs are signed using the same secret, their claims identify them.
+func (id *identity) limitKey() string {
+	if id.subject != "" {
+		return id.subject
+	}
+	claims, ok := id.claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return "jti:" + jti
+	}
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return "claims:" + hex.EncodeToString(sum[:])
+}
+
+// requestIdentity returns the authenticated caller of the request, or nil if it isn't authenticated.
+func requestIdentity(r *http.Request) *identity {
+	id, _ := r.Context().Value(identityCtxKey{}).(*identity)
+	return id
+}
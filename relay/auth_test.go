@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadJWTSecret(t *testing.T) {
+	t.Setenv("DRAND_AUTH_KEY", strings.Repeat("ab", 128))
+	secret, err := loadJWTSecret("")
+	require.NoError(t, err)
+	require.Len(t, secret, 128)
+
+	// the file takes precedence over the env variable, and is reloaded
+	path := filepath.Join(t.TempDir(), "auth.key")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("cd", 128)+"\n"), 0o600))
+	k, err := newJWTKey(path)
+	require.NoError(t, err)
+	require.Equal(t, byte(0xcd), (*k.secret.Load())[0])
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("ef", 128)), 0o600))
+	require.NoError(t, k.reload())
+	require.Equal(t, byte(0xef), (*k.secret.Load())[0])
+
+	// an invalid secret doesn't replace the current one
+	require.NoError(t, os.WriteFile(path, []byte("short"), 0o600))
+	require.Error(t, k.reload())
+	require.Equal(t, byte(0xef), (*k.secret.Load())[0])
+}
+
+func TestAddAuth(t *testing.T) {
+	_, err := AddAuth(nil)
+	require.Error(t, err, "the JWT authentication can't be set up without secret")
+
+	t.Setenv("DRAND_AUTH_KEY", strings.Repeat("ab", 128))
+	k, err := newJWTKey("")
+	require.NoError(t, err)
+	auth, err := AddAuth(k)
+	require.NoError(t, err)
+
+	var subject string
+	h := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = requestIdentity(r).subject
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/chains", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	serve := func(method jwt.SigningMethod, secret []byte) int {
+		token, err := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "alice"}).SignedString(secret)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/v2/chains", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, serve(jwt.SigningMethodHS256, *k.secret.Load()))
+	require.Equal(t, "alice", subject)
+	require.Equal(t, http.StatusOK, serve(jwt.SigningMethodHS384, *k.secret.Load()))
+	require.Equal(t, http.StatusUnauthorized, serve(jwt.SigningMethodHS512, *k.secret.Load()))
+	require.Equal(t, http.StatusUnauthorized, serve(jwt.SigningMethodHS256, []byte("another secret")))
+
+	w = httptest.NewRecorder()
+	denyAll(h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/chains", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
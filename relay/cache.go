@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The default Cache-Control header values used by the handlers, each Relay using the ones of its Config.
+var (
+	// CacheImmutable is used for the responses that never change, such as past beacons.
+	CacheImmutable = "public, max-age=604800, immutable"
+	// CacheNone is used when something went wrong and the response must not be cached.
+	CacheNone = "must-revalidate, no-cache, max-age=0"
+	// CacheInfo is used for the chain info responses, to which the stale directives are added.
+	CacheInfo = "public, max-age=300"
+
+	// LatestFudge is subtracted from the max-age of the latest beacon responses, so that caches expire them a bit
+	// before the next round rather than right at it, e.g. to account for clock skew. It can be negative.
+	LatestFudge time.Duration
+
+	// StaleWhileRevalidate lets CDNs serve the latest beacon and chain info responses for this long after their
+	// expiry while they revalidate them in the background. Disabled when set to 0.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError lets CDNs serve the latest beacon and chain info responses for this long after their expiry
+	// when revalidating them fails. Disabled when set to 0.
+	StaleIfError time.Duration
+)
+
+// latestSafetyMargin is subtracted from the max-age of the latest beacon responses on top of the frontrun, to account
+// for the time they take to reach the caches.
+const latestSafetyMargin = 250 * time.Millisecond
+
+// latestCacheControl returns the Cache-Control value for a latest beacon, stopping caching in time for the next round
+// happening at nextTime. Since the relay starts asking for the next round the frontrun before it, the caches must
+// stop serving the current one by then too. The max-age is extended by the age in seconds of the response, if served
+// with an Age header, since the caches subtract it from the max-age.
+func (s *settings) latestCacheControl(nextTime, age int64) string {
+	ttl := time.Until(time.Unix(nextTime, 0)) - s.frontrun - latestSafetyMargin - s.latestFudge
+	cacheTime := max(int64(ttl/time.Second), 0) + age
+	if s.staleReval <= 0 && s.staleOnError <= 0 {
+		return fmt.Sprintf("public, must-revalidate, max-age=%d", cacheTime)
+	}
+	// must-revalidate forbids serving stale responses, so we can't use it along with the stale directives
+	return s.withStale(fmt.Sprintf("public, max-age=%d", cacheTime))
+}
+
+// setCachedLatest sets the Cache-Control and Age headers of a latest beacon served from memory, which was received at
+// the provided time, so that the caches can tell how old it is while still expiring it in time for the next round.
+func (s *settings) setCachedLatest(w http.ResponseWriter, nextTime int64, received time.Time) {
+	age := max(int64(time.Since(received)/time.Second), 0)
+	w.Header().Set("Age", strconv.FormatInt(age, 10))
+	w.Header().Set("Cache-Control", s.latestCacheControl(nextTime, age))
+}
+
+// infoCacheControl returns the Cache-Control value for the chain info responses.
+func (s *settings) infoCacheControl() string {
+	return s.withStale(s.cacheInfo)
+}
+
+// withStale appends the configured stale-while-revalidate and stale-if-error directives to the provided ones.
+func (s *settings) withStale(directives string) string {
+	if s.staleReval > 0 {
+		directives += fmt.Sprintf(", stale-while-revalidate=%d", int64(s.staleReval.Seconds()))
+	}
+	if s.staleOnError > 0 {
+		directives += fmt.Sprintf(", stale-if-error=%d", int64(s.staleOnError.Seconds()))
+	}
+	return directives
+}
+
+// SurrogateKeyHeaders are the default headers in which the surrogate keys of the responses are set, allowing CDNs such
+// as Fastly or Varnish to purge them precisely. No surrogate keys are set when empty.
+var SurrogateKeyHeaders = []string{"Surrogate-Key"}
+
+// setSurrogateKeys sets the surrogate keys of a response about the provided chain, which is tagged with the
+// chainhash itself and with the chainhash suffixed with each of the provided tags, e.g. <chainhash>-latest.
+func (s *settings) setSurrogateKeys(w http.ResponseWriter, chainhash string, tags ...string) {
+	if len(s.surrogateKeys) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, chainhash)
+	for _, tag := range tags {
+		keys = append(keys, chainhash+"-"+tag)
+	}
+	value := strings.Join(keys, " ")
+
+	for _, header := range s.surrogateKeys {
+		w.Header().Set(header, value)
+	}
+}
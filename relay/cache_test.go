@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/drand/http-server/grpc"
+)
+
+func TestLatestCacheControl(t *testing.T) {
+	tests := []struct {
+		fudge    time.Duration
+		swr      time.Duration
+		frontrun time.Duration
+		format   string
+		maxAge   int64
+	}{
+		// the safety margin always takes the max-age a second below the time until the next round
+		{0, 0, 0, "public, must-revalidate, max-age=%d", 9},
+		{2 * time.Second, 0, 0, "public, must-revalidate, max-age=%d", 7},
+		{time.Minute, 0, 0, "public, must-revalidate, max-age=%d", 0},
+		{0, 5 * time.Second, 0, "public, max-age=%d, stale-while-revalidate=5", 9},
+		// the caches stop serving the current round when the relay starts frontrunning the next one
+		{0, 0, 1500 * time.Millisecond, "public, must-revalidate, max-age=%d", 8},
+		{time.Second, 0, 1500 * time.Millisecond, "public, must-revalidate, max-age=%d", 7},
+	}
+	for _, tt := range tests {
+		s := &settings{latestFudge: tt.fudge, staleReval: tt.swr, frontrun: tt.frontrun}
+		// our time.Now is truncated to the second, so the max-age can be a second lower
+		expected := []string{fmt.Sprintf(tt.format, tt.maxAge), fmt.Sprintf(tt.format, max(tt.maxAge-1, 0))}
+		require.Contains(t, expected, s.latestCacheControl(time.Now().Unix()+10, 0), "fudge %v, swr %v", tt.fudge, tt.swr)
+	}
+}
+
+func TestSetCachedLatest(t *testing.T) {
+	s := &settings{}
+
+	// the max-age is extended by the age, so that the caches still expire the response before the next round
+	w := httptest.NewRecorder()
+	s.setCachedLatest(w, time.Now().Unix()+10, time.Now().Add(-2500*time.Millisecond))
+	require.Equal(t, "2", w.Header().Get("Age"))
+	require.Contains(t, []string{"public, must-revalidate, max-age=11", "public, must-revalidate, max-age=10"}, w.Header().Get("Cache-Control"))
+
+	// a response already due for the next round is stale
+	w = httptest.NewRecorder()
+	s.setCachedLatest(w, time.Now().Unix()-1, time.Now().Add(-5*time.Second))
+	require.Equal(t, "5", w.Header().Get("Age"))
+	require.Equal(t, "public, must-revalidate, max-age=5", w.Header().Get("Cache-Control"))
+
+	info := &grpc.JsonInfoV2{Period: 3, GenesisTime: time.Now().Add(-time.Minute).Unix(), Hash: bytes.Repeat([]byte{0xcd}, 32), BeaconId: "quicknet"}
+	chain := info.Hash.String()
+	p := NewMockProvider(info)
+	hub := NewHub(p)
+	_, next := info.ExpectedNext()
+	hub.observe(chain, &grpc.HexBeacon{Round: next - 1, Signature: []byte{0x01}})
+	hub.mu.Lock()
+	hub.latest[chain].at = time.Now().Add(-time.Second)
+	hub.mu.Unlock()
+	url := serveRelay(t, p, hub)
+
+	resp := getJSON(t, url+"/v2/beacons/quicknet/rounds/latest", http.StatusOK, nil)
+	require.Equal(t, "1", resp.Header.Get("Age"))
+	// the responses served from the backends are fresh
+	p.AddBeacons(chain, &grpc.HexBeacon{Round: next - 1, Signature: []byte{0x01}})
+	resp = getJSON(t, url+"/v2/beacons/quicknet/rounds/latest?include=meta", http.StatusOK, nil)
+	require.Empty(t, resp.Header.Get("Age"))
+}
+
+func TestSetSurrogateKeys(t *testing.T) {
+	w := httptest.NewRecorder()
+	packageSettings().setSurrogateKeys(w, "abcd", "latest", "42")
+	require.Equal(t, "abcd abcd-latest abcd-42", w.Header().Get("Surrogate-Key"))
+
+	s := &settings{surrogateKeys: []string{"Surrogate-Key", "Cache-Tag"}}
+	w = httptest.NewRecorder()
+	s.setSurrogateKeys(w, "abcd", "info")
+	require.Equal(t, "abcd abcd-info", w.Header().Get("Surrogate-Key"))
+	require.Equal(t, "abcd abcd-info", w.Header().Get("Cache-Tag"))
+
+	s.surrogateKeys = nil
+	w = httptest.NewRecorder()
+	s.setSurrogateKeys(w, "abcd")
+	require.Empty(t, w.Header())
+}
@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/drand/http-server/grpc"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxLinkedRounds bounds the number of rounds whose chain links are verified by a single request to VerifyLinks.
+	maxLinkedRounds = 1000
+	// maxLinkFetches bounds the number of beacons retrieved at the same time by VerifyLinks.
+	maxLinkFetches = 8
+)
+
+// chainLinks is the result of the verification of the chain links of a range of rounds by VerifyLinks.
+type chainLinks struct {
+	From    uint64      `json:"from"`
+	To      uint64      `json:"to"`
+	Chained bool        `json:"chained"`
+	Valid   bool        `json:"valid"`
+	Break   *chainBreak `json:"break,omitempty"`
+}
+
+// chainBreak is the first round of a range whose previous signature isn't the signature of the prior round.
+type chainBreak struct {
+	Round             uint64        `json:"round"`
+	PreviousSignature grpc.HexBytes `json:"previous_signature"`
+	Expected          grpc.HexBytes `json:"expected"`
+}
+
+// firstBreak returns the first beacon whose previous signature isn't the signature of the beacon before it, the
+// first beacon being linked to the provided signature, or nil if all the links hold.
+func firstBreak(prev []byte, beacons []*grpc.HexBeacon) *chainBreak {
+	for _, b := range beacons {
+		if !bytes.Equal(b.PreviousSignature, prev) {
+			return &chainBreak{Round: b.Round, PreviousSignature: b.PreviousSignature, Expected: prev}
+		}
+		prev = b.Signature
+	}
+	return nil
+}
+
+// parseRange returns the rounds provided using the from and to query parameters, which must be a non-empty range of
+// at most maxLinkedRounds past rounds.
+func parseRange(r *http.Request, next uint64) (from, to uint64, err error) {
+	if from, err = strconv.ParseUint(r.URL.Query().Get("from"), 10, 64); err != nil || from == 0 {
+		return 0, 0, fmt.Errorf("invalid from round, it must be a positive integer")
+	}
+	if to, err = strconv.ParseUint(r.URL.Query().Get("to"), 10, 64); err != nil || to < from {
+		return 0, 0, fmt.Errorf("invalid to round, it must be an integer not lower than from")
+	}
+	if to >= next {
+		return 0, 0, fmt.Errorf("invalid to round, the latest round is %d", next-1)
+	}
+	if to-from >= maxLinkedRounds {
+		return 0, 0, fmt.Errorf("invalid range, at most %d rounds can be verified at once", maxLinkedRounds)
+	}
+	return from, to, nil
+}
+
+// VerifyLinks checks that the previous signature of each beacon of the range provided using ?from=A&to=B is the
+// signature of the prior round, reporting the first break found. The beacons of unchained schemes aren't linked, so
+// there is nothing to verify for them.
+func VerifyLinks(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the links are only as good as the backends serving them right now, auditors must not get a cached answer
+		w.Header().Set("Cache-Control", settingsOf(r).cacheNone)
+
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[VerifyLinks] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to verify links", http.StatusInternalServerError)
+			return
+		}
+
+		info, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[VerifyLinks] unable to get chain info", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		_, next := info.ExpectedNext()
+		from, to, err := parseRange(r, next)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		links := &chainLinks{From: from, To: to, Chained: grpc.IsChained(info.Scheme), Valid: true}
+		if links.Chained {
+			// the first round is linked to the prior one, or to the genesis seed for round 1
+			first := from
+			if from > 1 {
+				first--
+			}
+			beacons := make([]*grpc.HexBeacon, to-first+1)
+			g, ctx := errgroup.WithContext(r.Context())
+			g.SetLimit(maxLinkFetches)
+			for i := range beacons {
+				g.Go(func() (err error) {
+					beacons[i], err = c.GetBeacon(ctx, m, first+uint64(i))
+					return err
+				})
+			}
+			if err := g.Wait(); err != nil {
+				slog.Error("[VerifyLinks] unable to get beacon from any grpc client", "error", err)
+				http.Error(w, "Failed to get beacons", http.StatusInternalServerError)
+				return
+			}
+
+			prev := []byte(info.GenesisSeed)
+			if from > 1 {
+				prev, beacons = beacons[0].Signature, beacons[1:]
+			}
+			links.Break = firstBreak(prev, beacons)
+			links.Valid = links.Break == nil
+		}
+
+		json, err := json.Marshal(links)
+		if err != nil {
+			slog.Error("[VerifyLinks] unable to encode chain links in json", "error", err)
+			http.Error(w, "Failed to encode chain links", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(json)
+	}
+}
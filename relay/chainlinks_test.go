@@ -0,0 +1,23 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstBreak(t *testing.T) {
+	seed := []byte{0}
+	beacons := []*grpc.HexBeacon{
+		{Round: 1, Signature: []byte{1}, PreviousSignature: []byte{0}},
+		{Round: 2, Signature: []byte{2}, PreviousSignature: []byte{1}},
+		{Round: 3, Signature: []byte{3}, PreviousSignature: []byte{2}},
+	}
+	require.Nil(t, firstBreak(seed, beacons))
+	require.Nil(t, firstBreak(beacons[0].Signature, beacons[1:]))
+
+	beacons[2].PreviousSignature = []byte{9}
+	require.Equal(t, &chainBreak{Round: 3, PreviousSignature: []byte{9}, Expected: []byte{2}}, firstBreak(seed, beacons))
+	require.Equal(t, &chainBreak{Round: 1, PreviousSignature: []byte{0}, Expected: []byte{7}}, firstBreak([]byte{7}, beacons))
+}
@@ -0,0 +1,194 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// Check validates the provided configuration, along with the env variables, without starting the relay, returning all
+// the problems found. If dial is set, it also connects to the grpc backends to list their chains.
+func Check(cfg Config, dial bool) []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	var targets []string
+	switch {
+	case cfg.MockBackend || cfg.ReplayFile != "":
+	case strings.HasPrefix(cfg.GrpcConnect, "srv:///"):
+		targets = append(targets, cfg.GrpcConnect)
+	default:
+		if _, err := parseNodes(cfg.GrpcConnect); err != nil {
+			fail("invalid --grpc-connect: %w", err)
+		}
+		targets = append(targets, "fallback:///"+cfg.GrpcConnect)
+	}
+	for _, group := range cfg.Groups {
+		_, addrs, _ := strings.Cut(group, "=")
+		if _, err := parseNodes(addrs); err != nil {
+			fail("invalid --grpc-group %q: %w", group, err)
+		}
+		targets = append(targets, "fallback:///"+addrs)
+	}
+
+	for name, list := range map[string]string{
+		"ip-allow":        cfg.IPAllow,
+		"ip-deny":         cfg.IPDeny,
+		"v2-ip-allow":     cfg.V2IPAllow,
+		"trusted-proxies": cfg.TrustedProxies,
+	} {
+		if _, err := parsePrefixes(list); err != nil {
+			fail("invalid --%s: %w", name, err)
+		}
+	}
+
+	if cfg.MetricsCert != "" || cfg.MetricsKey != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.MetricsCert, cfg.MetricsKey); err != nil {
+			fail("invalid --metrics-tls-cert or --metrics-tls-key: %w", err)
+		}
+	}
+
+	if cfg.MetricsOnMain && cfg.PrivateBind == "" && os.Getenv("DRAND_METRICS_TOKEN") == "" && os.Getenv("DRAND_METRICS_BASIC_AUTH") == "" {
+		fail("--metrics-on-main requires DRAND_METRICS_TOKEN or DRAND_METRICS_BASIC_AUTH to be set")
+	}
+
+	switch cfg.AccessLogFormat {
+	case AccessLogDefault, AccessLogECS, AccessLogCLF:
+	default:
+		fail("invalid --access-log-format %q, expected default, ecs or clf", cfg.AccessLogFormat)
+	}
+
+	if cfg.GeoIPDB != "" {
+		if _, err := newGeoIP(cfg.GeoIPDB, cfg.GeoIPByCountry, nil); err != nil {
+			fail("invalid --geoip-db: %w", err)
+		}
+	}
+
+	if cfg.AuthMode != "jwt" && cfg.AuthMode != "apikey" && cfg.AuthMode != "tenant" {
+		fail("invalid --auth-mode %q, expected jwt, apikey or tenant", cfg.AuthMode)
+	}
+	if cfg.RequireAuth {
+		switch cfg.AuthMode {
+		case "jwt":
+			if _, err := loadJWTSecret(cfg.AuthKeyFile); err != nil {
+				fail("invalid JWT secret: %w", err)
+			}
+		case "apikey":
+			if keys, err := loadAPIKeys(cfg.APIKeysFile); err != nil {
+				fail("invalid API keys: %w", err)
+			} else if len(keys) == 0 {
+				fail("no API keys provided using --api-keys or DRAND_API_KEYS")
+			}
+		case "tenant":
+			if _, err := loadTenants(cfg.TenantsFile); err != nil {
+				fail("invalid tenants: %w", err)
+			}
+		}
+	}
+
+	if cfg.TokenLimits != "" {
+		if f, err := os.Open(cfg.TokenLimits); err != nil {
+			fail("invalid --token-limits: %w", err)
+		} else {
+			if _, err := parseTokenLimits(f); err != nil {
+				fail("invalid --token-limits: %w", err)
+			}
+			f.Close()
+		}
+	}
+
+	if cfg.UsageExport != "" {
+		if cfg.UsageInterval <= 0 {
+			fail("--usage-interval must be positive to export the usage, got %s", cfg.UsageInterval)
+		}
+		if isUsageURL(cfg.UsageExport) {
+			if u, err := url.Parse(cfg.UsageExport); err != nil || u.Host == "" {
+				fail("invalid --usage-export %q", cfg.UsageExport)
+			}
+		}
+	}
+
+	if cfg.Chaos != "" {
+		if _, err := grpc.ParseChaos(cfg.Chaos); err != nil {
+			fail("invalid --chaos: %w", err)
+		}
+	}
+
+	if cfg.PurgeURL != "" {
+		if u, err := url.Parse(cfg.PurgeURL); err != nil || u.Host == "" {
+			fail("invalid --purge-url %q", cfg.PurgeURL)
+		}
+	}
+
+	if cfg.Upstream != "" {
+		if u, err := url.Parse(cfg.Upstream); err != nil || u.Host == "" {
+			fail("invalid --upstream %q", cfg.Upstream)
+		}
+	}
+
+	if cfg.ShadowURL != "" {
+		if u, err := url.Parse(cfg.ShadowURL); err != nil || u.Host == "" {
+			fail("invalid --shadow-url %q", cfg.ShadowURL)
+		}
+		if cfg.ShadowPercent < 0 || cfg.ShadowPercent > 100 {
+			fail("invalid --shadow-percent %v, it must be between 0 and 100", cfg.ShadowPercent)
+		}
+	}
+
+	if err := grpc.ValidateRetryPolicy(cfg.RetryPolicy); err != nil {
+		fail("invalid --grpc-retry-policy: %v", err)
+	}
+
+	if cfg.MaxInflightPerBackend < 0 {
+		fail("invalid --grpc-max-inflight %d, it can't be negative", cfg.MaxInflightPerBackend)
+	}
+
+	if cfg.ChannelzInterval < 0 {
+		fail("invalid --channelz-interval %s, it can't be negative", cfg.ChannelzInterval)
+	}
+
+	if cfg.ShutdownTimeout < 0 {
+		fail("invalid --shutdown-timeout %s, it can't be negative", cfg.ShutdownTimeout)
+	}
+
+	if dial && len(errs) == 0 {
+		for _, target := range targets {
+			if err := dryRunDial(target); err != nil {
+				fail("unable to reach %s: %w", target, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+// dryRunDial connects to the provided grpc target and lists its chains.
+func dryRunDial(target string) error {
+	c, err := grpc.NewClient(target, slog.Default())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chains, err := c.GetChains(ctx)
+	if err != nil {
+		return err
+	}
+	if len(chains) == 0 {
+		return errors.New("no chain served")
+	}
+	slog.Info("dry-run dial succeeded", "target", target, "chains", chains)
+	return nil
+}
@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfig(t *testing.T) {
+	t.Setenv("DRAND_METRICS_TOKEN", "")
+	t.Setenv("DRAND_METRICS_BASIC_AUTH", "")
+	config := func(grpcURL string) Config {
+		cfg := DefaultConfig()
+		cfg.GrpcConnect = grpcURL
+		return cfg
+	}
+
+	cfg := config("localhost:4444,pl1-rpc.testnet.drand.sh:443|10")
+	require.Empty(t, Check(cfg, false), "expected a valid configuration")
+
+	cfg = config("localhost")
+	cfg.Chaos = "latency=soon"
+	require.Len(t, Check(cfg, false), 2)
+
+	cfg = config("localhost:4444")
+	cfg.ShutdownTimeout = -time.Second
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.ChannelzInterval = -time.Second
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.UsageExport, cfg.UsageInterval = "https://", 0
+	require.Len(t, Check(cfg, false), 2)
+
+	cfg = config("localhost:4444")
+	cfg.AccessLogFormat = "apache"
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.GeoIPDB = "/nonexistent/GeoLite2-Country.mmdb"
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.MaxInflightPerBackend = -1
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.RetryPolicy = `{"maxAttempts":2}`
+	require.Len(t, Check(cfg, false), 1)
+
+	cfg = config("localhost:4444")
+	cfg.IPAllow = "10.0.0.0/33"
+	cfg.AuthMode = "basic"
+	require.Len(t, Check(cfg, false), 2)
+
+	cfg = config("localhost:4444")
+	cfg.MetricsOnMain = true
+	require.Len(t, Check(cfg, false), 1, "expected the public metrics to require authentication")
+	cfg.PrivateBind = "localhost:8081"
+	require.Empty(t, Check(cfg, false), "expected the metrics to be served on the private listener")
+}
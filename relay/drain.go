@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// drainer holds the context canceled on shutdown to wake up all the requests waiting for the next round of a Relay, so
+// that they don't block the graceful shutdown until the end of its grace period.
+type drainer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newDrainer() *drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &drainer{ctx: ctx, cancel: cancel}
+}
+
+// undrained is the drainer of the handlers served outside of a Relay, which are never drained.
+var undrained = newDrainer()
+
+// ShutdownTimeout is the default grace period given to the in-flight requests to complete when shutting down.
+var ShutdownTimeout = 30 * time.Second
+
+// drainDelay returns how long to wait before draining the waiters on shutdown: as long as the longest wait for a round
+// fits in the grace period, the waiters are served normally, otherwise they are drained right away.
+func (s *settings) drainDelay() time.Duration {
+	return max(s.shutdownTimeout-s.longPollWait, 0)
+}
+
+// untilDrained returns a copy of the request context that is also canceled when the waiters are drained.
+func (s *settings) untilDrained(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(s.drain.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// serveDrained replies to a request that was waiting for the next round when the relay started shutting down, with
+// the latest beacon observed by the hub if there is one, or with a 503 status and a Retry-After header otherwise.
+func (s *settings) serveDrained(w http.ResponseWriter, info *grpc.JsonInfoV2, hub *Hub, isV2 bool) {
+	w.Header().Set("Cache-Control", s.cacheNone)
+	if info != nil && hub != nil {
+		if round, json := hub.LatestJSON(info.Hash.String(), isV2); json != nil {
+			slog.Debug("[serveDrained] serving latest from hub on shutdown", "round", round)
+			w.Write(json)
+			return
+		}
+	}
+
+	retry := int64(1)
+	if info != nil {
+		nextTime, _ := info.ExpectedNext()
+		retry = max(nextTime-time.Now().Unix(), 1)
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+	http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,28 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDrained(t *testing.T) {
+	rec := httptest.NewRecorder()
+	packageSettings().serveDrained(rec, nil, nil, true)
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+}
+
+func TestDrainDelay(t *testing.T) {
+	s := &settings{longPollWait: 30 * time.Second}
+
+	s.shutdownTimeout = 30 * time.Second
+	require.Zero(t, s.drainDelay(), "expected the waiters to be drained right away")
+	s.shutdownTimeout = 10 * time.Second
+	require.Zero(t, s.drainDelay(), "expected the waiters to be drained right away")
+	s.shutdownTimeout = 2 * time.Minute
+	require.Equal(t, 90*time.Second, s.drainDelay(), "expected the waiters to be served within the grace period")
+}
@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which we don't return buffers to the pool, to avoid keeping huge buffers
+// around after an unusually large response.
+const maxPooledBuffer = 64 << 10
+
+// jsonBuffer is a pooled buffer along with its json encoder, to avoid allocating them on every request. The 512 bytes
+// limitBuffer the request logger tees every response into isn't pooled: it is unexported and allocated within
+// httplog.Handler, and forking that handler would lose the trace context httplog stores under its private keys.
+type jsonBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var jsonPool = sync.Pool{
+	New: func() any {
+		b := new(jsonBuffer)
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+// encodeJSON encodes v in json using a pooled buffer, producing the same output as json.Marshal. The returned buffer
+// must be released once written.
+func encodeJSON(v any) (*jsonBuffer, error) {
+	b := jsonPool.Get().(*jsonBuffer)
+	b.Reset()
+	if err := b.enc.Encode(v); err != nil {
+		b.release()
+		return nil, err
+	}
+	// json.Encoder adds a trailing newline that json.Marshal doesn't
+	b.Truncate(b.Len() - 1)
+	return b, nil
+}
+
+// release returns the buffer to the pool, it must not be used afterwards.
+func (b *jsonBuffer) release() {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	jsonPool.Put(b)
+}
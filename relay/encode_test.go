@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/stretchr/testify/require"
+)
+
+func testBeacon(b testing.TB) *grpc.HexBeacon {
+	sig, err := hex.DecodeString("9469186f38e5acdac451940b1b22f737eb0de060b213f0326166c7882f2f82b92ce119bdabe385941ef46f72736a4b4d02ce206e1eb46cac53019caf870080fede024edcd1bd0225eb1335b83002ae1743393e83180e47d9948ab8ba7568dd99")
+	if err != nil {
+		b.Fatal(err)
+	}
+	beacon := &grpc.HexBeacon{Round: 123, Signature: sig, PreviousSignature: sig}
+	beacon.SetRandomness()
+	return beacon
+}
+
+func TestEncodeJSON(t *testing.T) {
+	beacon := testBeacon(t)
+	expected, err := json.Marshal(beacon)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		buf, err := encodeJSON(beacon)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), buf.String(), "encodeJSON differs from json.Marshal")
+		buf.release()
+	}
+}
+
+// Before: json.Marshal allocating a new buffer on every request.
+func BenchmarkEncodeBeaconMarshal(b *testing.B) {
+	beacon := testBeacon(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		out, err := json.Marshal(beacon)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Discard.Write(out)
+	}
+}
+
+// After: encodeJSON reusing pooled buffers and encoders.
+func BenchmarkEncodeBeaconPooled(b *testing.B) {
+	beacon := testBeacon(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := encodeJSON(beacon)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Discard.Write(buf.Bytes())
+		buf.release()
+	}
+}
@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoRequests (HTTP) how many requests were received from each continent, or country
+var GeoRequests = defaultMetrics.geoRequests
+
+// geoInfo is the location of a client, as found in the GeoIP database. Its fields are empty when unknown.
+type geoInfo struct {
+	continent string
+	country   string
+}
+
+// geoRecord holds the fields of a GeoIP2 or GeoLite2 Country or City record used to locate the clients.
+type geoRecord struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// geoIP locates the clients using a MaxMind GeoIP2 or GeoLite2 Country or City database.
+type geoIP struct {
+	db        *maxminddb.Reader
+	byCountry bool
+	trusted   []netip.Prefix
+}
+
+// newGeoIP loads the MaxMind database at the provided path in memory, counting the requests by country rather than by
+// continent if byCountry is set.
+func newGeoIP(path string, byCountry bool, trusted []netip.Prefix) (*geoIP, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("[geoIP] loaded GeoIP database", "path", path, "type", db.Metadata.DatabaseType)
+	return &geoIP{db: db, byCountry: byCountry, trusted: trusted}, nil
+}
+
+// lookup returns the location of the provided address, which is empty if it isn't in the database.
+func (g *geoIP) lookup(addr netip.Addr) geoInfo {
+	var rec geoRecord
+	if err := g.db.Lookup(addr.Unmap().AsSlice(), &rec); err != nil {
+		slog.Debug("[geoIP] lookup failed", "addr", addr, "err", err)
+		return geoInfo{}
+	}
+	info := geoInfo{continent: rec.Continent.Code, country: rec.Country.ISOCode}
+	if info.country == "" {
+		// the anonymous proxies and satellite providers only have a registered country
+		info.country = rec.RegisteredCountry.ISOCode
+	}
+	return info
+}
+
+// label returns the label of the location in GeoRequests, either its continent or its country.
+func (g *geoIP) label(info geoInfo) string {
+	label := info.continent
+	if g.byCountry {
+		label = info.country
+	}
+	if label == "" {
+		return "unknown"
+	}
+	return label
+}
+
+// enrichGeo locates the client of every request, counting it in GeoRequests and adding its location to the request
+// log entry. It must be used after the request loggers.
+func enrichGeo(g *geoIP) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var info geoInfo
+			if addr, err := clientIP(r, g.trusted); err == nil {
+				info = g.lookup(addr)
+			}
+			settingsOf(r).metrics.geoRequests.WithLabelValues(g.label(info)).Inc()
+			if info != (geoInfo{}) {
+				httplog.LogEntrySetField(r.Context(), "geo", slog.GroupValue(
+					slog.String("continent", info.continent),
+					slog.String("country", info.country),
+				))
+				setAccessGeo(r, info)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// the MaxMind DB data types and metadata marker used by mmdbEncode and buildMMDB
+const (
+	mmdbString = 2
+	mmdbUint32 = 6
+	mmdbMap    = 7
+)
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbEncode encodes the provided strings, uint32 and maps in the MaxMind DB data format, they must be small.
+func mmdbEncode(v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return append([]byte{mmdbString<<5 | byte(len(v))}, v...)
+	case uint32:
+		return []byte{mmdbUint32<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b := []byte{mmdbMap<<5 | byte(len(v))}
+		for _, k := range keys {
+			b = append(b, mmdbEncode(k)...)
+			b = append(b, mmdbEncode(v[k])...)
+		}
+		return b
+	}
+	panic("unsupported value")
+}
+
+// buildMMDB returns an IPv6 MaxMind DB with 24 bits records holding the provided record for the prefix only.
+func buildMMDB(prefix netip.Prefix, record map[string]any) []byte {
+	ip := prefix.Addr().As16()
+	bits := prefix.Bits()
+	nodeCount := uint32(bits)
+	var tree []byte
+	put := func(rec uint32) {
+		tree = append(tree, byte(rec>>16), byte(rec>>8), byte(rec))
+	}
+	for i := 0; i < bits; i++ {
+		next := uint32(i + 1)
+		if i == bits-1 {
+			// the data section starts with the record
+			next = nodeCount + 16
+		}
+		if ip[i/8]>>(7-i%8)&1 == 0 {
+			put(next)
+			put(nodeCount)
+		} else {
+			put(nodeCount)
+			put(next)
+		}
+	}
+
+	buf := append(tree, make([]byte, 16)...)
+	buf = append(buf, mmdbEncode(record)...)
+	buf = append(buf, mmdbMetadataMarker...)
+	meta := mmdbEncode(map[string]any{
+		"binary_format_major_version": uint32(2),
+		"node_count":                  nodeCount,
+		"record_size":                 uint32(24),
+		"ip_version":                  uint32(6),
+		"database_type":               "GeoLite2-Country",
+	})
+	return append(buf, meta...)
+}
+
+func newTestGeoIP(t *testing.T, byCountry bool) *geoIP {
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	require.NoError(t, os.WriteFile(path, buildMMDB(netip.MustParsePrefix("::192.0.2.0/120"), map[string]any{
+		"continent": map[string]any{"code": "EU", "geoname_id": uint32(6255148)},
+		"country":   map[string]any{"iso_code": "FR", "geoname_id": uint32(3017382)},
+	}), 0o600))
+	g, err := newGeoIP(path, byCountry, nil)
+	require.NoError(t, err)
+	return g
+}
+
+func TestGeoIPLookup(t *testing.T) {
+	g := newTestGeoIP(t, false)
+	require.Equal(t, "GeoLite2-Country", g.db.Metadata.DatabaseType)
+	require.Equal(t, geoInfo{continent: "EU", country: "FR"}, g.lookup(netip.MustParseAddr("192.0.2.1")))
+	require.Equal(t, geoInfo{continent: "EU", country: "FR"}, g.lookup(netip.MustParseAddr("::ffff:192.0.2.200")))
+	require.Equal(t, geoInfo{}, g.lookup(netip.MustParseAddr("198.51.100.1")))
+	require.Equal(t, geoInfo{}, g.lookup(netip.MustParseAddr("2001:db8::1")))
+	require.Equal(t, "EU", g.label(geoInfo{continent: "EU", country: "FR"}))
+	require.Equal(t, "unknown", g.label(geoInfo{}))
+
+	path := filepath.Join(t.TempDir(), "invalid.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+	_, err := newGeoIP(path, false, nil)
+	require.Error(t, err)
+}
+
+func TestEnrichGeo(t *testing.T) {
+	g := newTestGeoIP(t, true)
+	fr, unknown := testutil.ToFloat64(GeoRequests.WithLabelValues("FR")), testutil.ToFloat64(GeoRequests.WithLabelValues("unknown"))
+
+	var buf bytes.Buffer
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := accessLogger(AccessLogECS, &buf, nil, 1, nil, nil)(enrichGeo(g)(ok))
+	for _, addr := range []string{"192.0.2.1:1234", "198.51.100.1:1234"} {
+		r := httptest.NewRequest(http.MethodGet, "/public/latest", nil)
+		r.RemoteAddr = addr
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	require.Equal(t, fr+1, testutil.ToFloat64(GeoRequests.WithLabelValues("FR")))
+	require.Equal(t, unknown+1, testutil.ToFloat64(GeoRequests.WithLabelValues("unknown")))
+
+	var doc struct {
+		Client struct {
+			Geo *struct {
+				ContinentCode  string `json:"continent_code"`
+				CountryISOCode string `json:"country_iso_code"`
+			} `json:"geo"`
+		} `json:"client"`
+	}
+	dec := json.NewDecoder(&buf)
+	require.NoError(t, dec.Decode(&doc))
+	require.NotNil(t, doc.Client.Geo)
+	require.Equal(t, "EU", doc.Client.Geo.ContinentCode)
+	require.Equal(t, "FR", doc.Client.Geo.CountryISOCode)
+	doc.Client.Geo = nil
+	require.NoError(t, dec.Decode(&doc))
+	require.Nil(t, doc.Client.Geo, "the unknown clients have no location")
+}
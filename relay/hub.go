@@ -0,0 +1,239 @@
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+)
+
+// Prefetch makes the hubs fetch every round from the backends as soon as it is expected rather than waiting for the
+// beacon streams to deliver it by default, so that the flood of requests for the latest beacon at the round boundary
+// is served from memory.
+var Prefetch bool
+
+// prefetchRetry is the delay between the attempts to prefetch a round the backends don't have yet.
+const prefetchRetry = 100 * time.Millisecond
+
+// Hub keeps track of the latest beacon of every chain served by the relay, by watching the beacon streams of the
+// backends. It allows to know about new rounds without querying the backends on every request.
+type Hub struct {
+	c BeaconProvider
+	// prefetchRounds and frontrun are the Prefetch and FrontrunTiming settings of the hub
+	prefetchRounds bool
+	frontrun       time.Duration
+
+	mu      sync.RWMutex
+	latest  map[string]*observedBeacon
+	updates map[string]chan struct{}
+	hooks   []func(chain string, beacon *grpc.HexBeacon)
+}
+
+// observedBeacon is a beacon along with the time at which the hub received it. It also holds its precomputed json
+// encodings for the v1 and v2 APIs, so that they are marshaled only once per round.
+type observedBeacon struct {
+	beacon *grpc.HexBeacon
+	at     time.Time
+	jsonV1 []byte
+	jsonV2 []byte
+}
+
+func newObservedBeacon(beacon *grpc.HexBeacon) *observedBeacon {
+	o := &observedBeacon{beacon: beacon, at: time.Now()}
+
+	v1 := *beacon
+	v1.SetRandomness()
+	v2 := *beacon
+	v2.UnsetRandomness()
+
+	var err error
+	if o.jsonV1, err = json.Marshal(&v1); err != nil {
+		slog.Error("[Hub] unable to encode v1 beacon in json", "round", beacon.Round, "err", err)
+	}
+	if o.jsonV2, err = json.Marshal(&v2); err != nil {
+		slog.Error("[Hub] unable to encode v2 beacon in json", "round", beacon.Round, "err", err)
+	}
+	return o
+}
+
+// NewHub returns a Hub for the provided BeaconProvider, it needs to be started using Start.
+func NewHub(c BeaconProvider) *Hub {
+	return &Hub{
+		c:              c,
+		prefetchRounds: Prefetch,
+		frontrun:       FrontrunTiming,
+		latest:         make(map[string]*observedBeacon),
+		updates:        make(map[string]chan struct{}),
+	}
+}
+
+// OnNewRound registers a hook called in its own goroutine with the hex-encoded chainhash and the beacon every time a
+// new round is observed. It must be called before Start.
+func (h *Hub) OnNewRound(hook func(chain string, beacon *grpc.HexBeacon)) {
+	h.hooks = append(h.hooks, hook)
+}
+
+// Start watches all the chains currently available on the backends until the context is canceled.
+func (h *Hub) Start(ctx context.Context) error {
+	chains, err := h.c.GetChains(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, chain := range chains {
+		hash, err := hex.DecodeString(chain)
+		if err != nil {
+			slog.Error("[Hub] invalid chainhash", "chain", chain, "err", err)
+			continue
+		}
+		m := &proto.Metadata{ChainHash: hash}
+		go h.watch(ctx, chain, m)
+		if h.prefetchRounds {
+			go h.prefetch(ctx, chain, m)
+		}
+	}
+
+	return nil
+}
+
+// watch keeps watching the provided chain, re-establishing the stream when it fails, until the context is canceled.
+func (h *Hub) watch(ctx context.Context, chain string, m *proto.Metadata) {
+	for ctx.Err() == nil {
+		slog.Debug("[Hub] watching chain", "chain", chain)
+		for beacon := range h.c.Watch(ctx, m) {
+			h.observe(chain, beacon)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			slog.Warn("[Hub] watch stream closed, retrying", "chain", chain)
+		}
+	}
+}
+
+// observe records the provided beacon as the latest one of the chain, unless a newer round was already observed, and
+// notifies the waiters and hooks if its round is new.
+func (h *Hub) observe(chain string, beacon *grpc.HexBeacon) {
+	o := newObservedBeacon(beacon)
+	h.mu.Lock()
+	prev, ok := h.latest[chain]
+	if ok && prev.beacon.Round > beacon.Round {
+		// the prefetch and the stream race each other, the late one mustn't go back in time
+		h.mu.Unlock()
+		return
+	}
+	isNew := !ok || prev.beacon.Round < beacon.Round
+	h.latest[chain] = o
+	if ch, ok := h.updates[chain]; ok && isNew {
+		close(ch)
+		delete(h.updates, chain)
+	}
+	h.mu.Unlock()
+
+	if isNew {
+		for _, hook := range h.hooks {
+			go hook(chain, beacon)
+		}
+	}
+}
+
+// prefetch fetches every round of the provided chain from the backends as soon as it is expected, minus the frontrun
+// timing of the hub, until the context is canceled.
+func (h *Hub) prefetch(ctx context.Context, chain string, m *proto.Metadata) {
+	var round uint64
+	for ctx.Err() == nil {
+		info, err := h.c.GetChainInfo(ctx, m)
+		if err != nil {
+			slog.Warn("[Hub] unable to get chain info to prefetch rounds", "chain", chain, "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		_, next := info.ExpectedNext()
+		round = max(round+1, next)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(time.Unix(info.RoundTime(round), 0)) - h.frontrun):
+		}
+		h.prefetchRound(ctx, chain, m, round, time.Duration(info.Period)*time.Second)
+	}
+}
+
+// prefetchRound keeps asking the backends for the provided round until they have it or the stream delivered it, for
+// up to a period.
+func (h *Hub) prefetchRound(ctx context.Context, chain string, m *proto.Metadata, round uint64, period time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, period)
+	defer cancel()
+	for {
+		if latest, _ := h.Latest(chain); latest != nil && latest.Round >= round {
+			return
+		}
+		if beacon, err := h.c.GetBeacon(ctx, m, round); err == nil {
+			slog.Debug("[Hub] prefetched round", "chain", chain, "round", round)
+			h.observe(chain, beacon)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Warn("[Hub] unable to prefetch round", "chain", chain, "round", round)
+			return
+		case <-time.After(prefetchRetry):
+		}
+	}
+}
+
+// Latest returns the latest beacon observed for the provided hex-encoded chainhash and when it was observed, or nil if
+// none was observed yet.
+func (h *Hub) Latest(chain string) (*grpc.HexBeacon, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	o, ok := h.latest[chain]
+	if !ok {
+		return nil, time.Time{}
+	}
+	return o.beacon, o.at
+}
+
+// Updated returns a channel closed once a new round is observed for the provided hex-encoded chainhash.
+func (h *Hub) Updated(chain string) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.updates[chain]
+	if !ok {
+		ch = make(chan struct{})
+		h.updates[chain] = ch
+	}
+	return ch
+}
+
+// LatestJSON returns the precomputed json encoding of the latest beacon observed for the provided hex-encoded
+// chainhash, along with its round, or nil if none is available.
+func (h *Hub) LatestJSON(chain string, isV2 bool) (uint64, []byte) {
+	round, json, _ := h.latestJSON(chain, isV2)
+	return round, json
+}
+
+// latestJSON is LatestJSON also returning when the beacon was observed.
+func (h *Hub) latestJSON(chain string, isV2 bool) (uint64, []byte, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	o, ok := h.latest[chain]
+	if !ok {
+		return 0, nil, time.Time{}
+	}
+	if isV2 {
+		return o.beacon.Round, o.jsonV2, o.at
+	}
+	return o.beacon.Round, o.jsonV1, o.at
+}
@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubPrefetch(t *testing.T) {
+	mock, addr, err := grpc.StartMockBackend("localhost:0", time.Now().Add(-time.Hour), 3*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(mock.Stop)
+
+	c, err := grpc.NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	client := grpc.NewBackends(c, slog.Default())
+	t.Cleanup(func() { client.Close() })
+
+	chains, err := client.GetChains(context.Background())
+	require.NoError(t, err)
+	require.Len(t, chains, 1, "expected the mock chain only")
+	hash, err := hex.DecodeString(chains[0])
+	require.NoError(t, err)
+	m := &proto.Metadata{ChainHash: hash}
+	info, err := client.GetChainInfo(context.Background(), m)
+	require.NoError(t, err)
+	_, next := info.ExpectedNext()
+
+	// only the prefetch is running, the hub doesn't watch the beacon streams
+	hub := NewHub(client)
+	updated := hub.Updated(chains[0])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.prefetch(ctx, chains[0], m)
+
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the next round to be prefetched")
+	}
+	latest, _ := hub.Latest(chains[0])
+	require.Equal(t, next, latest.Round)
+
+	// a late beacon doesn't replace the prefetched one
+	hub.observe(chains[0], &grpc.HexBeacon{Round: next - 1})
+	latest, _ = hub.Latest(chains[0])
+	require.Equal(t, next, latest.Round)
+}
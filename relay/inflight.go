@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+)
+
+// inflightLimiter limits the number of requests served at the same time, per client IP and globally, so that a single
+// misbehaving client can't exhaust the goroutines and file descriptors of the relay. A zero limit means unlimited.
+type inflightLimiter struct {
+	perIP  int
+	global int
+
+	mu    sync.Mutex
+	total int
+	byIP  map[netip.Addr]int
+
+	metrics *relayMetrics
+}
+
+func newInflightLimiter(perIP, global int, m *relayMetrics) *inflightLimiter {
+	return &inflightLimiter{
+		perIP:   perIP,
+		global:  global,
+		byIP:    make(map[netip.Addr]int),
+		metrics: m,
+	}
+}
+
+// acquire registers a new request from the provided client, returning false along with the class of the limit that
+// was reached if it can't be served now.
+func (l *inflightLimiter) acquire(addr netip.Addr) (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.global > 0 && l.total >= l.global {
+		return false, "inflight"
+	}
+	if l.perIP > 0 && l.byIP[addr] >= l.perIP {
+		return false, "inflight_ip"
+	}
+	l.total++
+	l.byIP[addr]++
+	l.metrics.rateLimitKeys.WithLabelValues("inflight_ip").Set(float64(len(l.byIP)))
+	return true, ""
+}
+
+// release unregisters a request acquired for the provided client.
+func (l *inflightLimiter) release(addr netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	l.byIP[addr]--
+	if l.byIP[addr] <= 0 {
+		delete(l.byIP, addr)
+	}
+	l.metrics.rateLimitKeys.WithLabelValues("inflight_ip").Set(float64(len(l.byIP)))
+}
+
+// limitInflight is returning a 503 status for the requests exceeding the limits of concurrent requests per client IP
+// or globally, relying on the trusted proxies to find the client IP. It is a no-op if both limits are unlimited.
+func limitInflight(l *inflightLimiter, trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l.perIP <= 0 && l.global <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// requests whose client can't be identified all share the zero address
+			addr, _ := clientIP(r, trusted)
+			ok, class := l.acquire(addr)
+			if !ok {
+				l.metrics.rateLimitRequests.WithLabelValues(class, "rejected").Inc()
+				slog.Warn("[limitInflight] too many concurrent requests", "from", addr, "limit", class)
+				w.Header().Set("Cache-Control", settingsOf(r).cacheNone)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+			defer l.release(addr)
+
+			l.metrics.rateLimitRequests.WithLabelValues("inflight", "allowed").Inc()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightLimiter(t *testing.T) {
+	a, b := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	l := newInflightLimiter(2, 3, defaultMetrics)
+
+	ok, _ := l.acquire(a)
+	require.True(t, ok)
+	ok, _ = l.acquire(a)
+	require.True(t, ok, "expected to acquire up to the per IP limit")
+	ok, class := l.acquire(a)
+	require.False(t, ok, "expected the third request of a client to be rejected")
+	require.Equal(t, "inflight_ip", class)
+
+	ok, _ = l.acquire(b)
+	require.True(t, ok, "expected the per IP limit to be per client")
+	ok, class = l.acquire(b)
+	require.False(t, ok, "expected the global limit to apply")
+	require.Equal(t, "inflight", class)
+
+	l.release(a)
+	ok, _ = l.acquire(b)
+	require.True(t, ok, "expected a released request to make room")
+	l.release(a)
+	require.NotContains(t, l.byIP, a)
+}
+
+func TestLimitInflight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := limitInflight(newInflightLimiter(1, 0, defaultMetrics), nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/chains", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	<-started
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	close(release)
+	<-done
+	go func() { <-started }()
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+}
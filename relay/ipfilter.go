@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parsePrefixes parses a comma separated list of CIDRs or single IP addresses.
+func parsePrefixes(list string) ([]netip.Prefix, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address %q: %w", s, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed returns whether the address is allowed by the IP filtering lists: it must not be in the deny list, and it
+// must be in the allow list unless it is empty.
+func ipAllowed(allow, deny []netip.Prefix, addr netip.Addr) bool {
+	return !containsAddr(deny, addr) && (len(allow) == 0 || containsAddr(allow, addr))
+}
+
+// clientIP returns the IP address of the client making the request. The X-Forwarded-For header is only honored when
+// the request comes from one of the trusted proxies, in which case the right-most address that isn't a trusted proxy
+// is the client.
+func clientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !containsAddr(trusted, addr) {
+		return addr, nil
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// we can't trust anything further left than an invalid hop
+			break
+		}
+		addr = hop
+		if !containsAddr(trusted, hop) {
+			break
+		}
+	}
+	return addr, nil
+}
+
+// ipFilter is rejecting the requests from clients in the deny list, or not in the allow list if it isn't empty, with
+// a 403 status.
+func ipFilter(allow, deny, trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allow) == 0 && len(deny) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, err := clientIP(r, trusted)
+			if err != nil {
+				slog.Error("[ipFilter] unable to parse client address", "from", r.RemoteAddr, "error", err)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			if !ipAllowed(allow, deny, addr) {
+				slog.Debug("[ipFilter] rejected request", "client", addr, "uri", r.RequestURI)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parsePrefixes("10.0.0.0/8,192.168.1.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		{"direct", "1.2.3.4:1234", "", "1.2.3.4"},
+		{"untrusted proxy", "1.2.3.4:1234", "5.6.7.8", "1.2.3.4"},
+		{"trusted proxy", "10.1.2.3:1234", "5.6.7.8", "5.6.7.8"},
+		{"spoofed hop", "10.1.2.3:1234", "9.9.9.9, 5.6.7.8", "5.6.7.8"},
+		{"chained proxies", "192.168.1.1:1234", "5.6.7.8, 10.0.0.1", "5.6.7.8"},
+		{"invalid hop", "10.1.2.3:1234", "garbage", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			got, err := clientIP(r, trusted)
+			require.NoError(t, err)
+			require.Equal(t, netip.MustParseAddr(tt.expected), got)
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := parsePrefixes("10.0.0.1/8, 2001:db8::1")
+	require.NoError(t, err)
+	require.True(t, containsAddr(prefixes, netip.MustParseAddr("10.200.0.1")), "expected 10.200.0.1 to be in 10.0.0.0/8")
+	require.True(t, containsAddr(prefixes, netip.MustParseAddr("::ffff:10.0.0.2")), "expected IPv4-mapped addresses to match")
+	require.False(t, containsAddr(prefixes, netip.MustParseAddr("2001:db8::2")), "expected a single IP to only match itself")
+
+	_, err = parsePrefixes("10.0.0.0/33")
+	require.Error(t, err, "expected an error for an invalid CIDR")
+}
@@ -0,0 +1,138 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// rotationFormat is the timestamp suffix of the rotated log files, it sorts lexically in chronological order.
+const rotationFormat = "20060102T150405.000"
+
+// rotatingFile is a log file rotated once it reaches maxSize bytes or once it is older than every, keeping at most
+// maxBackups rotated files. Rotation based on size or age is disabled when the respective value is 0.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, every time.Duration, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		every:      every,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.every > 0 && time.Since(r.opened) >= r.every
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to stat log file: %w", err)
+	}
+
+	r.f = f
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, r.path+"."+time.Now().Format(rotationFormat)); err != nil {
+		return fmt.Errorf("unable to rotate log file: %w", err)
+	}
+	r.prune()
+	return r.open()
+}
+
+// prune removes the oldest rotated files, keeping only maxBackups of them. Errors are ignored since we can't log them.
+func (r *rotatingFile) prune() {
+	if r.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil || len(backups) <= r.maxBackups {
+		return
+	}
+	slices.Sort(backups)
+	for _, old := range backups[:len(backups)-r.maxBackups] {
+		os.Remove(old)
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// LogOutput returns the writer the logs should go to, according to the LogFile and Syslog settings. It defaults to
+// stdout.
+func LogOutput(cfg Config) (io.Writer, error) {
+	var out io.Writer = os.Stdout
+	if cfg.LogFile != "" {
+		f, err := newRotatingFile(cfg.LogFile, cfg.LogMaxSize<<20, cfg.LogRotate, cfg.LogBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+
+	if cfg.Syslog != "" {
+		sink, err := newSyslogWriter(cfg.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		out = io.MultiWriter(out, sink)
+	}
+
+	return out, nil
+}
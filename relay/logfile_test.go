@@ -0,0 +1,46 @@
+package relay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.log")
+	f, err := newRotatingFile(path, 10, 0, 2)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte("12345678\n"))
+		require.NoError(t, err)
+		// making sure the rotated files get distinct names
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, backups, 2, "expected 2 rotated files")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "12345678\n", string(content), "expected the current file to only hold the last write")
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.log")
+	f, err := newRotatingFile(path, 0, time.Millisecond, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	time.Sleep(5 * time.Millisecond)
+	f.Write([]byte("second\n"))
+
+	backups, _ := filepath.Glob(path + ".*")
+	require.Len(t, backups, 1, "expected 1 rotated file")
+}
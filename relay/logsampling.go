@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v2"
+)
+
+// sampledRequestLogger is the httplog request logger, except that only 1 in every `every` successful requests whose
+// path contains one of the provided routes is fully logged. Failed requests are always logged, the unsampled ones with
+// a concise entry. Sampling is disabled when every is 1 or less. Requests on the skipPaths are never logged.
+func sampledRequestLogger(logger *httplog.Logger, every uint64, routes, skipPaths []string) func(next http.Handler) http.Handler {
+	requestLogger := httplog.Handler(logger, skipPaths)
+	var count atomic.Uint64
+
+	return func(next http.Handler) http.Handler {
+		logged := requestLogger(next)
+		if every <= 1 || len(routes) == 0 {
+			return logged
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(skipPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !sampledRoute(r.URL.Path, routes) || count.Add(1)%every == 0 {
+				logged.ServeHTTP(w, r)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			next.ServeHTTP(ww, r)
+
+			if status := ww.Status(); status >= http.StatusBadRequest {
+				level := slog.LevelWarn
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+				logger.Log(r.Context(), level, fmt.Sprintf("Response: %d %s", status, http.StatusText(status)),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"status", status,
+					"elapsed", float64(time.Since(start).Nanoseconds())/1e6,
+				)
+			}
+		})
+	}
+}
+
+func sampledRoute(path string, routes []string) bool {
+	for _, route := range routes {
+		if strings.Contains(path, route) {
+			return true
+		}
+	}
+	return false
+}
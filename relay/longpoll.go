@@ -0,0 +1,149 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+)
+
+// LongPollWait is the default maximum time a request for the latest beacon using the after query parameter waits for a
+// newer round before getting a 204 status.
+var LongPollWait = 30 * time.Second
+
+// flightTimeout bounds the fetch of the latest beacon shared by the long polls, since it doesn't depend on any of them.
+const flightTimeout = 5 * time.Second
+
+// flight is a fetch of the latest beacon of a chain, shared by the long polls needing it at the same time.
+type flight struct {
+	done   chan struct{}
+	beacon *grpc.HexBeacon
+	err    error
+	// shared is the number of long polls waiting for the result of the flight besides the one that started it
+	shared int
+}
+
+// flights coalesces the concurrent fetches of the latest beacon of each chain, so that the long polls waiting on a
+// lagging hub don't all query the backends at once when the next round is due.
+type flights struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+var latestFlights = &flights{calls: make(map[string]*flight)}
+
+// do calls fetch for the provided hex-encoded chainhash, unless a call for that chain is already in flight, and waits
+// for its result or until the context is done. The fetch runs under its own context, bounded by flightTimeout, so
+// that a long poll giving up doesn't cancel it for the others waiting on it.
+func (f *flights) do(ctx context.Context, chain string, fetch func(context.Context) (*grpc.HexBeacon, error)) (*grpc.HexBeacon, error) {
+	f.mu.Lock()
+	call, ok := f.calls[chain]
+	if ok {
+		call.shared++
+	} else {
+		call = &flight{done: make(chan struct{})}
+		f.calls[chain] = call
+		go f.run(chain, call, fetch)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.beacon, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run does the fetch of the provided flight and publishes its result.
+func (f *flights) run(chain string, call *flight, fetch func(context.Context) (*grpc.HexBeacon, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), flightTimeout)
+	defer cancel()
+	call.beacon, call.err = fetch(ctx)
+
+	f.mu.Lock()
+	delete(f.calls, chain)
+	slog.Debug("[GetLatest] fetched the latest beacon for long polls", "chainhash", chain, "shared", call.shared, "err", call.err)
+	f.mu.Unlock()
+	close(call.done)
+}
+
+// awaitRoundAfter returns the v2 json encoding of the latest beacon of the chain once its round is greater than after,
+// relying on the hub when it is up-to-date and on the backends otherwise. It waits until the context is done.
+func awaitRoundAfter(ctx context.Context, c BeaconProvider, hub *Hub, m *proto.Metadata, info *grpc.JsonInfoV2, after uint64) (uint64, []byte, error) {
+	chain := info.Hash.String()
+	for {
+		// subscribing before checking, so that we can't miss a round observed in between
+		updated := hub.Updated(chain)
+		nextTime, next := info.ExpectedNext()
+
+		round, json := hub.LatestJSON(chain, true)
+		if json != nil && round > after {
+			return round, json, nil
+		}
+		if json == nil || round < next-1 {
+			// the hub is lagging, the backends may know better
+			beacon, err := latestFlights.do(ctx, chain, func(ctx context.Context) (*grpc.HexBeacon, error) {
+				return c.GetBeacon(ctx, m, 0)
+			})
+			if err == nil && beacon.Round > after {
+				return beacon.Round, newObservedBeacon(beacon).jsonV2, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-updated:
+		case <-time.After(max(time.Until(time.Unix(nextTime, 0)), 500*time.Millisecond)):
+		}
+	}
+}
+
+// serveLongPoll replies to a request for the latest beacon with the after query parameter, waiting up to the long poll
+// wait for a round greater than after to exist. It replies with a 204 status if there is none by then.
+func serveLongPoll(w http.ResponseWriter, r *http.Request, c BeaconProvider, hub *Hub, m *proto.Metadata, info *grpc.JsonInfoV2) {
+	s := settingsOf(r)
+	w.Header().Set("Cache-Control", s.cacheNone)
+	after, err := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+	if err != nil {
+		http.Error(w, "Failed to parse after. Err: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chain := info.Hash.String()
+	if !s.waiters.acquire(chain, s.maxWaiters) {
+		slog.Warn("[GetLatest] too many requests waiting for a newer round", "chainhash", chain, "max", s.maxWaiters)
+		s.tooManyWaiters(w, info)
+		return
+	}
+	defer s.waiters.release(chain)
+
+	ctx, cancel := s.untilDrained(r.Context())
+	defer cancel()
+	ctx, cancelWait := context.WithTimeout(ctx, s.longPollWait)
+	defer cancelWait()
+
+	start := time.Now()
+	round, json, err := awaitRoundAfter(ctx, c, hub, m, info, after)
+	recordTiming(r, timingWait, start)
+	switch {
+	case err == nil:
+		slog.Debug("[GetLatest] long poll served", "after", after, "round", round)
+		s.setSurrogateKeys(w, chain, "latest", strconv.FormatUint(round, 10))
+		w.Write(json)
+	case r.Context().Err() != nil:
+		http.Error(w, "timeout", http.StatusGatewayTimeout)
+	case s.drain.ctx.Err() != nil:
+		s.serveDrained(w, info, hub, true)
+	default:
+		// no round greater than after exists yet. The condition is on the round rather than on a representation the
+		// client has cached using HTTP validators, so this is a 204 rather than a 304
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
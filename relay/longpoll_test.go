@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightsCoalesce(t *testing.T) {
+	f := &flights{calls: make(map[string]*flight)}
+	release := make(chan struct{})
+	var calls int
+	fetch := func(context.Context) (*grpc.HexBeacon, error) {
+		calls++
+		<-release
+		return &grpc.HexBeacon{Round: 42}, nil
+	}
+
+	var wg sync.WaitGroup
+	rounds := make(chan uint64, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			beacon, err := f.do(context.Background(), "chain", fetch)
+			if assert.NoError(t, err) {
+				rounds <- beacon.Round
+			}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		call, ok := f.calls["chain"]
+		return ok && call.shared == 9
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(rounds)
+
+	require.Equal(t, 1, calls, "the concurrent fetches of a chain must be coalesced")
+	require.Len(t, rounds, 10)
+	for round := range rounds {
+		require.Equal(t, uint64(42), round)
+	}
+	require.Empty(t, f.calls)
+}
+
+func TestFlightsDetached(t *testing.T) {
+	f := &flights{calls: make(map[string]*flight)}
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*grpc.HexBeacon, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &grpc.HexBeacon{Round: 42}, nil
+	}
+
+	// the long poll starting the flight gives up before it completes
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := f.do(ctx, "chain", fetch)
+		first <- err
+	}()
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, ok := f.calls["chain"]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	second := make(chan *grpc.HexBeacon, 1)
+	go func() {
+		beacon, err := f.do(context.Background(), "chain", fetch)
+		if assert.NoError(t, err) {
+			second <- beacon
+		}
+	}()
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.calls["chain"].shared == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+
+	// the other long poll still gets the result of the flight
+	select {
+	case beacon := <-second:
+		require.Equal(t, uint64(42), beacon.Round)
+	case <-time.After(time.Second):
+		t.Fatal("the flight was canceled along with the long poll that started it")
+	}
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LongPollMax = 100 * time.Millisecond
+	url, chain := newTestRelay(t, cfg)
+	resp := getJSON(t, url+"/v2/chains/"+chain+"/rounds/latest?after=100000000", http.StatusNoContent, nil)
+	require.Equal(t, CacheNone, resp.Header.Get("Cache-Control"))
+}
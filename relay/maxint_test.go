@@ -0,0 +1,36 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMaxInt(t *testing.T) {
+	hits := testutil.ToFloat64(MaxIntRequests)
+	w := httptest.NewRecorder()
+	sendMaxInt()(w, httptest.NewRequest(http.MethodGet, "/public/18446744073709551615", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "<html>")
+	require.Equal(t, hits+1, testutil.ToFloat64(MaxIntRequests))
+
+	cfg := DefaultConfig()
+	cfg.MaxIntJSON, cfg.MaxIntDelay = true, 50*time.Millisecond
+	w = httptest.NewRecorder()
+	start := time.Now()
+	withSettings(newSettings(&cfg, defaultMetrics))(http.HandlerFunc(sendMaxInt())).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public/18446744073709551615", nil))
+	require.GreaterOrEqual(t, time.Since(start), cfg.MaxIntDelay)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp struct {
+		Error string `json:"error"`
+		Round uint64 `json:"round"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, uint64(18446744073709551615), resp.Round)
+	require.NotEmpty(t, resp.Error)
+}
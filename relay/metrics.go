@@ -0,0 +1,251 @@
+package relay
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTPMetrics about the public surface area (http requests, cdn stuff)
+	HTTPMetrics = prometheus.NewRegistry()
+
+	// HTTPCallCounter (HTTP) how many http requests
+	HTTPCallCounter = defaultMetrics.callCounter
+
+	// HTTPLatency (HTTP) how long http request handling takes
+	HTTPLatency = defaultMetrics.latency
+
+	// HTTPInFlight (HTTP) how many http requests exist
+	HTTPInFlight = defaultMetrics.inFlight
+
+	// BuildInfo (HTTP) which relay version is running, always set to 1
+	BuildInfo = defaultMetrics.buildInfo
+)
+
+// relayMetrics are the collectors a Relay records its metrics into. The relays using the same registry share them,
+// the ones of HTTPMetrics being the package variables such as HTTPCallCounter.
+type relayMetrics struct {
+	callCounter       *prometheus.CounterVec
+	latency           *prometheus.HistogramVec
+	inFlight          prometheus.Gauge
+	apiKeyRequests    *prometheus.CounterVec
+	tenantRequests    *prometheus.CounterVec
+	tenantBytes       *prometheus.CounterVec
+	rateLimitRequests *prometheus.CounterVec
+	rateLimitKeys     *prometheus.GaugeVec
+	upstreamRequests  *prometheus.CounterVec
+	shadowRequests    *prometheus.CounterVec
+	shedRequests      *prometheus.CounterVec
+	maxIntRequests    prometheus.Counter
+	geoRequests       *prometheus.CounterVec
+	buildInfo         *prometheus.GaugeVec
+}
+
+// defaultMetrics are the collectors registered on HTTPMetrics, also used by the handlers served outside of a Relay.
+var defaultMetrics = newRelayMetrics()
+
+// newRelayMetrics returns new collectors for the http metrics, not registered anywhere yet.
+func newRelayMetrics() *relayMetrics {
+	return &relayMetrics{
+		callCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_call_counter",
+			Help: "Number of HTTP calls received",
+		}, []string{"code", "method"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "http_response_duration",
+			Help: "histogram of request latencies",
+			// Based on our current AWS same region latency:
+			//  P50       P75      P90       P95      P99      P99.9     P99.99
+			//  1.094ms  6.62ms  17.886ms  25.78ms  48.124ms  81.533ms  123.466ms
+			// with extra long buckets to try and catch the connections that are "too early"
+			Buckets:     []float64{.002, .007, .02, .05, .125, .5, 1, 2, 5, 10, 25},
+			ConstLabels: prometheus.Labels{"handler": "http"},
+		}, []string{"method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_in_flight",
+			Help: "A gauge of requests currently being served.",
+		}),
+		apiKeyRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_api_key_requests",
+			Help: "Number of v2 API requests per API key name and result",
+		}, []string{"key", "result"}),
+		tenantRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tenant_requests",
+			Help: "Number of v2 API requests served per tenant and status class",
+		}, []string{"tenant", "class"}),
+		tenantBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tenant_response_bytes",
+			Help: "Number of response body bytes served per tenant on the v2 API",
+		}, []string{"tenant"}),
+		rateLimitRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rate_limit_requests",
+			Help: "Number of requests allowed or rejected by the rate limiters, per limiter key class",
+		}, []string{"class", "result"}),
+		rateLimitKeys: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_rate_limit_keys",
+			Help: "Number of keys tracked by the rate limiters, per limiter key class",
+		}, []string{"class"}),
+		upstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_upstream_requests",
+			Help: "Number of historical rounds requested to the upstream relay, by result",
+		}, []string{"result"}),
+		shadowRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_shadow_requests",
+			Help: "Number of requests mirrored to the shadow relay, by result of the comparison with our response, or dropped when too many were in flight",
+		}, []string{"result"}),
+		shedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_shed_requests",
+			Help: "Number of non-essential requests rejected because the relay was overloaded, by reason",
+		}, []string{"reason"}),
+		maxIntRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "http_maxint_requests",
+			Help: "Number of requests for the round 18446744073709551615, which are caused by an underflow in the clients",
+		}),
+		geoRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_geo_requests",
+			Help: "Number of requests per continent code of the client, or per country ISO code when counted by country",
+		}, []string{"geo"}),
+		buildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "drand_http_relay_build_info",
+			Help: "A metric with a constant '1' value labeled by the version, commit and go_version the relay was built from.",
+		}, []string{"version", "commit", "go_version"}),
+	}
+}
+
+// serveMetrics serves the metrics endpoints on their own listener, in the background.
+func (rl *Relay) serveMetrics() {
+	mux, err := rl.metricsMux()
+	if err != nil {
+		slog.Error("error creating channelz monitor", "err", err)
+		return
+	}
+
+	addr := rl.cfg.MetricsBind
+	rl.metrics = &http.Server{Addr: addr, Handler: rl.adminHandler(mux), ReadHeaderTimeout: 10 * time.Second}
+	go func(srv *http.Server) {
+		var err error
+		if rl.cfg.MetricsCert != "" {
+			slog.Info("starting to serve metrics over TLS on /metrics", "addr", addr)
+			err = srv.ListenAndServeTLS(rl.cfg.MetricsCert, rl.cfg.MetricsKey)
+		} else {
+			slog.Info("starting to serve metrics on /metrics", "addr", addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("error serving http metrics", "addr", addr, "err", err)
+		}
+	}(rl.metrics)
+}
+
+// mountMetrics serves the metrics endpoints on the provided router instead of a separate listener. Unless that router
+// is the private one, it is public and the metrics authentication must be configured, as enforced by Check.
+func (rl *Relay) mountMetrics(r chi.Router, private bool) {
+	mux, err := rl.metricsMux()
+	if err != nil {
+		slog.Error("error creating channelz monitor", "err", err)
+		return
+	}
+	handler := rl.adminHandler(mux)
+	for _, path := range []string{"/metrics", "/chanz", "/balancer", "/tenants"} {
+		r.Handle(path, handler)
+	}
+	slog.Info("serving metrics on the http listener on /metrics", "private", private)
+}
+
+// adminHandler protects the admin endpoints served by the provided mux with metricsAuth, recording their requests in
+// the audit log, if any, including the unauthenticated ones.
+func (rl *Relay) adminHandler(mux http.Handler) http.Handler {
+	handler := metricsAuth(mux)
+	if rl.audit != nil {
+		handler = auditRequests(rl.audit)(handler)
+	}
+	return handler
+}
+
+// metricsMux returns a mux serving the prometheus metrics of the http and grpc registries of the relay on /metrics
+// along with the channelz data on /chanz, the fallback balancer state on /balancer and the usage of the tenants on
+// /tenants.
+func (rl *Relay) metricsMux() (*http.ServeMux, error) {
+	httpReg, grpcReg := rl.cfg.HTTPRegistry, rl.cfg.GrpcRegistry
+	handler := promhttp.HandlerFor(prometheus.Gatherers{httpReg, grpcReg}, promhttp.HandlerOpts{
+		Registry: httpReg,
+		// Opt into OpenMetrics e.g. to support exemplars.
+		EnableOpenMetrics: true,
+	})
+
+	mClient, err := grpc.CreateChannelzMonitor()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := grpc.Register(grpcReg, mClient); err != nil {
+		return nil, err
+	}
+
+	// the channelz data is collected in the background, so that the scrapes don't wait for it nor race each other
+	go mClient.CollectMetrics(rl.ctx, rl.cfg.ChannelzInterval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Debug("serving metrics on /metrics")
+		handler.ServeHTTP(w, r)
+	}))
+	mux.Handle("/chanz", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		slog.Debug("display channelz data on /chanz")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(grpc.ToJSON(mClient.Channels())))
+	}))
+	mux.Handle("/balancer", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		slog.Debug("display fallback balancer state on /balancer")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(grpc.ToJSON(grpc.BalancerStates())))
+	}))
+	mux.Handle("/tenants", withSettings(rl.settings)(serveTenants(rl.tenants)))
+	return mux, nil
+}
+
+// bindMetrics returns the collectors of the http metrics registered on the provided registerer, which are the ones it
+// already holds, if any, so that the relays using different registries don't share their metrics.
+func bindMetrics(reg prometheus.Registerer) *relayMetrics {
+	m := newRelayMetrics()
+	if reg == HTTPMetrics {
+		*m = *defaultMetrics
+	}
+	err := errors.Join(
+		register(reg, &m.callCounter),
+		register(reg, &m.latency),
+		register(reg, &m.inFlight),
+		register(reg, &m.apiKeyRequests),
+		register(reg, &m.tenantRequests),
+		register(reg, &m.tenantBytes),
+		register(reg, &m.rateLimitRequests),
+		register(reg, &m.rateLimitKeys),
+		register(reg, &m.upstreamRequests),
+		register(reg, &m.shadowRequests),
+		register(reg, &m.shedRequests),
+		register(reg, &m.maxIntRequests),
+		register(reg, &m.geoRequests),
+		register(reg, &m.buildInfo),
+	)
+	if err != nil {
+		slog.Error("error in bindMetrics", "metrics", "bindMetrics", "err", err)
+	}
+
+	info := getBuildInfo()
+	m.buildInfo.WithLabelValues(info.Version, info.Commit, info.GoVersion).Set(1)
+	return m
+}
+
+// register registers *c on reg using grpc.Register, replacing it with the equivalent collector already registered, if
+// any.
+func register[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	var err error
+	*c, err = grpc.Register(reg, *c)
+	return err
+}
@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMux(t *testing.T) {
+	// the relay can be set up several times on the same registries, e.g. when embedded
+	cfg := DefaultConfig()
+	cfg.HTTPRegistry, cfg.GrpcRegistry = prometheus.NewRegistry(), prometheus.NewRegistry()
+	for i := 0; i < 2; i++ {
+		rl := newRelay(cfg, nil, nil)
+		defer rl.close()
+		mux, err := rl.metricsMux()
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Contains(t, rec.Body.String(), "drand_http_relay_build_info")
+	}
+}
+
+func TestRelayMetricsRegistry(t *testing.T) {
+	require.Same(t, MaxIntRequests, bindMetrics(HTTPMetrics).maxIntRequests, "expected the package metrics on HTTPMetrics")
+
+	// the relays using their own registry don't count in the package metrics, but share them with each other
+	cfg := DefaultConfig()
+	cfg.HTTPRegistry = prometheus.NewRegistry()
+	rl := newRelay(cfg, nil, nil)
+	defer rl.close()
+	require.Same(t, rl.settings.metrics.maxIntRequests, bindMetrics(cfg.HTTPRegistry).maxIntRequests)
+
+	hits := testutil.ToFloat64(MaxIntRequests)
+	rl.handler(surfaceAll).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public/18446744073709551615", nil))
+	require.Equal(t, 1.0, testutil.ToFloat64(rl.settings.metrics.maxIntRequests))
+	require.Equal(t, hits, testutil.ToFloat64(MaxIntRequests))
+}
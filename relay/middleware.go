@@ -0,0 +1,329 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func prometheusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// picking up the trace context of the caller, e.g. set by our CDN, for the latencies to link to its traces
+		r = r.WithContext(propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)))
+		m := settingsOf(r).metrics
+		fn := promhttp.InstrumentHandlerCounter(
+			m.callCounter,
+			promhttp.InstrumentHandlerDuration(
+				m.latency,
+				promhttp.InstrumentHandlerInFlight(
+					m.inFlight,
+					next),
+				promhttp.WithExemplarFromContext(grpc.TraceExemplar)))
+		// We could also instrument:
+		// 	- time to write headers, but since we have common headers, these aren't too useful
+		//  - request size, but these are supposedly fixed size and are in the logs
+		fn.ServeHTTP(w, r)
+	})
+}
+
+// handler is setting all the routes and middleware we need for a drand relay, serving the provided surface
+func (rl *Relay) handler(s surface) http.Handler {
+	// setup the chi router
+	r := chi.NewRouter()
+
+	// providing the settings of this relay, its metrics included, to the middlewares and handlers below
+	r.Use(withSettings(rl.settings))
+
+	// putting the metric middleware next to get timing right
+	r.Use(prometheusMiddleware)
+
+	// counting the requests in flight for the load shedder, if any
+	r.Use(trackInflight(rl.shedder))
+
+	// setup the logger middleware
+	logger := httplog.NewLogger("drand-http-relay", httplog.Options{
+		JSON:            rl.cfg.JSON,
+		Writer:          rl.cfg.LogWriter,
+		LogLevel:        rl.cfg.logLevel(),
+		Concise:         !rl.cfg.Verbose,
+		ResponseHeaders: rl.cfg.Verbose,
+		RequestHeaders:  false,
+		QuietDownRoutes: []string{
+			"/",
+			"/ping",
+		},
+		QuietDownPeriod: 1 * time.Second,
+	})
+
+	logger.Info("logger instantiated", "LogLevel", rl.cfg.logLevel())
+
+	// the same Request ID and Panic Recoverer middlewares as httplog.RequestLogger, with our sampled request logger
+	var sampledRoutes []string
+	if rl.cfg.LogSampleRoutes != "" {
+		sampledRoutes = strings.Split(rl.cfg.LogSampleRoutes, ",")
+	}
+	var skipPaths []string
+	if rl.cfg.LogSkipPaths != "" {
+		skipPaths = strings.Split(rl.cfg.LogSkipPaths, ",")
+	}
+	r.Use(middleware.RequestID)
+	switch rl.cfg.AccessLogFormat {
+	case AccessLogECS, AccessLogCLF:
+		r.Use(accessLogger(rl.cfg.AccessLogFormat, rl.cfg.LogWriter, rl.trustedProxies, rl.cfg.LogSample, sampledRoutes, skipPaths))
+	default:
+		r.Use(sampledRequestLogger(logger, rl.cfg.LogSample, sampledRoutes, skipPaths))
+	}
+	r.Use(middleware.Recoverer)
+	if rl.geo != nil {
+		r.Use(enrichGeo(rl.geo))
+	}
+
+	// rejecting the denied clients before routing
+	r.Use(ipFilter(rl.ipAllow, rl.ipDeny, rl.trustedProxies))
+
+	// rejecting odd requests before they reach the handlers
+	r.Use(hardenRequests(rl.cfg.MaxURLLength))
+
+	// answering the CORS preflight requests before routing, since they carry no credentials
+	r.Use(corsPreflight(rl.cfg.CorsMaxAge))
+
+	// setup the ping endpoint for load balancers and uptime testing, without ACLs
+	r.Use(middleware.Heartbeat("/ping"))
+
+	// metering the usage of every caller, if exported
+	if rl.usage != nil {
+		r.Use(meterUsage(rl.usage))
+	}
+
+	// bounding the concurrent requests, so that a single client can't exhaust our goroutines and file descriptors
+	r.Use(limitInflight(newInflightLimiter(rl.cfg.MaxInflightPerIP, rl.cfg.MaxInflight, rl.settings.metrics), rl.trustedProxies))
+
+	// mirroring some traffic to a staging relay, if any, to validate it
+	r.Use(mirrorRequests(NewShadow(rl.cfg.ShadowURL, rl.cfg.ShadowPercent)))
+
+	// bounding the time spent on backend calls, consumers can ask for a shorter deadline using headers
+	r.Use(requestTimeout(rl.cfg.MaxRequestTimeout))
+
+	// telling the consumers where the time was spent, using the Server-Timing header
+	r.Use(serverTiming)
+	if rl.cfg.BackendHeader {
+		r.Use(exposeBackend)
+	}
+
+	if rl.cfg.Verbose {
+		// when running in verbose mode, we have a special Debug log telling us for each request whether it was matched
+		// or not by Chi against a given route.
+		r.Use(trackRoute)
+	}
+
+	rl.setupRoutes(r, s)
+
+	// the metrics are only served here if asked to, or on the private listener, they're not listed by DisplayRoutes
+	switch {
+	case s == surfacePrivate:
+		rl.mountMetrics(r, true)
+	case s == surfaceAll && rl.cfg.MetricsOnMain:
+		rl.mountMetrics(r, false)
+	}
+
+	// we explicitly don't serve favicon
+	r.Get("/favicon.ico", http.NotFound)
+
+	return r
+}
+
+func trackRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		rctx := chi.RouteContext(r.Context())
+		routePattern := strings.Join(rctx.RoutePatterns, "")
+		slog.Debug("request matched", "route", routePattern)
+	})
+}
+
+// addCommonHeaders is setting the json and CORS headers for drand json outputs
+func addCommonHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", Version)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headerHook is a response writer calling its hook on the headers right before they are written, to set the headers
+// whose value is only known once the handler is done.
+type headerHook struct {
+	http.ResponseWriter
+	hook        func(http.Header)
+	wroteHeader bool
+}
+
+func (hw *headerHook) WriteHeader(status int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.hook(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headerHook) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (hw *headerHook) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// exposeBackend adds the X-Drand-Backend header to the responses, with the address of the grpc backend that served the
+// request, to simplify incident triage. It is readable cross-origin, and omitted when no backend was called, e.g. when serving from the hub.
+func exposeBackend(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := grpc.WithUsedEndpoint(r.Context())
+		w.Header().Set("Access-Control-Expose-Headers", "X-Drand-Backend")
+		hw := &headerHook{ResponseWriter: w, hook: func(h http.Header) {
+			if addr := grpc.UsedEndpoint(ctx); addr != "" {
+				h.Set("X-Drand-Backend", addr)
+			}
+		}}
+		next.ServeHTTP(hw, r.WithContext(ctx))
+	})
+}
+
+// corsHeaders are the request headers the browsers may send cross-origin, used by the v2 authentication and to ask for
+// shorter timeouts.
+const corsHeaders = "Authorization, X-API-Key, X-Timeout-Ms, Request-Timeout, Cache-Control"
+
+// corsPreflight is answering the OPTIONS requests, which the browsers send before the cross-origin requests using
+// custom headers, allowing our methods and headers for the provided duration.
+func corsPreflight(maxAge time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			seconds := strconv.Itoa(int(maxAge.Seconds()))
+			w.Header().Set("Access-Control-Max-Age", seconds)
+			// the answer doesn't depend on the request, so the CDN can cache it as long as the browsers
+			w.Header().Set("Cache-Control", "public, max-age="+seconds)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// requestTimeout is honoring the X-Timeout-Ms header, or the Request-Timeout header in seconds, to set a deadline on
+// the request context used for the backend calls. The requested timeout is bounded by the provided max.
+func requestTimeout(max time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := max
+			if ms, err := strconv.ParseUint(r.Header.Get("X-Timeout-Ms"), 10, 32); err == nil {
+				timeout = time.Duration(ms) * time.Millisecond
+			} else if s, err := strconv.ParseUint(r.Header.Get("Request-Timeout"), 10, 32); err == nil {
+				timeout = time.Duration(s) * time.Second
+			}
+
+			if timeout <= 0 || timeout > max {
+				timeout = max
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allowedChains is returning a 404 for requests targeting a chain that isn't allowed on this relay. It relies on the
+// route URL parameters, so it must be used in an inline group rather than on a sub-router.
+func allowedChains(c BeaconProvider) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m, err := createRequestMD(r)
+			if err != nil {
+				// the handlers are dealing with invalid requests themselves
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !c.Allowed(r.Context(), m) {
+				slog.Debug("[allowedChains] request for a chain not in allowlist", "chainhash", chi.URLParam(r, "chainhash"), "beaconID", chi.URLParam(r, "beaconID"))
+				http.Error(w, "unknown chain", http.StatusNotFound)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// knownChains is returning a 404 for requests targeting a chainhash unknown to the backends, without issuing any
+// backend call for it. It relies on the route URL parameters, so it must be used in an inline group rather than on a
+// sub-router.
+func knownChains(c BeaconProvider) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m, err := createRequestMD(r)
+			if err != nil {
+				// the handlers are dealing with invalid requests themselves
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !c.Known(r.Context(), m) {
+				slog.Debug("[knownChains] request for an unknown chain", "chainhash", chi.URLParam(r, "chainhash"))
+				http.Error(w, "unknown chain", http.StatusNotFound)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hardenRequests is rejecting the requests with an URL longer than maxURL with a 414 status, using any method other
+// than GET, HEAD or OPTIONS with a 405 status, and those having a body with a 413 status.
+func hardenRequests(maxURL int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxURL > 0 && len(r.RequestURI) > maxURL {
+				http.Error(w, "URI too long", http.StatusRequestURITooLong)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			if r.ContentLength > 0 || len(r.TransferEncoding) > 0 {
+				http.Error(w, "Request body not allowed", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
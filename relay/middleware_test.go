@@ -0,0 +1,162 @@
+package relay
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	var timeout time.Duration
+	h := requestTimeout(10 * time.Second)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		require.True(t, ok, "expected a deadline on the request context")
+		timeout = time.Until(deadline)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		expected time.Duration
+	}{
+		{"default", "", "", 10 * time.Second},
+		{"milliseconds", "X-Timeout-Ms", "500", 500 * time.Millisecond},
+		{"seconds", "Request-Timeout", "2", 2 * time.Second},
+		{"bounded", "X-Timeout-Ms", "60000", 10 * time.Second},
+		{"zero", "Request-Timeout", "0", 10 * time.Second},
+		{"invalid", "X-Timeout-Ms", "soon", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/public/latest", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			require.InDelta(t, tt.expected, timeout, float64(100*time.Millisecond))
+		})
+	}
+}
+
+func TestAllowedChains(t *testing.T) {
+	c, _ := grpc.NewClient("localhost:1", slog.Default())
+	client := grpc.NewBackends(c, slog.Default())
+	defer client.Close()
+	client.Allow("quicknet")
+
+	r := chi.NewRouter()
+	r.With(allowedChains(client)).Get("/v2/beacons/{beaconID}/info", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for path, expected := range map[string]int{
+		"/v2/beacons/quicknet/info": http.StatusOK,
+		"/v2/beacons/default/info":  http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, expected, w.Code, path)
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	url, chain := newTestRelay(t, DefaultConfig())
+
+	req, err := http.NewRequest(http.MethodOptions, url+"/v2/chains/"+chain+"/rounds/1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	req.Header.Set("Access-Control-Request-Headers", "authorization")
+	resp, body := get(t, req)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, body, "the preflight requests mustn't get the route listing")
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.Contains(t, resp.Header.Get("Access-Control-Allow-Headers"), "Authorization")
+	require.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), http.MethodGet)
+	require.Equal(t, "86400", resp.Header.Get("Access-Control-Max-Age"))
+}
+
+func TestHardenRequests(t *testing.T) {
+	h := hardenRequests(64)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{"get", http.MethodGet, "/public/latest", "", http.StatusOK},
+		{"head", http.MethodHead, "/public/latest", "", http.StatusOK},
+		{"options", http.MethodOptions, "/public/latest", "", http.StatusOK},
+		{"post", http.MethodPost, "/public/latest", "", http.StatusMethodNotAllowed},
+		{"long url", http.MethodGet, "/public/" + strings.Repeat("1", 64), "", http.StatusRequestURITooLong},
+		{"body", http.MethodGet, "/public/latest", "data", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body *strings.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			var r *http.Request
+			if body != nil {
+				r = httptest.NewRequest(tt.method, tt.target, body)
+			} else {
+				r = httptest.NewRequest(tt.method, tt.target, nil)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestPrometheusMiddlewareTrace(t *testing.T) {
+	var exemplar map[string]string
+	h := prometheusMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exemplar = grpc.TraceExemplar(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v2/chains", nil)
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}, exemplar)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/chains", nil))
+	require.Nil(t, exemplar, "expected no exemplar without trace context")
+}
+
+func TestExposeBackend(t *testing.T) {
+	mock, addr, err := grpc.StartMockBackend("localhost:0", time.Now().Add(-time.Hour), 3*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(mock.Stop)
+	c, err := grpc.NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	client := grpc.NewBackends(c, slog.Default())
+	t.Cleanup(func() { client.Close() })
+
+	cfg := DefaultConfig()
+	cfg.BackendHeader = true
+	rl := newRelay(cfg, client, NewHub(client))
+	t.Cleanup(rl.close)
+	srv := httptest.NewServer(rl.handler(surfaceAll))
+	t.Cleanup(srv.Close)
+
+	resp := getJSON(t, srv.URL+"/v2/beacons/default/rounds/1", http.StatusOK, nil)
+	require.Equal(t, addr, resp.Header.Get("X-Drand-Backend"))
+	require.Equal(t, "X-Drand-Backend", resp.Header.Get("Access-Control-Expose-Headers"))
+
+	// the backends aren't disclosed unless asked to
+	resp = getJSON(t, serveRelay(t, client, NewHub(client))+"/v2/beacons/default/rounds/1", http.StatusOK, nil)
+	require.Empty(t, resp.Header.Get("X-Drand-Backend"))
+}
@@ -0,0 +1,220 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// BeaconProvider is what the handlers need from the backends. The relay relies on the grpc.Backends, while the tests
+// of the handlers can rely on a MockProvider rather than on a live backend.
+type BeaconProvider interface {
+	// GetBeacon returns the requested round of the chain designated in the Metadata, or its latest one for round 0.
+	GetBeacon(ctx context.Context, m *proto.Metadata, round uint64) (*grpc.HexBeacon, error)
+	// GetChainInfo returns the chain info of the chain designated in the Metadata.
+	GetChainInfo(ctx context.Context, m *proto.Metadata) (*grpc.JsonInfoV2, error)
+	// GetChains returns the chainhashes of the available chains.
+	GetChains(ctx context.Context) ([]string, error)
+	// GetBeaconIds returns the beacon IDs of the available chains, along with their metadata.
+	GetBeaconIds(ctx context.Context) ([]string, []*proto.Metadata, error)
+	// Next blocks until the next beacon of the chain designated in the Metadata is emitted.
+	Next(ctx context.Context, m *proto.Metadata) (*grpc.HexBeacon, error)
+	// Watch returns the new beacons of the chain designated in the Metadata as they are emitted.
+	Watch(ctx context.Context, m *proto.Metadata) <-chan *grpc.HexBeacon
+	// Allowed reports whether the chain designated in the Metadata may be served.
+	Allowed(ctx context.Context, m *proto.Metadata) bool
+	// Known reports whether the chain designated in the Metadata could be served, without issuing any backend call.
+	Known(ctx context.Context, m *proto.Metadata) bool
+}
+
+var _ BeaconProvider = (*grpc.Backends)(nil)
+
+// MockProvider is a BeaconProvider serving the chains it was created with and the beacons added to them, without any
+// backend. It is meant for tests only.
+type MockProvider struct {
+	mu       sync.Mutex
+	infos    []*grpc.JsonInfoV2
+	beacons  map[string]map[uint64]*grpc.HexBeacon
+	latest   map[string]uint64
+	watchers map[string][]chan *grpc.HexBeacon
+	err      error
+}
+
+// NewMockProvider returns a MockProvider serving the provided chains, without any beacon yet.
+func NewMockProvider(infos ...*grpc.JsonInfoV2) *MockProvider {
+	return &MockProvider{
+		infos:    infos,
+		beacons:  make(map[string]map[uint64]*grpc.HexBeacon),
+		latest:   make(map[string]uint64),
+		watchers: make(map[string][]chan *grpc.HexBeacon),
+	}
+}
+
+// AddBeacons adds the provided beacons to the chain with the provided chainhash, delivering them to its watchers.
+func (p *MockProvider) AddBeacons(chain string, beacons ...*grpc.HexBeacon) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.beacons[chain] == nil {
+		p.beacons[chain] = make(map[uint64]*grpc.HexBeacon)
+	}
+	for _, b := range beacons {
+		p.beacons[chain][b.Round] = b
+		p.latest[chain] = max(p.latest[chain], b.Round)
+		for _, ch := range p.watchers[chain] {
+			select {
+			case ch <- b:
+			default:
+				// the mock doesn't block on slow watchers, they miss the beacon instead
+			}
+		}
+	}
+}
+
+// SetError makes all the calls fail with the provided error until it is reset using nil.
+func (p *MockProvider) SetError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// info returns the chain info of the chain designated in the Metadata, the same way the backends resolve it.
+func (p *MockProvider) info(m *proto.Metadata) (*grpc.JsonInfoV2, error) {
+	for _, info := range p.infos {
+		if len(m.GetChainHash()) > 0 {
+			if bytes.Equal(info.Hash, m.GetChainHash()) {
+				return info, nil
+			}
+			continue
+		}
+		if info.BeaconId == m.GetBeaconID() {
+			return info, nil
+		}
+	}
+	return nil, grpc.ErrUnknownChain
+}
+
+// GetBeacon implements BeaconProvider.
+func (p *MockProvider) GetBeacon(_ context.Context, m *proto.Metadata, round uint64) (*grpc.HexBeacon, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	info, err := p.info(m)
+	if err != nil {
+		return nil, err
+	}
+	chain := info.Hash.String()
+	if round == 0 {
+		round = p.latest[chain]
+	}
+	beacon, ok := p.beacons[chain][round]
+	if !ok {
+		return nil, fmt.Errorf("%w: round %d", grpc.ErrRoundNotAvailable, round)
+	}
+	// the handlers set or unset the randomness of the beacons they serve
+	cp := *beacon
+	return &cp, nil
+}
+
+// GetChainInfo implements BeaconProvider.
+func (p *MockProvider) GetChainInfo(_ context.Context, m *proto.Metadata) (*grpc.JsonInfoV2, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.info(m)
+}
+
+// GetChains implements BeaconProvider.
+func (p *MockProvider) GetChains(context.Context) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	chains := make([]string, 0, len(p.infos))
+	for _, info := range p.infos {
+		chains = append(chains, info.Hash.String())
+	}
+	return chains, nil
+}
+
+// GetBeaconIds implements BeaconProvider.
+func (p *MockProvider) GetBeaconIds(context.Context) ([]string, []*proto.Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, nil, p.err
+	}
+	ids := make([]string, 0, len(p.infos))
+	metadatas := make([]*proto.Metadata, 0, len(p.infos))
+	for _, info := range p.infos {
+		ids = append(ids, info.BeaconId)
+		metadatas = append(metadatas, &proto.Metadata{BeaconID: info.BeaconId, ChainHash: info.Hash})
+	}
+	return ids, metadatas, nil
+}
+
+// Next implements BeaconProvider, returning the next beacon added to the chain.
+func (p *MockProvider) Next(ctx context.Context, m *proto.Metadata) (*grpc.HexBeacon, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case b, ok := <-p.Watch(ctx, m):
+		if ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("closed watch channel. ctx.Err: %w", ctx.Err())
+}
+
+// Watch implements BeaconProvider, delivering the beacons added to the chain until ctx is done.
+func (p *MockProvider) Watch(ctx context.Context, m *proto.Metadata) <-chan *grpc.HexBeacon {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch := make(chan *grpc.HexBeacon, 1)
+	info, err := p.info(m)
+	if err != nil || p.err != nil {
+		close(ch)
+		return ch
+	}
+	chain := info.Hash.String()
+	p.watchers[chain] = append(p.watchers[chain], ch)
+	context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for i, w := range p.watchers[chain] {
+			if w == ch {
+				p.watchers[chain] = append(p.watchers[chain][:i], p.watchers[chain][i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	})
+	return ch
+}
+
+// Allowed implements BeaconProvider, all the chains of the mock are allowed.
+func (p *MockProvider) Allowed(context.Context, *proto.Metadata) bool {
+	return true
+}
+
+// Known implements BeaconProvider, the requests by chainhash are only known if the mock serves them.
+func (p *MockProvider) Known(_ context.Context, m *proto.Metadata) bool {
+	if len(m.GetChainHash()) == 0 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.info(&proto.Metadata{ChainHash: m.GetChainHash()})
+	return err == nil
+}
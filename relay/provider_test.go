@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drand/http-server/grpc"
+)
+
+func TestHandlersWithMockProvider(t *testing.T) {
+	info := &grpc.JsonInfoV2{
+		PublicKey:   bytes.Repeat([]byte{0x01}, 48),
+		Period:      3,
+		GenesisTime: time.Now().Add(-time.Minute).Unix(),
+		Hash:        bytes.Repeat([]byte{0xcd}, 32),
+		Scheme:      "bls-unchained-g1-rfc9380",
+		BeaconId:    "quicknet",
+	}
+	chain := info.Hash.String()
+	p := NewMockProvider(info)
+	p.AddBeacons(chain, &grpc.HexBeacon{Round: 1, Signature: []byte{0x01}}, &grpc.HexBeacon{Round: 2, Signature: []byte{0x02}})
+	url := serveRelay(t, p, NewHub(p))
+
+	var chains []string
+	getJSON(t, url+"/v2/chains", http.StatusOK, &chains)
+	require.Equal(t, []string{chain}, chains)
+
+	var got grpc.JsonInfoV2
+	getJSON(t, url+"/v2/beacons/quicknet/info", http.StatusOK, &got)
+	require.Equal(t, chain, got.Hash.String())
+
+	var beacon grpc.HexBeacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/2", http.StatusOK, &beacon)
+	require.Equal(t, uint64(2), beacon.Round)
+	require.Empty(t, beacon.Randomness)
+	getJSON(t, url+"/"+chain+"/public/2", http.StatusOK, &beacon)
+	require.NotEmpty(t, beacon.Randomness, "v1 beacons must have their randomness set")
+	getJSON(t, url+"/"+chain+"/public/latest", http.StatusOK, &beacon)
+	require.Equal(t, uint64(2), beacon.Round)
+
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/3", http.StatusNotFound, nil)
+	getJSON(t, url+"/v2/chains/"+string(bytes.Repeat([]byte("ab"), 32))+"/info", http.StatusNotFound, nil)
+
+	p.SetError(grpc.ErrBackendUnavailable)
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/1", http.StatusServiceUnavailable, nil)
+	p.SetError(nil)
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/1", http.StatusOK, nil)
+}
+
+func TestMockProviderNext(t *testing.T) {
+	info := &grpc.JsonInfoV2{Period: 3, Hash: bytes.Repeat([]byte{0xcd}, 32), BeaconId: "quicknet"}
+	p := NewMockProvider(info)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan *grpc.HexBeacon)
+	go func() {
+		b, err := p.Next(ctx, &proto.Metadata{BeaconID: "quicknet"})
+		assert.NoError(t, err)
+		done <- b
+	}()
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.watchers[info.Hash.String()]) == 1
+	}, time.Second, time.Millisecond)
+	p.AddBeacons(info.Hash.String(), &grpc.HexBeacon{Round: 7})
+	b := <-done
+	require.NotNil(t, b)
+	require.Equal(t, uint64(7), b.Round)
+
+	_, err := p.Next(ctx, &proto.Metadata{BeaconID: "unknown"})
+	require.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// purgeTimeout bounds the duration of a single purge call.
+const purgeTimeout = 10 * time.Second
+
+// Purger invalidates the latest objects of a chain on a CDN when a new round is observed, by calling a generic
+// webhook, instead of waiting for their max-age to expire.
+type Purger struct {
+	url    string
+	method string
+	header string
+	token  string
+	client *http.Client
+}
+
+// NewPurger returns a Purger calling the provided URL template, in which {chainhash} and {round} are replaced by the
+// chainhash and round of the new beacon, using the given method. If the DRAND_PURGE_TOKEN env variable is set, it is
+// sent in the provided header, e.g. Fastly-Key or Authorization.
+func NewPurger(url, method, header string) *Purger {
+	token, _ := os.LookupEnv("DRAND_PURGE_TOKEN")
+	return &Purger{
+		url:    url,
+		method: method,
+		header: header,
+		token:  token,
+		client: &http.Client{Timeout: purgeTimeout},
+	}
+}
+
+// Purge calls the purge webhook for the provided chain and beacon, it is meant to be used as a Hub hook.
+func (p *Purger) Purge(chain string, beacon *grpc.HexBeacon) {
+	url := strings.NewReplacer("{chainhash}", chain, "{round}", strconv.FormatUint(beacon.Round, 10)).Replace(p.url)
+	if err := p.call(url); err != nil {
+		slog.Error("[Purger] unable to purge latest objects", "chain", chain, "round", beacon.Round, "err", err)
+		return
+	}
+	slog.Debug("[Purger] purged latest objects", "chain", chain, "round", beacon.Round)
+}
+
+func (p *Purger) call(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, p.method, url, nil)
+	if err != nil {
+		return err
+	}
+	if p.token != "" && p.header != "" {
+		req.Header.Set(p.header, p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// we drain the body to allow the connection to be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
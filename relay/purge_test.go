@@ -0,0 +1,42 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurge(t *testing.T) {
+	t.Setenv("DRAND_PURGE_TOKEN", "secret")
+	calls := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- r
+	}))
+	defer srv.Close()
+
+	p := NewPurger(srv.URL+"/purge/{chainhash}-latest?round={round}", http.MethodPost, "Fastly-Key")
+	p.Purge("abcd", &grpc.HexBeacon{Round: 42})
+
+	r := <-calls
+	require.Equal(t, http.MethodPost, r.Method)
+	require.Equal(t, "/purge/abcd-latest", r.URL.Path)
+	require.Equal(t, "42", r.URL.Query().Get("round"))
+	require.Equal(t, "secret", r.Header.Get("Fastly-Key"))
+}
+
+func TestPurgeError(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	t.Setenv("DRAND_PURGE_TOKEN", "")
+	p := NewPurger(srv.URL, "PURGE", "Authorization")
+	require.ErrorContains(t, p.call(srv.URL), "403")
+	require.Empty(t, auth, "no token should be sent without DRAND_PURGE_TOKEN")
+}
@@ -0,0 +1,197 @@
+package relay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// RateLimitRequests (HTTP) how many requests were allowed or rejected by each class of rate limiter
+	RateLimitRequests = defaultMetrics.rateLimitRequests
+
+	// RateLimitKeys (HTTP) how many keys are tracked by each class of rate limiter
+	RateLimitKeys = defaultMetrics.rateLimitKeys
+)
+
+// tokenLimits are the request rate, in requests per second, and the daily quota of an authenticated caller. A zero
+// value means unlimited.
+type tokenLimits struct {
+	rate  float64
+	quota uint64
+}
+
+// parseTokenLimits reads limits definitions, one per line in the form "subject rate quota", where subject is the JWT
+// subject or the API key name. Empty lines and lines starting with # are ignored.
+func parseTokenLimits(r io.Reader) (map[string]tokenLimits, error) {
+	limits := make(map[string]tokenLimits)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid limits on line %d, expected: subject rate quota", n)
+		}
+		rate, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate on line %d: %q", n, fields[1])
+		}
+		quota, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota on line %d: %q", n, fields[2])
+		}
+		limits[fields[0]] = tokenLimits{rate: rate, quota: quota}
+	}
+	return limits, scanner.Err()
+}
+
+// bucket is the rate limiting token bucket and daily usage of a caller.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	day    int64
+	used   uint64
+}
+
+// tokenLimiter enforces per caller rate limits and daily quotas, which are taken from the rate_limit and daily_quota
+// JWT claims if set, else from the limits file, else from the defaults.
+type tokenLimiter struct {
+	def    tokenLimits
+	limits map[string]tokenLimits
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	metrics *relayMetrics
+}
+
+func newTokenLimiter(def tokenLimits, limits map[string]tokenLimits, m *relayMetrics) *tokenLimiter {
+	return &tokenLimiter{
+		def:     def,
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		metrics: m,
+	}
+}
+
+func (l *tokenLimiter) limitsFor(id *identity) tokenLimits {
+	limits, ok := l.limits[id.subject]
+	if !ok {
+		limits = l.def
+	}
+	if claims, ok := id.claims.(jwt.MapClaims); ok {
+		if rate, ok := claims["rate_limit"].(float64); ok && rate >= 0 {
+			limits.rate = rate
+		}
+		if quota, ok := claims["daily_quota"].(float64); ok && quota >= 0 {
+			limits.quota = uint64(quota)
+		}
+	}
+	return limits
+}
+
+// allow returns whether the caller may make a request at the provided time, how many requests are left in its daily
+// quota and, when it is rejected, how long it should wait before retrying.
+func (l *tokenLimiter) allow(subject string, limits tokenLimits, now time.Time) (ok bool, remaining uint64, retry time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, found := l.buckets[subject]
+	if !found {
+		// bursts of up to one second worth of requests are allowed
+		b = &bucket{tokens: max(limits.rate, 1), last: now}
+		l.buckets[subject] = b
+		l.metrics.rateLimitKeys.WithLabelValues("token").Set(float64(len(l.buckets)))
+	}
+
+	day := now.Unix() / 86400
+	if b.day != day {
+		b.day = day
+		b.used = 0
+	}
+	if limits.quota > 0 && b.used >= limits.quota {
+		return false, 0, time.Unix((day+1)*86400, 0).Sub(now)
+	}
+
+	if limits.rate > 0 {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*limits.rate, max(limits.rate, 1))
+		b.last = now
+		if b.tokens < 1 {
+			return false, limits.quota - b.used, time.Duration((1 - b.tokens) / limits.rate * float64(time.Second))
+		}
+		b.tokens--
+	}
+
+	b.used++
+	if limits.quota == 0 {
+		return true, 0, 0
+	}
+	return true, limits.quota - b.used, 0
+}
+
+// rateLimitTokens enforces the per caller rate limits and quotas, returning a 429 status when exceeded along with the
+// X-RateLimit headers. It must be used after the authentication middleware, unauthenticated requests aren't limited.
+func rateLimitTokens(l *tokenLimiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := requestIdentity(r)
+			if id == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limits := l.limitsFor(id)
+			now := time.Now()
+			ok, remaining, retry := l.allow(id.limitKey(), limits, now)
+			if limits.quota > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.FormatUint(limits.quota, 10))
+				w.Header().Set("X-RateLimit-Remaining", strconv.FormatUint(remaining, 10))
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt((now.Unix()/86400+1)*86400, 10))
+			}
+			if !ok {
+				l.metrics.rateLimitRequests.WithLabelValues("token", "rejected").Inc()
+				slog.Debug("[rateLimitTokens] request rejected", "subject", id.subject, "retry", retry)
+				w.Header().Set("Retry-After", strconv.FormatInt(int64(retry.Seconds())+1, 10))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			l.metrics.rateLimitRequests.WithLabelValues("token", "allowed").Inc()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenLimiting returns whether any per caller limit is configured.
+func (cfg *Config) tokenLimiting() bool {
+	return cfg.TokenRate > 0 || cfg.TokenQuota > 0 || cfg.TokenLimits != ""
+}
+
+// newTokenLimiterFromConfig returns the limiter configured by the TokenRate, TokenQuota and TokenLimits settings,
+// recording its metrics in m.
+func newTokenLimiterFromConfig(cfg *Config, m *relayMetrics) (*tokenLimiter, error) {
+	limits := make(map[string]tokenLimits)
+	if cfg.TokenLimits != "" {
+		f, err := os.Open(cfg.TokenLimits)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open --token-limits: %w", err)
+		}
+		defer f.Close()
+		if limits, err = parseTokenLimits(f); err != nil {
+			return nil, fmt.Errorf("unable to parse --token-limits: %w", err)
+		}
+	}
+	return newTokenLimiter(tokenLimits{rate: cfg.TokenRate, quota: cfg.TokenQuota}, limits, m), nil
+}
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenLimiterRate(t *testing.T) {
+	l := newTokenLimiter(tokenLimits{}, nil, defaultMetrics)
+	limits := tokenLimits{rate: 2}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		ok, _, _ := l.allow("alice", limits, now)
+		require.True(t, ok, "request %d should be allowed by the burst", i)
+	}
+	ok, _, retry := l.allow("alice", limits, now)
+	require.False(t, ok, "the third request in the same instant should be limited")
+	require.Equal(t, 500*time.Millisecond, retry)
+	ok, _, _ = l.allow("alice", limits, now.Add(500*time.Millisecond))
+	require.True(t, ok, "a request should be allowed once a token is refilled")
+	ok, _, _ = l.allow("bob", limits, now)
+	require.True(t, ok, "callers should have their own buckets")
+}
+
+func TestTokenLimiterQuota(t *testing.T) {
+	l := newTokenLimiter(tokenLimits{}, nil, defaultMetrics)
+	limits := tokenLimits{quota: 2}
+	now := time.Unix(86400*10+100, 0)
+
+	ok, remaining, _ := l.allow("alice", limits, now)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), remaining)
+	ok, remaining, _ = l.allow("alice", limits, now)
+	require.True(t, ok)
+	require.Zero(t, remaining)
+	ok, _, retry := l.allow("alice", limits, now)
+	require.False(t, ok, "expected the quota to be exceeded")
+	require.Equal(t, (86400-100)*time.Second, retry, "expected the quota to be exceeded until the next day")
+	ok, _, _ = l.allow("alice", limits, now.Add(24*time.Hour))
+	require.True(t, ok, "the quota should be reset the next day")
+}
+
+func TestTokenLimitsSources(t *testing.T) {
+	limits, err := parseTokenLimits(strings.NewReader("# tiers\nalice 10 1000\n"))
+	require.NoError(t, err)
+	l := newTokenLimiter(tokenLimits{rate: 1}, limits, defaultMetrics)
+
+	require.Equal(t, tokenLimits{rate: 10, quota: 1000}, l.limitsFor(&identity{subject: "alice"}), "unexpected limits from file")
+	require.Equal(t, tokenLimits{rate: 1}, l.limitsFor(&identity{subject: "bob"}), "unexpected default limits")
+	claims := jwt.MapClaims{"rate_limit": 5.0, "daily_quota": 50.0}
+	require.Equal(t, tokenLimits{rate: 5, quota: 50}, l.limitsFor(&identity{subject: "alice", claims: claims}), "unexpected limits from claims")
+}
+
+func TestTokenLimiterWithoutSubject(t *testing.T) {
+	l := newTokenLimiter(tokenLimits{quota: 1}, nil, defaultMetrics)
+	h := rateLimitTokens(l)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(claims jwt.MapClaims) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withIdentity(httptest.NewRequest(http.MethodGet, "/v2/chains", nil), "", claims))
+		return w.Code
+	}
+
+	// two JWTs without subject must not share the same quota
+	alice, bob := jwt.MapClaims{"iat": 1000.0}, jwt.MapClaims{"iat": 2000.0}
+	require.Equal(t, http.StatusOK, serve(alice))
+	require.Equal(t, http.StatusOK, serve(bob))
+	require.Equal(t, http.StatusTooManyRequests, serve(alice))
+	require.Equal(t, http.StatusTooManyRequests, serve(bob))
+
+	// the jti identifies the tokens
+	require.Equal(t, http.StatusOK, serve(jwt.MapClaims{"jti": "carol", "iat": 1000.0}))
+	require.Equal(t, http.StatusTooManyRequests, serve(jwt.MapClaims{"jti": "carol", "iat": 3000.0}))
+}
+
+func TestRateLimitMetrics(t *testing.T) {
+	allowed := testutil.ToFloat64(RateLimitRequests.WithLabelValues("token", "allowed"))
+	rejected := testutil.ToFloat64(RateLimitRequests.WithLabelValues("token", "rejected"))
+
+	l := newTokenLimiter(tokenLimits{quota: 1}, nil, defaultMetrics)
+	h := rateLimitTokens(l)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/v2/chains", nil)
+		h.ServeHTTP(httptest.NewRecorder(), withIdentity(r, "carol", nil))
+	}
+
+	require.Equal(t, allowed+1, testutil.ToFloat64(RateLimitRequests.WithLabelValues("token", "allowed")))
+	require.Equal(t, rejected+1, testutil.ToFloat64(RateLimitRequests.WithLabelValues("token", "rejected")))
+	require.Equal(t, 1.0, testutil.ToFloat64(RateLimitKeys.WithLabelValues("token")))
+}
@@ -0,0 +1,653 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Version is the version of the relay, served on the /version endpoints and in the Server header.
+var Version = "drand-http-server-v2.0.1"
+
+// mockGenesis is the fixed genesis of the MockBackend chain, so that its chain hash is deterministic
+var mockGenesis = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Config is the configuration of a Relay, mirroring the command line flags of the drand-relay-http binary, which
+// document each setting at length. The settings disabled when set to 0 or empty are disabled in the zero Config, use
+// DefaultConfig to get the defaults of the binary.
+type Config struct {
+	// Bind is the address the http server binds to.
+	Bind string
+	// PrivateBind is the address of a private http server serving all routes along with the metrics, in which case the
+	// Bind server only serves the beacon and chain info routes.
+	PrivateBind string
+	// GrpcBind is the address of a grpc server serving the drand Public API through the relay. It isn't authenticated nor
+	// rate limited, only IPAllow and IPDeny apply to it.
+	GrpcBind string
+
+	// MetricsBind is the address of the metrics server, unless the metrics are served by the PrivateBind server or by
+	// the Bind one using MetricsOnMain.
+	MetricsBind string
+	// MetricsCert and MetricsKey are the TLS certificate and key files used to serve the metrics over https.
+	MetricsCert string
+	MetricsKey  string
+	// MetricsOnMain serves the metrics on the Bind server, it requires the DRAND_METRICS_TOKEN or
+	// DRAND_METRICS_BASIC_AUTH env variable to be set.
+	MetricsOnMain bool
+	// HTTPRegistry and GrpcRegistry hold the http and grpc metrics of the relay, they default to HTTPMetrics and
+	// grpc.ClientMetrics.
+	HTTPRegistry *prometheus.Registry
+	GrpcRegistry *prometheus.Registry
+	// ChannelzInterval is how often the channelz data of the grpc backends is collected.
+	ChannelzInterval time.Duration
+
+	// GrpcConnect is the comma separated list of grpc backends, see ParseBackends, or a srv:/// target.
+	GrpcConnect string
+	// Groups are the groups of grpc backends serving only some chains, in the form chain1,chain2=host1:port,host2:port.
+	Groups []string
+	// Chains is a comma separated allowlist of chainhashes or beacon IDs to serve.
+	Chains string
+	// Keepalive, KeepaliveTimeout and KeepaliveNoStream configure the keepalive pings sent to the grpc backends.
+	Keepalive         time.Duration
+	KeepaliveTimeout  time.Duration
+	KeepaliveNoStream bool
+	// Compress enables gzip compression on the grpc calls.
+	Compress              bool
+	HedgeDelay            time.Duration
+	RetryPolicy           string
+	MaxInflightPerBackend int
+	LatencyAware          bool
+	ProbeInterval         time.Duration
+	ResolveInterval       time.Duration
+	UnknownChainTTL       time.Duration
+	ChainInfoRefresh      time.Duration
+	ChainsTTL             time.Duration
+	ChainAffinity         bool
+	// Verify enables the verification of the beacons received from the grpc backends.
+	Verify bool
+	// Chaos injects faults in the grpc calls, see grpc.ParseChaos. Never use it in production.
+	Chaos string
+	// MockBackend ignores GrpcConnect and serves the beacons of an in-process fake drand node.
+	MockBackend bool
+	// RecordFile records the grpc backend responses, to be replayed later using ReplayFile, which ignores
+	// GrpcConnect.
+	RecordFile string
+	ReplayFile string
+	// Upstream is the base URL of a relay from which the historical rounds are read first.
+	Upstream string
+
+	// RequireAuth forces authentication on the v2 API, either using JWTs, API keys or the API keys of the tenants from
+	// TenantsFile according to AuthMode.
+	RequireAuth bool
+	AuthMode    string
+	AuthKeyFile string
+	APIKeysFile string
+	TenantsFile string
+	// TokenRate, TokenQuota and TokenLimits configure the rate limits and quotas of the authenticated callers.
+	TokenRate   float64
+	TokenQuota  uint64
+	TokenLimits string
+	// AuditLog is the file recording the audit trail of the authenticated and admin requests.
+	AuditLog string
+	// UsageExport is the JSON lines or CSV file, or the http endpoint, to which the usage of every caller is exported
+	// every UsageInterval.
+	UsageExport   string
+	UsageInterval time.Duration
+
+	// Verbose logs as much as possible, and JSON logs in JSON format.
+	Verbose bool
+	JSON    bool
+	// LogWriter is where the request logs go, it defaults to stdout. See LogOutput to honor LogFile and Syslog.
+	LogWriter io.Writer
+	// LogFile, LogMaxSize in MB, LogRotate and LogBackups configure the rotated log files, also used by AuditLog.
+	LogFile    string
+	LogMaxSize int64
+	LogRotate  time.Duration
+	LogBackups int
+	// LogSample only logs 1 in this many successful requests on the comma separated LogSampleRoutes.
+	LogSample       uint64
+	LogSampleRoutes string
+	// LogSkipPaths is a comma separated list of paths whose requests are never logged.
+	LogSkipPaths string
+	// AccessLogFormat is the format of the request logs, either AccessLogDefault, AccessLogECS or AccessLogCLF.
+	AccessLogFormat string
+	// GeoIPDB is the MaxMind GeoIP2 or GeoLite2 database locating the clients in the request logs and in the
+	// http_geo_requests metric, counted per continent or per country if GeoIPByCountry is set. Disabled if empty.
+	GeoIPDB        string
+	GeoIPByCountry bool
+	// Syslog also sends the logs to syslog, either "local" or a network address.
+	Syslog string
+
+	// Frontrun starts the queries for the next round this much earlier to counteract network latency.
+	Frontrun          time.Duration
+	MaxRequestTimeout time.Duration
+	CorsMaxAge        time.Duration
+	HideRoutes        bool
+	// BackendHeader adds the X-Drand-Backend header, with the address of the grpc backend serving the request.
+	BackendHeader bool
+	// IPAllow, IPDeny, V2IPAllow and TrustedProxies are comma separated lists of CIDRs.
+	IPAllow          string
+	IPDeny           string
+	V2IPAllow        string
+	TrustedProxies   string
+	MaxURLLength     int
+	MaxInflight      int
+	MaxInflightPerIP int
+	ShedInflight     int
+	ShedGoroutines   int
+	ShedErrorRate    float64
+	MaxWaiters       int
+	ShutdownTimeout  time.Duration
+	MaxIntJSON       bool
+	MaxIntDelay      time.Duration
+	LongPollMax      time.Duration
+	AcceptAfter      time.Duration
+	FutureRounds     uint64
+	Prefetch         bool
+
+	// CacheImmutable, CacheNone and CacheInfo are the Cache-Control headers of the responses, see cache.go.
+	CacheImmutable       string
+	CacheNone            string
+	CacheInfo            string
+	CacheLatestFudge     time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	// SurrogateKeyHeaders is a comma separated list of headers in which to set the surrogate keys of the responses.
+	SurrogateKeyHeaders string
+
+	// PurgeURL is a CDN purge webhook called with PurgeMethod when a new round is observed.
+	PurgeURL    string
+	PurgeMethod string
+	PurgeHeader string
+	// ShadowURL is the base URL of a staging relay to which ShadowPercent of the GET requests are mirrored.
+	ShadowURL     string
+	ShadowPercent float64
+}
+
+// defaultConfig holds the defaults of the relay settings, taken from the package variables.
+var defaultConfig = Config{
+	Bind:                "localhost:8080",
+	MetricsBind:         "localhost:9999",
+	ChannelzInterval:    grpc.ChannelzInterval,
+	GrpcConnect:         "localhost:4444",
+	KeepaliveTimeout:    20 * time.Second,
+	RetryPolicy:         grpc.RetryPolicy,
+	ResolveInterval:     5 * time.Minute,
+	UnknownChainTTL:     10 * time.Second,
+	ChainInfoRefresh:    grpc.ChainInfoRefresh,
+	ChainsTTL:           grpc.ChainsTTL,
+	AuthMode:            "jwt",
+	LogMaxSize:          100,
+	LogRotate:           24 * time.Hour,
+	LogBackups:          7,
+	LogSample:           1,
+	LogSampleRoutes:     "/public/,/rounds/",
+	LogSkipPaths:        "/ping,/health,/metrics",
+	AccessLogFormat:     AccessLogDefault,
+	MaxRequestTimeout:   time.Minute,
+	CorsMaxAge:          24 * time.Hour,
+	MaxURLLength:        2048,
+	ShutdownTimeout:     ShutdownTimeout,
+	LongPollMax:         LongPollWait,
+	FutureRounds:        FutureRounds,
+	CacheImmutable:      CacheImmutable,
+	CacheNone:           CacheNone,
+	CacheInfo:           CacheInfo,
+	SurrogateKeyHeaders: strings.Join(SurrogateKeyHeaders, ","),
+	PurgeMethod:         http.MethodPost,
+	PurgeHeader:         "Authorization",
+	ShadowPercent:       1,
+	UsageInterval:       time.Hour,
+}
+
+// DefaultConfig returns the default configuration of the relay, which is the one of the drand-relay-http binary.
+func DefaultConfig() Config {
+	return defaultConfig
+}
+
+// setDefaults sets the defaults of the settings that can't be disabled.
+func (cfg *Config) setDefaults() {
+	if cfg.LogWriter == nil {
+		cfg.LogWriter = os.Stdout
+	}
+	if cfg.HTTPRegistry == nil {
+		cfg.HTTPRegistry = HTTPMetrics
+	}
+	if cfg.GrpcRegistry == nil {
+		cfg.GrpcRegistry = grpc.ClientMetrics
+	}
+}
+
+// logLevel returns the level of the request logs.
+func (cfg *Config) logLevel() slog.Level {
+	if cfg.Verbose {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// Relay is a drand HTTP relay serving the beacons of its grpc backends, which can be embedded in other Go programs.
+type Relay struct {
+	cfg    Config
+	client BeaconProvider
+	hub    *Hub
+	// backends are the grpc backends behind client, also served by the grpc proxy
+	backends *grpc.Backends
+
+	// the IP filtering lists, as configured by IPAllow, IPDeny, V2IPAllow and TrustedProxies
+	ipAllow, ipDeny, v2IPAllow, trustedProxies []netip.Prefix
+	// audit is the structured audit trail of the authenticated and admin requests, it is disabled when nil
+	audit *slog.Logger
+	// authKey is the JWT secret used by AddAuth, loaded by setupAuth when JWT authentication is enabled
+	authKey *jwtKey
+	// v2Auth is the authentication middleware of the v2 API, set up by setupAuth when RequireAuth is set
+	v2Auth func(http.Handler) http.Handler
+	// limiter enforces the per caller limits, if any, on the authenticated v2 API
+	limiter *tokenLimiter
+	// tenants are the metered consumers of the v2 API when AuthMode is tenant
+	tenants *tenants
+	// usage counts the requests of every caller to export them, it is disabled when nil
+	usage *usageMeter
+	// geo locates the clients in the request logs, it is disabled when nil
+	geo *geoIP
+	// settings are the settings of the handlers, taken from cfg
+	settings *settings
+	// shedder rejects the non-essential requests when the relay is overloaded, it is disabled when nil
+	shedder *loadShedder
+
+	// ctx is canceled when the relay is stopped, to stop its background tasks
+	ctx    context.Context
+	cancel context.CancelFunc
+	// ready is closed once the chains are loaded
+	ready chan struct{}
+	// closers release the resources of the relay once stopped, such as the mock backend
+	closers []func()
+
+	lis     net.Listener
+	server  *http.Server
+	private *http.Server
+	metrics *http.Server
+	proxy   interface{ Stop() }
+}
+
+// newRelay returns a Relay serving the beacons of the provided client and hub, without starting anything.
+func newRelay(cfg Config, client BeaconProvider, hub *Hub) *Relay {
+	cfg.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		cfg:      cfg,
+		client:   client,
+		hub:      hub,
+		settings: newSettings(&cfg, bindMetrics(cfg.HTTPRegistry)),
+		shedder:  newLoadShedder(cfg.ShedInflight, cfg.ShedGoroutines, cfg.ShedErrorRate),
+		ctx:      ctx,
+		cancel:   cancel,
+		ready:    make(chan struct{}),
+	}
+}
+
+// New validates the provided configuration and connects to the grpc backends, returning a Relay ready to be started.
+// The settings of the Relay and of its grpc client are its own, so that several relays can run in the same process.
+func New(cfg Config) (*Relay, error) {
+	if errs := Check(cfg, false); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	cfg.setDefaults()
+
+	var closers []func()
+	fail := func(err error) (*Relay, error) {
+		for _, c := range closers {
+			c()
+		}
+		return nil, err
+	}
+
+	if cfg.MockBackend {
+		mock, addr, err := grpc.StartMockBackend("localhost:0", mockGenesis, 3*time.Second)
+		if err != nil {
+			return fail(fmt.Errorf("failed to start mock backend: %w", err))
+		}
+		closers = append(closers, mock.Stop)
+		slog.Warn("Using an in-process mock backend, serving test beacons only", "addr", addr)
+		cfg.GrpcConnect = addr
+	}
+
+	if cfg.ReplayFile != "" {
+		f, err := os.Open(cfg.ReplayFile)
+		if err != nil {
+			return fail(fmt.Errorf("failed to open recording: %w", err))
+		}
+		replay, addr, err := grpc.StartReplayBackend("localhost:0", f)
+		f.Close()
+		if err != nil {
+			return fail(fmt.Errorf("failed to start replay backend: %w", err))
+		}
+		closers = append(closers, replay.Stop)
+		slog.Warn("Replaying a recording of the grpc backends", "file", cfg.ReplayFile, "addr", addr)
+		cfg.GrpcConnect = addr
+	}
+
+	target := cfg.GrpcConnect
+	if !strings.HasPrefix(target, "srv:///") {
+		target = "fallback:///" + target
+	}
+
+	opts := []grpc.ClientOption{
+		grpc.WithRegistry(cfg.GrpcRegistry),
+		grpc.WithLatencyAware(cfg.LatencyAware),
+		grpc.WithChainAffinity(cfg.ChainAffinity),
+		grpc.WithMaxInflight(cfg.MaxInflightPerBackend),
+		grpc.WithRetryPolicy(cfg.RetryPolicy),
+		grpc.WithHedging(cfg.HedgeDelay),
+		grpc.WithVerification(cfg.Verify),
+		grpc.WithResolveInterval(cfg.ResolveInterval),
+		grpc.WithUnknownChainTTL(cfg.UnknownChainTTL),
+		grpc.WithChainsTTL(cfg.ChainsTTL),
+		grpc.WithChainInfoRefresh(cfg.ChainInfoRefresh),
+	}
+	if cfg.Keepalive > 0 {
+		opts = append(opts, grpc.WithKeepalive(cfg.Keepalive, cfg.KeepaliveTimeout, cfg.KeepaliveNoStream))
+	}
+	if cfg.Compress {
+		opts = append(opts, grpc.WithCompression())
+	}
+	if cfg.ProbeInterval > 0 {
+		opts = append(opts, grpc.WithActiveProbing(cfg.ProbeInterval))
+	}
+	if cfg.RecordFile != "" {
+		f, err := os.Create(cfg.RecordFile)
+		if err != nil {
+			return fail(fmt.Errorf("failed to create recording: %w", err))
+		}
+		closers = append(closers, func() { f.Close() })
+		opts = append(opts, grpc.WithRecording(f))
+	}
+	if cfg.Chaos != "" {
+		c, err := grpc.ParseChaos(cfg.Chaos)
+		if err != nil {
+			return fail(fmt.Errorf("invalid chaos configuration: %w", err))
+		}
+		opts = append(opts, grpc.WithChaos(c))
+	}
+
+	defClient, err := grpc.NewClient(target, slog.Default(), opts...)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create client for %s: %w", target, err))
+	}
+	client := grpc.NewBackends(defClient, slog.Default())
+	closers = append(closers, func() { client.Close() })
+
+	for _, group := range cfg.Groups {
+		chains, addrs, _ := strings.Cut(group, "=")
+		groupClient, err := grpc.NewClient("fallback:///"+addrs, slog.Default(), opts...)
+		if err != nil {
+			return fail(fmt.Errorf("failed to create backend group client for %s: %w", addrs, err))
+		}
+		client.Add(context.Background(), groupClient, strings.Split(chains, ",")...)
+	}
+
+	if cfg.Chains != "" {
+		client.Allow(strings.Split(cfg.Chains, ",")...)
+	}
+
+	// the hub watches all chains to keep track of their latest beacons
+	hub := NewHub(client)
+	hub.prefetchRounds, hub.frontrun = cfg.Prefetch, cfg.Frontrun
+	if cfg.PurgeURL != "" {
+		hub.OnNewRound(NewPurger(cfg.PurgeURL, cfg.PurgeMethod, cfg.PurgeHeader).Purge)
+	}
+
+	rl := newRelay(cfg, client, hub)
+	rl.backends = client
+	rl.closers = closers
+	fail = func(err error) (*Relay, error) {
+		rl.close()
+		return nil, err
+	}
+
+	// the lists were validated by Check
+	rl.ipAllow, _ = parsePrefixes(cfg.IPAllow)
+	rl.ipDeny, _ = parsePrefixes(cfg.IPDeny)
+	rl.v2IPAllow, _ = parsePrefixes(cfg.V2IPAllow)
+	rl.trustedProxies, _ = parsePrefixes(cfg.TrustedProxies)
+
+	if cfg.UsageExport != "" {
+		rl.usage = newUsageMeter(rl.trustedProxies)
+	}
+	if cfg.GeoIPDB != "" {
+		if rl.geo, err = newGeoIP(cfg.GeoIPDB, cfg.GeoIPByCountry, rl.trustedProxies); err != nil {
+			return fail(fmt.Errorf("unable to load GeoIP database: %w", err))
+		}
+	}
+	if cfg.AuditLog != "" {
+		if rl.audit, err = newAuditLog(cfg.AuditLog, &cfg); err != nil {
+			return fail(fmt.Errorf("unable to setup audit log: %w", err))
+		}
+	}
+	if cfg.RequireAuth {
+		if err := rl.setupAuth(); err != nil {
+			return fail(fmt.Errorf("invalid authentication configuration: %w", err))
+		}
+		if cfg.tokenLimiting() || rl.tenants != nil {
+			if rl.limiter, err = newTokenLimiterFromConfig(&cfg, rl.settings.metrics); err != nil {
+				return fail(err)
+			}
+		}
+		if rl.tenants != nil {
+			// the limits of the tenants take precedence over the --token-limits ones
+			for name, t := range rl.tenants.byName {
+				rl.limiter.limits[name] = t.limits
+			}
+		}
+	}
+
+	return rl, nil
+}
+
+// Start starts watching the chains and serving the relay on its listeners, in the background. It returns once they are
+// all listening.
+func (rl *Relay) Start() error {
+	var err error
+	if rl.lis, err = net.Listen("tcp", rl.cfg.Bind); err != nil {
+		return fmt.Errorf("unable to listen on bind address %q: %w", rl.cfg.Bind, err)
+	}
+
+	var privateLis, proxyLis net.Listener
+	if rl.cfg.PrivateBind != "" {
+		if privateLis, err = net.Listen("tcp", rl.cfg.PrivateBind); err != nil {
+			rl.lis.Close()
+			return fmt.Errorf("unable to listen on private bind address %q: %w", rl.cfg.PrivateBind, err)
+		}
+	}
+	if rl.cfg.GrpcBind != "" {
+		if proxyLis, err = net.Listen("tcp", rl.cfg.GrpcBind); err != nil {
+			rl.lis.Close()
+			if privateLis != nil {
+				privateLis.Close()
+			}
+			return fmt.Errorf("unable to listen on grpc bind address %q: %w", rl.cfg.GrpcBind, err)
+		}
+	}
+
+	if rl.shedder != nil {
+		go rl.shedder.run(rl.ctx)
+	}
+
+	if err := rl.hub.Start(rl.ctx); err != nil {
+		slog.Error("Failed to start watching chains", "error", err)
+		go func() {
+			for err != nil && rl.ctx.Err() == nil {
+				time.Sleep(5 * time.Second)
+				err = rl.hub.Start(rl.ctx)
+			}
+			close(rl.ready)
+		}()
+	} else {
+		close(rl.ready)
+	}
+
+	// the usage is exported until the relay is stopped, including the last partial interval
+	if rl.usage != nil {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			newUsageExporter(rl.usage, rl.cfg.UsageExport).run(rl.ctx, rl.cfg.UsageInterval)
+		}()
+		rl.closers = append(rl.closers, func() { <-done })
+	}
+
+	// the metrics are served by the private http server when there is one
+	if !rl.cfg.MetricsOnMain && rl.cfg.PrivateBind == "" {
+		rl.serveMetrics()
+	}
+
+	// The optional grpc proxy server
+	if proxyLis != nil {
+		// the proxy honors the IP filtering lists, its clients connecting directly rather than through trusted proxies
+		var opts []grpc.ProxyOption
+		if len(rl.ipAllow) > 0 || len(rl.ipDeny) > 0 {
+			allow, deny := rl.ipAllow, rl.ipDeny
+			opts = append(opts, grpc.WithPeerFilter(func(addr netip.Addr) bool { return ipAllowed(allow, deny, addr) }))
+		}
+		srv := grpc.NewProxyServer(rl.backends, opts...)
+		rl.proxy = srv
+		go func() {
+			slog.Info("Starting grpc proxy", "addr", rl.cfg.GrpcBind)
+			if rl.cfg.RequireAuth {
+				slog.Warn("The grpc proxy doesn't authenticate nor rate limit its clients, unlike the v2 API", "addr", rl.cfg.GrpcBind)
+			}
+			if err := srv.Serve(proxyLis); err != nil {
+				slog.Error("grpc proxy server error", "err", err)
+			}
+		}()
+	}
+
+	slog.Info("Starting http relay", "version", Version, "client", rl.client)
+
+	// The HTTP Server, which only serves the public routes when there is a private one
+	public := surfaceAll
+	if privateLis != nil {
+		public = surfacePublic
+	}
+	rl.server = &http.Server{Addr: rl.cfg.Bind, Handler: rl.handler(public)}
+
+	// The optional private HTTP Server
+	if privateLis != nil {
+		rl.private = &http.Server{Addr: rl.cfg.PrivateBind, Handler: rl.handler(surfacePrivate)}
+		go func() {
+			slog.Info("Starting private http server", "addr", rl.cfg.PrivateBind)
+			if err := rl.private.Serve(privateLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("private server error", "err", err)
+			}
+		}()
+	}
+
+	go func() {
+		if err := rl.server.Serve(rl.lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server error", "err", err)
+		}
+	}()
+	return nil
+}
+
+// Handler returns the handler serving all the routes of the relay, for programs serving it on their own listener
+// rather than using Start. The relay still needs to be started to watch the chains.
+func (rl *Relay) Handler() http.Handler {
+	return rl.handler(surfaceAll)
+}
+
+// Addr returns the address the http server listens on, once started.
+func (rl *Relay) Addr() net.Addr {
+	return rl.lis.Addr()
+}
+
+// Ready returns a channel closed once the relay loaded the chains of its backends, after being started.
+func (rl *Relay) Ready() <-chan struct{} {
+	return rl.ready
+}
+
+// ReloadAuthKey reloads the JWT secret from the AuthKeyFile, e.g. on SIGHUP, keeping the current one when it fails.
+func (rl *Relay) ReloadAuthKey() error {
+	if rl.authKey == nil || rl.cfg.AuthKeyFile == "" {
+		return errors.New("no JWT secret file to reload")
+	}
+	return rl.authKey.reload()
+}
+
+// Stop gracefully shuts the relay down, waiting for the in-flight requests to complete until ctx is done. The requests
+// waiting for a round are served normally if they fit in the ShutdownTimeout grace period of its configuration, and
+// drained otherwise.
+func (rl *Relay) Stop(ctx context.Context) error {
+	// waking up the requests waiting for the next round unless they fit in the grace period, they would otherwise
+	// block the shutdown
+	drain := time.AfterFunc(rl.settings.drainDelay(), rl.settings.drain.cancel)
+	defer drain.Stop()
+
+	// the grpc streams never complete on their own, so we don't wait on them
+	if rl.proxy != nil {
+		rl.proxy.Stop()
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, srv := range []*http.Server{rl.server, rl.private, rl.metrics} {
+		if srv == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s shutdown: %w", srv.Addr, err))
+				mu.Unlock()
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	rl.close()
+	return errors.Join(errs...)
+}
+
+// close stops the background tasks of the relay and releases its resources.
+func (rl *Relay) close() {
+	rl.cancel()
+	for _, c := range rl.closers {
+		c()
+	}
+	rl.closers = nil
+}
+
+// parseNodes splits the provided comma separated list of prioritized nodes, returning an error if they aren't all valid
+// host:port addresses.
+func parseNodes(nodes string) ([]string, error) {
+	backends, err := grpc.ParseBackends(nodes)
+	if err != nil {
+		return nil, err
+	}
+	nodesAddr := make([]string, 0, len(backends))
+	for _, b := range backends {
+		_, _, err := net.SplitHostPort(b.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("on %q: %w", b.Addr, err)
+		}
+		nodesAddr = append(nodesAddr, b.Addr)
+	}
+	return nodesAddr, nil
+}
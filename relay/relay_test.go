@@ -0,0 +1,66 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drand/http-server/grpc"
+)
+
+func TestRelayLifecycle(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MockBackend = true
+	cfg.Bind = "localhost:0"
+	cfg.MetricsBind = "localhost:0"
+	cfg.HTTPRegistry, cfg.GrpcRegistry = prometheus.NewRegistry(), prometheus.NewRegistry()
+
+	rl, err := New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, rl.Start())
+	select {
+	case <-rl.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the relay to load the chains of the mock backend")
+	}
+
+	var chains []string
+	getJSON(t, "http://"+rl.Addr().String()+"/v2/chains", http.StatusOK, &chains)
+	require.Len(t, chains, 1, "expected the mock chain only")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, rl.Stop(ctx))
+	_, err = http.Get("http://" + rl.Addr().String() + "/v2/chains")
+	require.Error(t, err, "expected the relay to be stopped")
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GrpcConnect = "localhost"
+	cfg.ShutdownTimeout = -time.Second
+	_, err := New(cfg)
+	require.ErrorContains(t, err, "--grpc-connect")
+	require.ErrorContains(t, err, "--shutdown-timeout")
+}
+
+func TestRelaysOwnSettings(t *testing.T) {
+	info := &grpc.JsonInfoV2{Period: 3, GenesisTime: time.Now().Add(-time.Minute).Unix(), Hash: bytes.Repeat([]byte{0xef}, 32), BeaconId: "quicknet"}
+	p := NewMockProvider(info)
+	p.AddBeacons(info.Hash.String(), &grpc.HexBeacon{Round: 1, Signature: []byte{0x01}})
+
+	short := DefaultConfig()
+	short.CacheImmutable = "public, max-age=60"
+	shortURL := serveRelayConfig(t, short, p, NewHub(p))
+	defaultURL := serveRelay(t, p, NewHub(p))
+
+	resp := getJSON(t, shortURL+"/v2/beacons/quicknet/rounds/1", http.StatusOK, nil)
+	require.Equal(t, "public, max-age=60", resp.Header.Get("Cache-Control"))
+	resp = getJSON(t, defaultURL+"/v2/beacons/quicknet/rounds/1", http.StatusOK, nil)
+	require.Equal(t, CacheImmutable, resp.Header.Get("Cache-Control"), "expected the relays not to share their settings")
+}
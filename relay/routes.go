@@ -0,0 +1,213 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// surface is the set of routes served by an http listener.
+type surface int
+
+const (
+	// surfaceAll serves all the routes, when running a single listener.
+	surfaceAll surface = iota
+	// surfacePublic only serves the beacon and chain info routes, it is meant to face the internet.
+	surfacePublic
+	// surfacePrivate serves all the routes along with the metrics, it is meant for internal networks only.
+	surfacePrivate
+)
+
+// allRoutes is populated in SetupRoutes after all routes have been setup
+// and used in DisplayRoutes to display available routes
+var allRoutes []string
+
+func DisplayRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the prefix query parameter.
+	prefixes := strings.Trim(r.URL.Path, "/")
+	// Filter the routes that match the prefix, if any. We copy allRoutes to avoid changing its content.
+	filteredRoutes := make([]string, len(allRoutes))
+	copy(filteredRoutes, allRoutes)
+	for _, prefix := range strings.Split(prefixes, "/") {
+		n := 0
+		for _, route := range filteredRoutes {
+			if strings.Contains(route, prefix) {
+				filteredRoutes[n] = route
+				n++
+			}
+		}
+		// we only update our list if some items matched
+		if n > 0 {
+			filteredRoutes = filteredRoutes[:n]
+		}
+	}
+
+	// in case we didn't have any matches, let's show all routes
+	if len(filteredRoutes) == 0 {
+		filteredRoutes = allRoutes
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", settingsOf(r).cacheImmutable)
+
+	slices.SortFunc(filteredRoutes, func(a, b string) int {
+		// cmp(a, b) should return a negative number when a < b, a positive number when
+		// a > b and zero when a == b.
+		if strings.HasPrefix(a, "GET /v2") && !strings.HasPrefix(b, "GET /v2") {
+			return 1
+		} else if !strings.HasPrefix(a, "GET /v2") && strings.HasPrefix(b, "GET /v2") {
+			return -1
+		}
+		return strings.Compare(a, b)
+	})
+
+	// We still report it as a 404
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(strings.Join(filteredRoutes, "\n")))
+}
+
+// setupRoutes sets up the routes of the provided surface on r.
+func (rl *Relay) setupRoutes(r *chi.Mux, s surface) {
+	client, hub := rl.client, rl.hub
+	// the health details, version and route listing aren't served on the public listener
+	private := s != surfacePublic
+	shed := shedLoad(rl.shedder)
+
+	// Catch-all route for any other GET request, we display routes instead
+	// we need to declare that before setup to avoid the r.Group to match first
+	// the listing can be hidden on the main listener, to not reveal it to the bot scans
+	if s == surfacePrivate || (private && !rl.cfg.HideRoutes) {
+		r.NotFound(shed(http.HandlerFunc(DisplayRoutes)).ServeHTTP)
+	}
+
+	r.Get("/public/18446744073709551615", sendMaxInt())
+
+	// v2 routes with optional ACL using JWT
+	r.Group(func(r chi.Router) {
+		// the v2 API can be restricted to some networks
+		r.Use(ipFilter(rl.v2IPAllow, nil, rl.trustedProxies))
+
+		// JWT authentication, tokens to be issued using the jwtissuer binary, or API keys authentication
+		if rl.cfg.RequireAuth {
+			// the audit trail comes first to record the rejected requests too
+			if rl.audit != nil {
+				r.Use(auditRequests(rl.audit))
+			}
+			if rl.v2Auth != nil {
+				r.Use(rl.v2Auth)
+			} else {
+				r.Use(denyAll)
+			}
+		}
+
+		// the usage of the tenants is metered, including their rate limited requests
+		if rl.cfg.RequireAuth && rl.tenants != nil {
+			r.Use(meterTenants(rl.tenants))
+		}
+		// per caller rate limits and quotas, relying on the authenticated identity
+		if rl.cfg.RequireAuth && rl.limiter != nil {
+			r.Use(rateLimitTokens(rl.limiter))
+		}
+		r.Route("/v2", func(r chi.Router) {
+			// use our common headers for the following routes
+			r.Use(addCommonHeaders)
+			r.Get("/chains", GetChainsV2(client))
+			r.Get("/beacons", GetBeaconIds(client))
+			if private {
+				r.Get("/version", GetVersion())
+			}
+			if rl.cfg.RequireAuth && rl.tenants != nil {
+				r.With(filterTenantChains(rl.tenants)).Get("/latest", GetLatestAll(client, hub))
+			} else {
+				r.Get("/latest", GetLatestAll(client, hub))
+			}
+
+			r.Group(func(r chi.Router) {
+				// we only serve the known chains, and the allowed ones among them, if any
+				r.Use(knownChains(client))
+				r.Use(allowedChains(client))
+				// and the tenants can be restricted to some of them
+				if rl.cfg.RequireAuth && rl.tenants != nil {
+					r.Use(tenantChains(client, rl.tenants))
+				}
+
+				r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/info", GetInfoV2(client))
+				r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/scheme", GetScheme(client))
+				if private {
+					r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/health", GetHealth(client, hub))
+					r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/status", GetStatus(client, hub))
+				}
+				r.With(shed).Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/rounds/{round:\\d+}", GetBeacon(client, true))
+				r.With(shed).Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/rounds/{round:\\d+}/signature", GetSignature(client))
+				r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/rounds/latest", GetLatest(client, hub, true))
+				r.Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/rounds/next", GetNext(client, hub))
+				r.With(shed).Get("/chains/{chainhash:[0-9A-Fa-f]{64}}/verify", VerifyLinks(client))
+
+				r.Get("/beacons/{beaconID}/info", GetInfoV2(client))
+				r.Get("/beacons/{beaconID}/scheme", GetScheme(client))
+				if private {
+					r.Get("/beacons/{beaconID}/health", GetHealth(client, hub))
+					r.Get("/beacons/{beaconID}/status", GetStatus(client, hub))
+				}
+				r.With(shed).Get("/beacons/{beaconID}/rounds/{round:\\d+}", GetBeacon(client, true))
+				r.With(shed).Get("/beacons/{beaconID}/rounds/{round:\\d+}/signature", GetSignature(client))
+				r.Get("/beacons/{beaconID}/rounds/latest", GetLatest(client, hub, true))
+				r.Get("/beacons/{beaconID}/rounds/next", GetNext(client, hub))
+				r.With(shed).Get("/beacons/{beaconID}/verify", VerifyLinks(client))
+			})
+		})
+	})
+
+	// v1 API CANNOT BE CHANGED until deprecation
+	r.Group(func(r chi.Router) {
+		// use our common headers for the following routes
+		r.Use(addCommonHeaders)
+
+		r.Get("/chains", GetChains(client))
+		if private {
+			r.Get("/version", GetVersion())
+		}
+
+		r.Group(func(r chi.Router) {
+			// we only serve the known chains, and the allowed ones among them, if any
+			r.Use(knownChains(client))
+			r.Use(allowedChains(client))
+
+			r.Get("/info", GetInfoV1(client))
+			if private {
+				r.Get("/health", GetHealth(client, hub))
+				r.Get("/{chainhash:[0-9A-Fa-f]{64}}/health", GetHealth(client, hub))
+			}
+			r.With(shed).Get("/public/{round:\\d+}", GetBeacon(client, false))
+			r.Get("/public/latest", GetLatest(client, hub, false))
+
+			r.Get("/{chainhash:[0-9A-Fa-f]{64}}/info", GetInfoV1(client))
+			r.With(shed).Get("/{chainhash:[0-9A-Fa-f]{64}}/public/{round:\\d+}", GetBeacon(client, false))
+			r.Get("/{chainhash:[0-9A-Fa-f]{64}}/public/latest", GetLatest(client, hub, false))
+		})
+	})
+
+	if !private {
+		return
+	}
+
+	// we want to populate all the routes served by our Chi router to display them in DisplayRoutes
+	allRoutes = make([]string, 0, 27)
+	// need to populate the all routes slice to display all existing routes
+	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// we don't show the special error route for max uint64
+		if strings.Contains(route, "18446744073709551615") {
+			return nil
+		}
+		route = strings.Replace(route, "/*/", "/", -1)
+		allRoutes = append(allRoutes, fmt.Sprintf("%s %s", method, route))
+		return nil
+	}
+	if err := chi.Walk(r, walkFunc); err != nil {
+		fmt.Printf("Logging err: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,964 @@
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/sync/errgroup"
+)
+
+// FrontrunTiming is how much earlier than the next round the queries for it are started by default, to counteract
+// network latency.
+var FrontrunTiming time.Duration
+
+func GetBeacon(c BeaconProvider, isV2 bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get beacon", http.StatusInternalServerError)
+			return
+		}
+
+		roundStr := chi.URLParam(r, "round")
+		round, err := strconv.ParseUint(roundStr, 10, 64)
+		if err != nil {
+			w.Header().Set("Cache-Control", s.cacheImmutable)
+			http.Error(w, "Failed to parse round. Err: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		info, err := c.GetChainInfo(r.Context(), m)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetBeacon] error retrieving chain info from primary client", "error", err)
+			backendError(w, r, err, "Failed to get beacon")
+			return
+		}
+
+		nextTime, nextRound := info.ExpectedNext()
+		if round >= nextRound+1 { // never happens when fetching latest because round == 0
+			w.Header().Set("Cache-Control", s.cacheNone)
+			slog.Debug("[GetBeacon] Future beacon was requested", "requested", round, "expected", nextRound, "from", r.RemoteAddr)
+			futureRound(w, info, round, round-nextRound > s.futureRounds)
+			return
+		} else if round == nextRound {
+			wait := time.Duration(nextTime-time.Now().Unix())*time.Second - s.frontrun
+			if s.acceptAfter > 0 && wait > s.acceptAfter {
+				slog.Debug("[GetBeacon] Next beacon was requested long before it is due", "requested", round, "wait", wait)
+				acceptedRound(w, r, info, round)
+				return
+			}
+			if !s.waiters.acquire(info.Hash.String(), s.maxWaiters) {
+				slog.Warn("[GetBeacon] too many requests waiting for the next round", "chainhash", info.Hash, "max", s.maxWaiters)
+				s.tooManyWaiters(w, info)
+				return
+			}
+			defer s.waiters.release(info.Hash.String())
+
+			// we wait until the round is supposed to be emitted, minus frontrun to account for network latency anyway
+			start := time.Now()
+			select {
+			case <-time.After(wait):
+			case <-s.drain.ctx.Done():
+				// the requested round isn't there yet, the latest beacon wouldn't do
+				s.serveDrained(w, info, nil, isV2)
+				return
+			case <-r.Context().Done():
+				w.Header().Set("Cache-Control", s.cacheNone)
+				http.Error(w, "timeout", http.StatusGatewayTimeout)
+				return
+			}
+			recordTiming(r, timingWait, start)
+		}
+
+		start = time.Now()
+		var beacon *grpc.HexBeacon
+		if round != 0 && round < nextRound {
+			beacon, err = historicalBeacon(r.Context(), s.upstream, c, m, info, round)
+		} else {
+			beacon, err = c.GetBeacon(r.Context(), m, round)
+		}
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("all clients are unable to provide beacons", "error", err)
+			backendError(w, r, err, "Failed to get beacon")
+			return
+		}
+
+		if isV2 {
+			// we make sure that the V2 api aren't marshaling randommness
+			beacon.UnsetRandomness()
+		} else {
+			// we need to set the randomness since the nodes are not supposed to send it over the wire anymore
+			beacon.SetRandomness()
+		}
+
+		start = time.Now()
+		buf, err := encodeBeacon(r, c, m, beacon)
+		recordTiming(r, timingEncode, start)
+		if err != nil {
+			w.Header().Set("Cache-Control", s.cacheNone)
+			http.Error(w, "Failed to Encode beacon in hex", http.StatusInternalServerError)
+			return
+		}
+		defer buf.release()
+
+		if round != 0 {
+			// i.e. we're not fetching latest, we can store these beacons for a long time
+			w.Header().Set("Cache-Control", s.cacheImmutable)
+			s.setSurrogateKeys(w, info.Hash.String(), roundStr)
+		} else {
+			// we're fetching latest we need to stop caching in time for the next round
+			cacheControl := s.latestCacheControl(nextTime, 0)
+			w.Header().Set("Cache-Control", cacheControl)
+			s.setSurrogateKeys(w, info.Hash.String(), "latest", strconv.FormatUint(beacon.Round, 10))
+			slog.Debug("[GetBeacon] StatusOK", "cachecontrol", cacheControl)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	}
+}
+
+// AcceptAfter is the default wait above which the requests for the next round get a 202 status telling when to come
+// back instead of being held until it is emitted. Disabled when set to 0.
+var AcceptAfter time.Duration
+
+// pendingBeacon is the body returned when the next round is requested long before it is due.
+type pendingBeacon struct {
+	Round       uint64 `json:"round"`
+	AvailableAt int64  `json:"available_at"`
+}
+
+// acceptedRound replies to a request for the next round with a 202 status, pointing the client to the round url using
+// the Location header and telling it when to come back using the Retry-After header.
+func acceptedRound(w http.ResponseWriter, r *http.Request, info *grpc.JsonInfoV2, round uint64) {
+	availableAt := info.RoundTime(round)
+	w.Header().Set("Cache-Control", settingsOf(r).cacheNone)
+	w.Header().Set("Location", r.URL.RequestURI())
+	w.Header().Set("Retry-After", strconv.FormatInt(max(availableAt-time.Now().Unix(), 1), 10))
+
+	json, err := json.Marshal(&pendingBeacon{Round: round, AvailableAt: availableAt})
+	if err != nil {
+		slog.Error("[GetBeacon] unable to encode pending beacon response in json", "error", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(json)
+}
+
+// backendError replies to a request whose backend call failed using the status matching the typed error returned by
+// the grpc client, or a 500 status with the provided message. Such responses are never cached.
+func backendError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	w.Header().Set("Cache-Control", settingsOf(r).cacheNone)
+	switch {
+	case errors.Is(err, grpc.ErrUnknownChain):
+		http.Error(w, "unknown chain", http.StatusNotFound)
+	case errors.Is(err, grpc.ErrTimeout), errors.Is(err, context.Canceled), errors.Is(r.Context().Err(), context.DeadlineExceeded):
+		http.Error(w, "timeout", http.StatusGatewayTimeout)
+	case errors.Is(err, grpc.ErrRoundNotAvailable):
+		http.Error(w, "round not available", http.StatusNotFound)
+	case errors.Is(err, grpc.ErrBackendUnavailable):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "backend unavailable", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
+
+// FutureRounds is the default number of rounds after the next one for which a request is considered too early rather
+// than asking for a round far in the future.
+var FutureRounds uint64 = 10
+
+// futureBeacon is the body returned when a future round is requested, telling when it will be available.
+type futureBeacon struct {
+	Error       string `json:"error"`
+	Round       uint64 `json:"round"`
+	AvailableAt int64  `json:"available_at"`
+}
+
+// futureRound replies to a request for a round that isn't available yet, with a 425 status and a Retry-After header if
+// it is in the next few rounds, or with a 404 status if it is far in the future.
+func futureRound(w http.ResponseWriter, info *grpc.JsonInfoV2, round uint64, far bool) {
+	availableAt := info.RoundTime(round)
+	resp := &futureBeacon{Error: "Requested future beacon", Round: round, AvailableAt: availableAt}
+
+	// I know, 425 is meant to indicate a replay attack risk, but hey, it's the perfect error name!
+	status := http.StatusTooEarly
+	if far {
+		resp.Error = "Requested beacon far in the future"
+		status = http.StatusNotFound
+	} else {
+		w.Header().Set("Retry-After", strconv.FormatInt(max(availableAt-time.Now().Unix(), 1), 10))
+	}
+
+	json, err := json.Marshal(resp)
+	if err != nil {
+		slog.Error("[GetBeacon] unable to encode future beacon response in json", "error", err)
+		http.Error(w, resp.Error, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(json)
+}
+
+// GetVersion serves the build information of the relay.
+func GetVersion() func(http.ResponseWriter, *http.Request) {
+	info := getBuildInfo()
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		json, err := json.Marshal(info)
+		if err != nil {
+			slog.Error("[GetVersion] failed to encode build info in json", "error", err)
+			http.Error(w, "Failed to encode build info", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", s.cacheInfo)
+		w.Write(json)
+	}
+}
+
+func GetChains(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chains, err := c.GetChains(r.Context())
+		if err != nil {
+			if err != nil {
+				slog.Error("failed to get chains from all clients", "error", err)
+				http.Error(w, "Failed to get chains", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json, err := json.Marshal(chains)
+		if err != nil {
+			slog.Error("failed to encode chain in json", "error", err)
+			http.Error(w, "Failed to encode chains", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(json)
+	}
+}
+
+// maxChainsLimit bounds the number of chains returned at once by GetChainsV2
+const maxChainsLimit = 1000
+
+// GetChainsV2 is paginated using the limit and offset query parameters, it sets the X-Total-Count header to the total
+// number of chains available. Unlike GetChains, it doesn't need to fetch the chain info of every chain, unless the
+// info=true query parameter is set, in which case the full chain infos are returned instead of their chainhashes.
+func GetChainsV2(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, "Invalid pagination: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_, metadatas, err := c.GetBeaconIds(r.Context())
+		if err != nil {
+			slog.Error("[GetChainsV2] failed to get beacon ids from client", "error", err)
+			http.Error(w, "Failed to get chains", http.StatusInternalServerError)
+			return
+		}
+
+		chains := make([]string, 0, len(metadatas))
+		for _, m := range metadatas {
+			chains = append(chains, hex.EncodeToString(m.GetChainHash()))
+		}
+		// we need a stable order for pagination
+		slices.Sort(chains)
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(chains)))
+		chains = paginate(chains, limit, offset)
+
+		var resp any = chains
+		if r.URL.Query().Get("info") == "true" {
+			// we embed the full chain infos, saving clients a round-trip per chain
+			infos := make([]*grpc.JsonInfoV2, 0, len(chains))
+			for _, chain := range chains {
+				hash, _ := hex.DecodeString(chain)
+				info, err := c.GetChainInfo(r.Context(), &proto.Metadata{ChainHash: hash})
+				if err != nil {
+					slog.Error("[GetChainsV2] failed to get ChainInfo", "chain", chain, "error", err)
+					http.Error(w, "Failed to get ChainInfo", http.StatusInternalServerError)
+					return
+				}
+				infos = append(infos, info)
+			}
+			resp = infos
+		}
+
+		json, err := json.Marshal(resp)
+		if err != nil {
+			slog.Error("[GetChainsV2] failed to encode chains in json", "error", err)
+			http.Error(w, "Failed to encode chains", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(json)
+	}
+}
+
+// parsePagination returns the limit and offset query parameters, the limit being bounded by maxChainsLimit.
+func parsePagination(r *http.Request) (limit, offset int, err error) {
+	limit = maxChainsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = min(limit, maxChainsLimit)
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// paginate returns the items designated by the limit and offset, offset+limit may overflow so we never compute it.
+func paginate[T any](items []T, limit, offset int) []T {
+	start := min(offset, len(items))
+	return items[start : start+min(limit, len(items)-start)]
+}
+
+// GetHealth relies on the chain info cached by the client and on the latest beacon observed by the hub, so that
+// frequent health checks only reach the backends when the hub is lagging behind.
+func GetHealth(c BeaconProvider, hub *Hub) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// we never cache health requests (rate-limiting should prevent DoS at the proxy level)
+		w.Header().Set("Cache-Control", "no-cache")
+
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetHealth] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get health", http.StatusInternalServerError)
+			return
+		}
+
+		info, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[GetHealth] failed to get chain info", "error", err)
+			http.Error(w, "Failed to get chain info for health", http.StatusInternalServerError)
+			return
+		}
+		_, next := info.ExpectedNext()
+
+		latest, _ := hub.Latest(info.Hash.String())
+		if latest == nil || next-2 > latest.Round {
+			slog.Debug("[GetHealth] hub lagging behind, querying backends")
+			latest, err = c.GetBeacon(r.Context(), m, 0)
+			if err != nil {
+				slog.Error("[GetHealth] failed to get latest beacon", "error", err)
+				http.Error(w, "Failed to get latest beacon for health", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if next-2 > latest.Round {
+			// we force a retry with another backend if we see a discrepancy in case that backend is stuck on a old latest beacon
+			slog.Debug("[GetHealth] forcing retry with other SubConn")
+			ctx := context.WithValue(r.Context(), grpc.SkipCtxKey{}, true)
+			latest, err = c.GetBeacon(ctx, m, 0)
+			if err != nil {
+				slog.Error("[GetHealth] failed to get latest beacon", "error", err)
+				http.Error(w, "Failed to get latest beacon for health", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if latest.Round >= next-2 {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			slog.Debug("[GetHealth] http.StatusServiceUnavailable", "current", latest.Round, "expected", next-1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		resp := make(map[string]uint64)
+		resp["current"] = latest.Round
+		resp["expected"] = next - 1
+
+		json, err := json.Marshal(resp)
+		if err != nil {
+			slog.Error("[GetHealth] unable to encode HealthStatus in json", "error", err)
+			http.Error(w, "Failed to encode HealthStatus", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(json)
+	}
+}
+
+func GetBeaconIds(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ids, _, err := c.GetBeaconIds(r.Context())
+		if err != nil {
+			slog.Error("[GetBeaconIds] failed to get beacon ids from client", "error", err)
+			http.Error(w, "Failed to get beacon ids", http.StatusServiceUnavailable)
+			return
+		}
+
+		json, err := json.Marshal(ids)
+		if err != nil {
+			slog.Error("[GetBeaconIds] failed to encode beacon ids in json", "error", err)
+			http.Error(w, "Failed to produce beacon ids", http.StatusInternalServerError)
+		}
+		w.Write(json)
+	}
+}
+
+func GetInfoV1(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetInfoV1] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get info", http.StatusInternalServerError)
+			return
+		}
+
+		chains, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[GetInfoV1] failed to get ChainInfo from all clients", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		json, err := json.Marshal(chains.V1())
+		if err != nil {
+			slog.Error("[GetInfoV1] unable to encode ChainInfo in json", "error", err)
+			http.Error(w, "Failed to encode ChainInfo", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", s.infoCacheControl())
+		s.setSurrogateKeys(w, chains.Hash.String(), "info")
+		w.Write(json)
+	}
+}
+
+func GetInfoV2(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetInfoV2] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get info", http.StatusInternalServerError)
+			return
+		}
+
+		chains, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[GetInfoV2] failed to get ChainInfo", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		json, err := json.Marshal(chains)
+		if err != nil {
+			slog.Error("[GetInfoV2] unable to encode ChainInfo in json", "error", err)
+			http.Error(w, "Failed to encode ChainInfo", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", s.infoCacheControl())
+		s.setSurrogateKeys(w, chains.Hash.String(), "info")
+		w.Write(json)
+	}
+}
+
+// ChainStatus is the current timing status of a chain, as computed by the relay.
+type ChainStatus struct {
+	Hash                grpc.HexBytes `json:"chain_hash"`
+	CurrentRound        uint64        `json:"current_round"`
+	NextRound           uint64        `json:"next_round"`
+	NextRoundTime       int64         `json:"next_round_time"`
+	TimeUntilNextMs     int64         `json:"time_until_next_ms"`
+	LatestObservedRound uint64        `json:"latest_observed_round,omitempty"`
+}
+
+// GetScheme serves the cryptographic details of the scheme of the chain, as needed to verify its beacons.
+func GetScheme(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetScheme] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get scheme", http.StatusInternalServerError)
+			return
+		}
+
+		info, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[GetScheme] failed to get ChainInfo", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		scheme, err := grpc.SchemeDetails(info.Scheme)
+		if err != nil {
+			slog.Error("[GetScheme] unknown chain scheme", "scheme", info.Scheme, "error", err)
+			http.Error(w, "Unknown scheme", http.StatusInternalServerError)
+			return
+		}
+
+		json, err := json.Marshal(scheme)
+		if err != nil {
+			slog.Error("[GetScheme] unable to encode scheme in json", "error", err)
+			http.Error(w, "Failed to encode scheme", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", s.infoCacheControl())
+		s.setSurrogateKeys(w, info.Hash.String(), "info")
+		w.Write(json)
+	}
+}
+
+func GetStatus(c BeaconProvider, hub *Hub) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the status changes every round, we don't want it to be cached
+		w.Header().Set("Cache-Control", "no-cache")
+
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetStatus] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get status", http.StatusInternalServerError)
+			return
+		}
+
+		info, err := c.GetChainInfo(r.Context(), m)
+		if err != nil {
+			slog.Error("[GetStatus] failed to get ChainInfo", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		nextTime, next := info.ExpectedNext()
+		status := &ChainStatus{
+			Hash:            info.Hash,
+			CurrentRound:    next - 1,
+			NextRound:       next,
+			NextRoundTime:   nextTime,
+			TimeUntilNextMs: time.Until(time.Unix(nextTime, 0)).Milliseconds(),
+		}
+		if latest, _ := hub.Latest(info.Hash.String()); latest != nil {
+			status.LatestObservedRound = latest.Round
+		}
+
+		json, err := json.Marshal(status)
+		if err != nil {
+			slog.Error("[GetStatus] unable to encode ChainStatus in json", "error", err)
+			http.Error(w, "Failed to encode ChainStatus", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(json)
+	}
+}
+
+func GetLatest(c BeaconProvider, hub *Hub, isV2 bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetLatest] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get latest", http.StatusInternalServerError)
+			return
+		}
+
+		start := time.Now()
+		info, err := c.GetChainInfo(r.Context(), m)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetLatest] unable to get chain info", "error", err)
+			// we can't know when the next round happens, so we don't cache the response
+			w.Header().Set("Cache-Control", s.cacheNone)
+			// nor can we wait for it, serving the latest beacon would break the long poll contract
+			if isV2 && r.URL.Query().Has("after") {
+				http.Error(w, "Failed to get ChainInfo", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			// long polling for a round newer than the one provided using ?after=N
+			if isV2 && r.URL.Query().Has("after") {
+				serveLongPoll(w, r, c, hub, m, info)
+				return
+			}
+
+			nextTime, next := info.ExpectedNext()
+			w.Header().Set("Cache-Control", s.latestCacheControl(nextTime, 0))
+
+			// we serve the precomputed json of the hub if it is up-to-date, to avoid marshaling it on every request
+			if r.URL.Query().Get("include") == "" && r.URL.Query().Get("encoding") == "" {
+				if round, json, at := hub.latestJSON(info.Hash.String(), isV2); json != nil && round >= next-1 {
+					slog.Debug("[GetLatest] serving latest from hub", "round", round)
+					s.setCachedLatest(w, nextTime, at)
+					s.setSurrogateKeys(w, info.Hash.String(), "latest", strconv.FormatUint(round, 10))
+					w.Write(json)
+					return
+				}
+			}
+		}
+
+		start = time.Now()
+		beacon, err := c.GetBeacon(r.Context(), m, 0)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetLatest] unable to get beacon from any grpc client", "error", err)
+			backendError(w, r, err, "Failed to get beacon")
+			return
+		}
+
+		// TODO: should we rather use the api.version key from the request context set in apiVersionCtx?
+		// the current way of doing it probably allows the compiler to inline the right path tho...
+		if isV2 {
+			// we make sure that the V2 api aren't marshaling randommness
+			beacon.UnsetRandomness()
+		} else {
+			// we need to set the randomness since the nodes are not supposed to send it over the wire anymore
+			beacon.SetRandomness()
+		}
+
+		start = time.Now()
+		buf, err := encodeBeacon(r, c, m, beacon)
+		recordTiming(r, timingEncode, start)
+		if err != nil {
+			slog.Error("[GetLatest] unable to encode beacon in json", "error", err)
+			w.Header().Set("Cache-Control", s.cacheNone)
+			http.Error(w, "Failed to encode beacon", http.StatusInternalServerError)
+			return
+		}
+		defer buf.release()
+
+		if info != nil {
+			s.setSurrogateKeys(w, info.Hash.String(), "latest", strconv.FormatUint(beacon.Round, 10))
+		}
+
+		w.Write(buf.Bytes())
+	}
+}
+
+// maxLatestAllFetches bounds the number of chains whose latest beacon is retrieved at the same time by GetLatestAll.
+const maxLatestAllFetches = 8
+
+// GetLatestAll serves the latest beacon of every chain served by the relay, keyed by chainhash. The chains whose
+// latest beacon can't be retrieved are left out, so that a single failing chain doesn't hide all the others.
+func GetLatestAll(c BeaconProvider, hub *Hub) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		chains, err := c.GetChains(r.Context())
+		if err != nil {
+			slog.Error("[GetLatestAll] failed to get chains from all clients", "error", err)
+			w.Header().Set("Cache-Control", s.cacheNone)
+			http.Error(w, "Failed to get chains", http.StatusInternalServerError)
+			return
+		}
+		// the tenants restricted to some chains only get those
+		chains = slices.DeleteFunc(chains, func(chain string) bool {
+			if allowsChain(r, chain, "") {
+				return false
+			}
+			// they can be restricted to beacon IDs rather than chainhashes
+			hash, _ := hex.DecodeString(chain)
+			info, err := c.GetChainInfo(r.Context(), &proto.Metadata{ChainHash: hash})
+			return err != nil || !allowsChain(r, chain, info.BeaconId)
+		})
+
+		// the chains are retrieved concurrently, each one having its own slot so that the results keep their order
+		beacons := make([]json.RawMessage, len(chains))
+		nextTimes := make([]int64, len(chains))
+		var g errgroup.Group
+		g.SetLimit(maxLatestAllFetches)
+		for i, chain := range chains {
+			g.Go(func() error {
+				beacons[i], nextTimes[i] = latestOf(r.Context(), c, hub, chain)
+				return nil
+			})
+		}
+		g.Wait()
+
+		var firstNext int64
+		latest := make(map[string]json.RawMessage, len(chains))
+		for i, chain := range chains {
+			if nextTimes[i] != 0 && (firstNext == 0 || nextTimes[i] < firstNext) {
+				firstNext = nextTimes[i]
+			}
+			if beacons[i] != nil {
+				latest[chain] = beacons[i]
+			}
+		}
+
+		json, err := json.Marshal(latest)
+		if err != nil {
+			slog.Error("[GetLatestAll] failed to encode beacons in json", "error", err)
+			w.Header().Set("Cache-Control", s.cacheNone)
+			http.Error(w, "Failed to encode beacons", http.StatusInternalServerError)
+			return
+		}
+
+		if len(latest) < len(chains) || firstNext == 0 {
+			w.Header().Set("Cache-Control", s.cacheNone)
+		} else {
+			// the response is stale as soon as any of the chains has a new round
+			w.Header().Set("Cache-Control", s.latestCacheControl(firstNext, 0))
+		}
+		w.Write(json)
+	}
+}
+
+// latestOf returns the v2 json encoding of the latest beacon of the provided hex-encoded chainhash, along with the
+// time of its next round. The beacon is nil if it can't be retrieved, and the time 0 if the chain info can't be.
+func latestOf(ctx context.Context, c BeaconProvider, hub *Hub, chain string) (json.RawMessage, int64) {
+	hash, _ := hex.DecodeString(chain)
+	m := &proto.Metadata{ChainHash: hash}
+	info, err := c.GetChainInfo(ctx, m)
+	if err != nil {
+		slog.Error("[GetLatestAll] unable to get chain info", "chain", chain, "error", err)
+		return nil, 0
+	}
+	nextTime, next := info.ExpectedNext()
+
+	if round, json := hub.LatestJSON(chain, true); json != nil && round >= next-1 {
+		return json, nextTime
+	}
+
+	beacon, err := c.GetBeacon(ctx, m, 0)
+	if err != nil {
+		slog.Error("[GetLatestAll] unable to get beacon from any grpc client", "chain", chain, "error", err)
+		return nil, nextTime
+	}
+	return newObservedBeacon(beacon).jsonV2, nextTime
+}
+
+// GetNext waits for the next beacon, unless the relay is shutting down in which case the latest one observed by the
+// hub is served instead.
+func GetNext(c BeaconProvider, hub *Hub) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetNext] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get latest", http.StatusInternalServerError)
+			return
+		}
+
+		start := time.Now()
+		info, err := c.GetChainInfo(r.Context(), m)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetNext] unable to get chain info", "error", err)
+			backendError(w, r, err, "Failed to get beacon")
+			return
+		}
+
+		if !s.waiters.acquire(info.Hash.String(), s.maxWaiters) {
+			slog.Warn("[GetNext] too many requests waiting for the next round", "chainhash", info.Hash, "max", s.maxWaiters)
+			s.tooManyWaiters(w, info)
+			return
+		}
+		defer s.waiters.release(info.Hash.String())
+
+		ctx, cancel := s.untilDrained(r.Context())
+		defer cancel()
+		start = time.Now()
+		beacon, err := c.Next(ctx, m)
+		recordTiming(r, timingWait, start)
+		if err != nil && s.drain.ctx.Err() != nil && r.Context().Err() == nil {
+			s.serveDrained(w, info, hub, true)
+			return
+		}
+		if err != nil {
+			slog.Error("[GetNext] unable to get next beacon from any grpc client", "error", err)
+			http.Error(w, "Failed to get beacon", http.StatusInternalServerError)
+			return
+		}
+
+		start = time.Now()
+		buf, err := encodeBeacon(r, c, m, beacon)
+		recordTiming(r, timingEncode, start)
+		if err != nil {
+			slog.Error("[GetNext] unable to encode beacon in json", "error", err)
+			http.Error(w, "Failed to encode beacon", http.StatusInternalServerError)
+			return
+		}
+		defer buf.release()
+
+		w.Write(buf.Bytes())
+	}
+}
+
+// beaconWithMeta is a beacon enriched with the metadata of its chain, returned when using ?include=meta
+type beaconWithMeta struct {
+	*grpc.HexBeacon
+	ChainHash grpc.HexBytes `json:"chain_hash"`
+	BeaconID  string        `json:"beacon_id"`
+	Timestamp int64         `json:"timestamp"`
+}
+
+// GetSignature serves only the signature of a past round, hex-encoded as text or as raw bytes when using
+// ?encoding=raw, for the verifiers such as smart-contract oracles that only need to submit the signature.
+func GetSignature(c BeaconProvider) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := settingsOf(r)
+		m, err := createRequestMD(r)
+		if err != nil {
+			slog.Error("[GetSignature] unable to create metadata for request", "error", err)
+			http.Error(w, "Failed to get signature", http.StatusInternalServerError)
+			return
+		}
+
+		roundStr := chi.URLParam(r, "round")
+		round, err := strconv.ParseUint(roundStr, 10, 64)
+		if err != nil || round == 0 {
+			w.Header().Set("Cache-Control", s.cacheImmutable)
+			http.Error(w, "Failed to parse round, it must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		encoding := r.URL.Query().Get("encoding")
+		if encoding != "" && encoding != "hex" && encoding != "raw" {
+			w.Header().Set("Cache-Control", s.cacheImmutable)
+			http.Error(w, "Unsupported encoding, use hex or raw", http.StatusBadRequest)
+			return
+		}
+
+		start := time.Now()
+		info, err := c.GetChainInfo(r.Context(), m)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetSignature] unable to get chain info", "error", err)
+			backendError(w, r, err, "Failed to get ChainInfo")
+			return
+		}
+
+		// there's no waiting for the next round here, the verifiers only submit signatures that already exist
+		if _, next := info.ExpectedNext(); round >= next {
+			w.Header().Set("Cache-Control", s.cacheNone)
+			futureRound(w, info, round, round-next > s.futureRounds)
+			return
+		}
+
+		start = time.Now()
+		beacon, err := historicalBeacon(r.Context(), s.upstream, c, m, info, round)
+		recordTiming(r, timingGrpc, start)
+		if err != nil {
+			slog.Error("[GetSignature] unable to get beacon from any grpc client", "error", err)
+			backendError(w, r, err, "Failed to get beacon")
+			return
+		}
+
+		w.Header().Set("Cache-Control", s.cacheImmutable)
+		s.setSurrogateKeys(w, info.Hash.String(), roundStr)
+		if encoding == "raw" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(beacon.Signature)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(hex.EncodeToString(beacon.Signature)))
+	}
+}
+
+// base64Beacon is a beacon whose signatures and randomness are base64-encoded, as in the protobuf JSON mapping, rather
+// than hex-encoded. It is returned when using ?encoding=base64, along with the metadata of its chain when using
+// ?include=meta.
+type base64Beacon struct {
+	Round             uint64        `json:"round"`
+	Randomness        []byte        `json:"randomness,omitempty"`
+	Signature         []byte        `json:"signature"`
+	PreviousSignature []byte        `json:"previous_signature,omitempty"`
+	ChainHash         grpc.HexBytes `json:"chain_hash,omitempty"`
+	BeaconID          string        `json:"beacon_id,omitempty"`
+	Timestamp         int64         `json:"timestamp,omitempty"`
+}
+
+// encodeBeacon marshals the beacon in json, enriching it with its chain metadata if the include=meta query
+// parameter is set, and encoding its bytes in base64 rather than hex if the encoding=base64 query parameter is set.
+// The returned buffer must be released once written.
+func encodeBeacon(r *http.Request, c BeaconProvider, m *proto.Metadata, beacon *grpc.HexBeacon) (*jsonBuffer, error) {
+	var b64 *base64Beacon
+	if r.URL.Query().Get("encoding") == "base64" {
+		b64 = &base64Beacon{
+			Round:             beacon.Round,
+			Randomness:        beacon.Randomness,
+			Signature:         beacon.Signature,
+			PreviousSignature: beacon.PreviousSignature,
+		}
+	}
+
+	if r.URL.Query().Get("include") != "meta" {
+		if b64 != nil {
+			return encodeJSON(b64)
+		}
+		return encodeJSON(beacon)
+	}
+
+	info, err := c.GetChainInfo(r.Context(), m)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get chain info for beacon metadata: %w", err)
+	}
+
+	if b64 != nil {
+		b64.ChainHash, b64.BeaconID, b64.Timestamp = info.Hash, info.BeaconId, info.RoundTime(beacon.Round)
+		return encodeJSON(b64)
+	}
+	return encodeJSON(&beaconWithMeta{
+		HexBeacon: beacon,
+		ChainHash: info.Hash,
+		BeaconID:  info.BeaconId,
+		Timestamp: info.RoundTime(beacon.Round),
+	})
+}
+
+func createRequestMD(r *http.Request) (*proto.Metadata, error) {
+	chainhash := chi.URLParam(r, "chainhash")
+	beaconID := chi.URLParam(r, "beaconID")
+
+	// handling the default case
+	if chainhash == "" && beaconID == "" {
+		return &proto.Metadata{BeaconID: common.DefaultBeaconID}, nil
+	}
+
+	// warning when unusual request is built
+	if len(chainhash) == 64 && beaconID != "" {
+		slog.Warn("[createRequestMD] unexpectedly, createRequestMD got both a chainhash and a beaconID. Ignoring beaconID")
+	}
+
+	// handling the beacon ID case
+	if beaconID != "" && chainhash == "" {
+		return &proto.Metadata{BeaconID: beaconID}, nil
+	}
+
+	// handling the chain hash case
+	hash, err := hex.DecodeString(chainhash)
+	if err != nil {
+		slog.Error("[createRequestMD] error decoding hex", "chainhash", chainhash, "error", err)
+		return nil, errors.New("unable to decode chainhash as hex")
+	}
+
+	return &proto.Metadata{ChainHash: hash}, nil
+}
@@ -0,0 +1,307 @@
+package relay
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// serveRelay serves the relay handlers using the provided client and hub, returning its url.
+func serveRelay(t *testing.T, client BeaconProvider, hub *Hub) string {
+	return serveRelayConfig(t, DefaultConfig(), client, hub)
+}
+
+// serveRelayConfig serves a relay using the provided configuration, returning its url.
+func serveRelayConfig(t *testing.T, cfg Config, client BeaconProvider, hub *Hub) string {
+	rl := newRelay(cfg, client, hub)
+	t.Cleanup(rl.close)
+	srv := httptest.NewServer(rl.handler(surfaceAll))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newTestRelay starts a relay using the provided configuration backed by an in-process mock drand node, returning its
+// url and the mock chainhash.
+func newTestRelay(t *testing.T, cfg Config) (string, string) {
+	mock, addr, err := grpc.StartMockBackend("localhost:0", time.Now().Add(-time.Hour), 3*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(mock.Stop)
+
+	c, err := grpc.NewClient("fallback:///"+addr, slog.Default())
+	require.NoError(t, err)
+	client := grpc.NewBackends(c, slog.Default())
+	t.Cleanup(func() { client.Close() })
+
+	url := serveRelayConfig(t, cfg, client, NewHub(client))
+	var chains []string
+	getJSON(t, url+"/chains", http.StatusOK, &chains)
+	require.Len(t, chains, 1, "expected the mock chain only")
+	return url, chains[0]
+}
+
+// get sends the provided request, returning its response along with its body.
+func get(t *testing.T, req *http.Request) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func getJSON(t *testing.T, url string, status int, v any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	resp, body := get(t, req)
+	require.Equal(t, status, resp.StatusCode, "GET %s: %s", url, body)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(body, v), "GET %s: invalid json %q", url, body)
+	}
+	return resp
+}
+
+func TestHandlersWithMockBackend(t *testing.T) {
+	url, chain := newTestRelay(t, DefaultConfig())
+
+	var info grpc.JsonInfoV2
+	getJSON(t, url+"/v2/chains/"+chain+"/info", http.StatusOK, &info)
+	require.Equal(t, chain, info.Hash.String())
+	_, next := info.ExpectedNext()
+
+	var latest grpc.HexBeacon
+	getJSON(t, url+"/public/latest", http.StatusOK, &latest)
+	require.GreaterOrEqual(t, latest.Round+1, next-1)
+	require.NotEmpty(t, latest.Randomness, "v1 beacons must have their randomness set")
+
+	var first grpc.HexBeacon
+	resp := getJSON(t, url+"/v2/chains/"+chain+"/rounds/1", http.StatusOK, &first)
+	require.Equal(t, uint64(1), first.Round)
+	require.Empty(t, first.Randomness)
+	require.Equal(t, CacheImmutable, resp.Header.Get("Cache-Control"), "unexpected Cache-Control for a past beacon")
+
+	var future futureBeacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/100000000", http.StatusNotFound, &future)
+	require.Equal(t, uint64(100000000), future.Round)
+	require.Greater(t, future.AvailableAt, time.Now().Unix())
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/"+strconv.FormatUint(next+2, 10), http.StatusTooEarly, &future)
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/"+strconv.FormatUint(math.MaxUint64, 10), http.StatusNotFound, &future)
+	require.Equal(t, int64(math.MaxInt64), future.AvailableAt)
+
+	var polled grpc.HexBeacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/latest?after=1", http.StatusOK, &polled)
+	require.Greater(t, polled.Round, uint64(1))
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/latest?after=abc", http.StatusBadRequest, nil)
+
+	var b64 base64Beacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/1?encoding=base64", http.StatusOK, &b64)
+	require.Equal(t, []byte(first.Signature), b64.Signature)
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/latest?encoding=base64&include=meta", http.StatusOK, &b64)
+	require.NotZero(t, b64.Round)
+	require.Equal(t, chain, b64.ChainHash.String())
+	var raw map[string]any
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/1?encoding=base64", http.StatusOK, &raw)
+	require.Equal(t, base64.StdEncoding.EncodeToString(first.Signature), raw["signature"])
+
+	sigURL := url + "/v2/chains/" + chain + "/rounds/1/signature"
+	req, err := http.NewRequest(http.MethodGet, sigURL, nil)
+	require.NoError(t, err)
+	resp, body := get(t, req)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, first.Signature.String(), string(body))
+	req, err = http.NewRequest(http.MethodGet, sigURL+"?encoding=raw", nil)
+	require.NoError(t, err)
+	resp, body = get(t, req)
+	require.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	require.Equal(t, []byte(first.Signature), body)
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/"+strconv.FormatUint(next+2, 10)+"/signature", http.StatusTooEarly, &future)
+	getJSON(t, sigURL+"?encoding=base58", http.StatusBadRequest, nil)
+
+	// the mock chain is unchained, its beacons have no links to verify
+	var links chainLinks
+	getJSON(t, url+"/v2/chains/"+chain+"/verify?from=1&to=10", http.StatusOK, &links)
+	require.Equal(t, chainLinks{From: 1, To: 10, Valid: true}, links)
+	getJSON(t, url+"/v2/chains/"+chain+"/verify?from=10&to=1", http.StatusBadRequest, nil)
+	getJSON(t, url+"/v2/chains/"+chain+"/verify?from=1&to="+strconv.FormatUint(next, 10), http.StatusBadRequest, nil)
+	getJSON(t, url+"/v2/chains/"+chain+"/verify?from=1&to=1100", http.StatusBadRequest, nil)
+
+	var scheme grpc.JsonScheme
+	getJSON(t, url+"/v2/chains/"+chain+"/scheme", http.StatusOK, &scheme)
+	require.Equal(t, info.Scheme, scheme.Name)
+	require.NotEmpty(t, scheme.DST)
+
+	var all map[string]grpc.HexBeacon
+	getJSON(t, url+"/v2/latest", http.StatusOK, &all)
+	require.Len(t, all, 1)
+	require.NotZero(t, all[chain].Round)
+
+	for _, path := range []string{"/version", "/v2/version"} {
+		var build buildInfo
+		getJSON(t, url+path, http.StatusOK, &build)
+		require.Equal(t, Version, build.Version, path)
+		require.NotEmpty(t, build.GoVersion, path)
+		require.Len(t, build.APIVersions, 2, path)
+	}
+}
+
+func TestUnknownChains(t *testing.T) {
+	url, chain := newTestRelay(t, DefaultConfig())
+
+	unknown := strings.Repeat("ab", 32)
+	for _, path := range []string{
+		"/v2/chains/" + unknown + "/info",
+		"/v2/chains/" + unknown + "/rounds/1",
+		"/" + unknown + "/public/latest",
+	} {
+		getJSON(t, url+path, http.StatusNotFound, nil)
+	}
+	getJSON(t, url+"/v2/chains/"+chain+"/info", http.StatusOK, nil)
+}
+
+func TestPublicSurface(t *testing.T) {
+	routes := func(s surface) []string {
+		r := chi.NewRouter()
+		newRelay(DefaultConfig(), nil, nil).setupRoutes(r, s)
+		var routes []string
+		chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			routes = append(routes, route)
+			return nil
+		})
+		return routes
+	}
+
+	for _, route := range routes(surfacePublic) {
+		for _, private := range []string{"/health", "/status", "/version"} {
+			require.NotContains(t, route, private, "unexpected private route on the public surface")
+		}
+	}
+	require.Contains(t, routes(surfacePrivate), "/health")
+}
+
+func TestHideRoutes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HideRoutes = true
+
+	notFound := func(s surface) string {
+		r := chi.NewRouter()
+		newRelay(cfg, nil, nil).setupRoutes(r, s)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+		require.Equal(t, http.StatusNotFound, w.Code)
+		return w.Body.String()
+	}
+	require.NotContains(t, notFound(surfaceAll), "GET /")
+	require.Contains(t, notFound(surfacePrivate), "GET /", "expected the routes to be listed on the private listener")
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query         string
+		limit, offset int
+		fails         bool
+	}{
+		{"", maxChainsLimit, 0, false},
+		{"?limit=2&offset=1", 2, 1, false},
+		{"?limit=" + strconv.Itoa(math.MaxInt), maxChainsLimit, 0, false},
+		{"?offset=" + strconv.Itoa(math.MaxInt), maxChainsLimit, math.MaxInt, false},
+		{"?limit=99999999999999999999", 0, 0, true},
+		{"?offset=99999999999999999999", 0, 0, true},
+		{"?limit=0", 0, 0, true},
+		{"?offset=-1", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			limit, offset, err := parsePagination(httptest.NewRequest(http.MethodGet, "/v2/chains"+tt.query, nil))
+			if tt.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.limit, limit)
+			require.Equal(t, tt.offset, offset)
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	chains := []string{"a", "b", "c"}
+	require.Equal(t, []string{"a", "b", "c"}, paginate(chains, maxChainsLimit, 0))
+	require.Equal(t, []string{"b"}, paginate(chains, 1, 1))
+	require.Equal(t, []string{"c"}, paginate(chains, math.MaxInt, 2))
+	require.Empty(t, paginate(chains, math.MaxInt, math.MaxInt))
+	require.Empty(t, paginate(chains, 1, 3))
+}
+
+func TestFutureRound(t *testing.T) {
+	info := &grpc.JsonInfoV2{Period: 3, GenesisTime: time.Now().Unix()}
+
+	w := httptest.NewRecorder()
+	futureRound(w, info, 11, false)
+	require.Equal(t, http.StatusTooEarly, w.Code)
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, 30, retry, 1)
+	var resp futureBeacon
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, futureBeacon{Error: "Requested future beacon", Round: 11, AvailableAt: info.GenesisTime + 30}, resp)
+
+	w = httptest.NewRecorder()
+	futureRound(w, info, math.MaxUint64, true)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, uint64(math.MaxUint64), resp.Round)
+	require.Equal(t, int64(math.MaxInt64), resp.AvailableAt, "the availability of far rounds must not overflow")
+}
+
+func TestBackendError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{fmt.Errorf("%w: unknown chain hash", grpc.ErrUnknownChain), http.StatusNotFound},
+		{fmt.Errorf("%w: round 10", grpc.ErrRoundNotAvailable), http.StatusNotFound},
+		{fmt.Errorf("%w: connection refused", grpc.ErrBackendUnavailable), http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: deadline", grpc.ErrTimeout), http.StatusGatewayTimeout},
+		{context.Canceled, http.StatusGatewayTimeout},
+		{errors.New("oops"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		backendError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err, "Failed to get beacon")
+		require.Equal(t, tt.expected, w.Code, tt.err)
+		require.Equal(t, CacheNone, w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestAcceptedRound(t *testing.T) {
+	info := &grpc.JsonInfoV2{Period: 30, GenesisTime: time.Now().Unix()}
+
+	w := httptest.NewRecorder()
+	acceptedRound(w, httptest.NewRequest(http.MethodGet, "/v2/beacons/quicknet/rounds/2?encoding=base64", nil), info, 2)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, "/v2/beacons/quicknet/rounds/2?encoding=base64", w.Header().Get("Location"))
+	require.Equal(t, CacheNone, w.Header().Get("Cache-Control"))
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, 30, retry, 1)
+	var resp pendingBeacon
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, pendingBeacon{Round: 2, AvailableAt: info.GenesisTime + 30}, resp)
+}
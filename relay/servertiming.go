@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The phases of a request reported in the Server-Timing header.
+const (
+	// timingWait is the time spent waiting for the requested round to be emitted.
+	timingWait = "wait"
+	// timingGrpc is the time spent in the grpc calls to the backends.
+	timingGrpc = "grpc"
+	// timingEncode is the time spent encoding the response.
+	timingEncode = "encode"
+)
+
+// timing is the total duration of a phase of a request.
+type timing struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTimings are the durations of the phases of a request, in the order they first occurred. They are only
+// recorded by the handler goroutine.
+type serverTimings struct {
+	start   time.Time
+	timings []timing
+}
+
+// add adds the provided duration to the named phase.
+func (st *serverTimings) add(name string, dur time.Duration) {
+	for i := range st.timings {
+		if st.timings[i].name == name {
+			st.timings[i].dur += dur
+			return
+		}
+	}
+	st.timings = append(st.timings, timing{name: name, dur: dur})
+}
+
+// header returns the Server-Timing header value, with the durations in ms and the total time until now.
+func (st *serverTimings) header() string {
+	var b strings.Builder
+	for _, t := range st.timings {
+		b.WriteString(t.name)
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(t.dur.Microseconds())/1e3, 'f', -1, 64))
+		b.WriteString(", ")
+	}
+	b.WriteString("total;dur=")
+	b.WriteString(strconv.FormatFloat(float64(time.Since(st.start).Microseconds())/1e3, 'f', -1, 64))
+	return b.String()
+}
+
+type timingCtxKey struct{}
+
+// recordTiming adds the time elapsed since start to the named phase of the request, it does nothing if the request
+// isn't timed.
+func recordTiming(r *http.Request, name string, start time.Time) {
+	if st, ok := r.Context().Value(timingCtxKey{}).(*serverTimings); ok {
+		st.add(name, time.Since(start))
+	}
+}
+
+// serverTiming adds a Server-Timing header to the responses, breaking down the time spent waiting for the round, in
+// the grpc calls and encoding the response, so that the consumers and CDN operators can see where latency originates.
+// The header is readable cross-origin thanks to the Timing-Allow-Origin header.
+func serverTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := &serverTimings{start: time.Now()}
+		w.Header().Set("Timing-Allow-Origin", "*")
+		hw := &headerHook{ResponseWriter: w, hook: func(h http.Header) { h.Set("Server-Timing", st.header()) }}
+		next.ServeHTTP(hw, r.WithContext(context.WithValue(r.Context(), timingCtxKey{}, st)))
+	})
+}
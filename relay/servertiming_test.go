@@ -0,0 +1,35 @@
+package relay
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/drand/http-server/grpc"
+)
+
+func TestServerTiming(t *testing.T) {
+	h := serverTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now().Add(-2 * time.Millisecond)
+		recordTiming(r, timingGrpc, start)
+		recordTiming(r, timingEncode, time.Now())
+		recordTiming(r, timingGrpc, start)
+		w.Write([]byte("beacon"))
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public/latest", nil))
+	require.Regexp(t, regexp.MustCompile(`^grpc;dur=[4-9][0-9.]*, encode;dur=[0-9.]+, total;dur=[0-9.]+$`), rec.Header().Get("Server-Timing"))
+	require.Equal(t, "*", rec.Header().Get("Timing-Allow-Origin"))
+
+	info := &grpc.JsonInfoV2{Period: 3, GenesisTime: time.Now().Add(-time.Minute).Unix(), Hash: bytes.Repeat([]byte{0xcd}, 32), BeaconId: "quicknet"}
+	p := NewMockProvider(info)
+	p.AddBeacons(info.Hash.String(), &grpc.HexBeacon{Round: 1, Signature: []byte{0x01}})
+	url := serveRelay(t, p, NewHub(p))
+	resp := getJSON(t, url+"/v2/beacons/quicknet/rounds/1", http.StatusOK, nil)
+	require.Regexp(t, regexp.MustCompile(`^grpc;dur=[0-9.]+, encode;dur=[0-9.]+, total;dur=[0-9.]+$`), resp.Header.Get("Server-Timing"))
+}
@@ -0,0 +1,114 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// settings are the settings of the handlers of a Relay, taken from its Config, so that several relays can run in the
+// same process. The handlers served outside of a Relay use the package variables instead, such as FrontrunTiming or
+// CacheNone, which are the defaults of the Config.
+type settings struct {
+	frontrun        time.Duration
+	futureRounds    uint64
+	acceptAfter     time.Duration
+	longPollWait    time.Duration
+	shutdownTimeout time.Duration
+	maxIntJSON      bool
+	maxIntDelay     time.Duration
+	maxWaiters      int
+	// upstream is the relay the historical rounds are read through before falling back to the grpc backends, if any
+	upstream *Upstream
+	// waiters is counting the requests waiting for the next round of each chain
+	waiters *waiterCounts
+	// drain wakes up the requests waiting for the next round once the relay is shutting down
+	drain *drainer
+	// metrics are the collectors of the http registry of the relay
+	metrics *relayMetrics
+
+	// the Cache-Control headers of the responses, see cache.go
+	cacheImmutable string
+	cacheNone      string
+	cacheInfo      string
+	latestFudge    time.Duration
+	staleReval     time.Duration
+	staleOnError   time.Duration
+	surrogateKeys  []string
+}
+
+// newSettings returns the settings of the handlers of a Relay using the provided configuration, recording their
+// metrics in m.
+func newSettings(cfg *Config, m *relayMetrics) *settings {
+	s := &settings{
+		frontrun:        cfg.Frontrun,
+		futureRounds:    cfg.FutureRounds,
+		acceptAfter:     cfg.AcceptAfter,
+		longPollWait:    cfg.LongPollMax,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		maxIntJSON:      cfg.MaxIntJSON,
+		maxIntDelay:     cfg.MaxIntDelay,
+		maxWaiters:      cfg.MaxWaiters,
+		waiters:         newWaiterCounts(m),
+		drain:           newDrainer(),
+		metrics:         m,
+		cacheImmutable:  cfg.CacheImmutable,
+		cacheNone:       cfg.CacheNone,
+		cacheInfo:       cfg.CacheInfo,
+		latestFudge:     cfg.CacheLatestFudge,
+		staleReval:      cfg.StaleWhileRevalidate,
+		staleOnError:    cfg.StaleIfError,
+	}
+	if cfg.Upstream != "" {
+		s.upstream = NewUpstream(cfg.Upstream)
+		s.upstream.metrics = m
+	}
+	if cfg.SurrogateKeyHeaders != "" {
+		s.surrogateKeys = strings.Split(cfg.SurrogateKeyHeaders, ",")
+	}
+	return s
+}
+
+// packageSettings returns the settings of the handlers served outside of a Relay, from the package variables.
+func packageSettings() *settings {
+	return &settings{
+		frontrun:        FrontrunTiming,
+		futureRounds:    FutureRounds,
+		acceptAfter:     AcceptAfter,
+		longPollWait:    LongPollWait,
+		shutdownTimeout: ShutdownTimeout,
+		maxIntJSON:      MaxIntJSON,
+		maxIntDelay:     MaxIntDelay,
+		maxWaiters:      MaxWaiters,
+		waiters:         waiters,
+		drain:           undrained,
+		metrics:         defaultMetrics,
+		cacheImmutable:  CacheImmutable,
+		cacheNone:       CacheNone,
+		cacheInfo:       CacheInfo,
+		latestFudge:     LatestFudge,
+		staleReval:      StaleWhileRevalidate,
+		staleOnError:    StaleIfError,
+		surrogateKeys:   SurrogateKeyHeaders,
+	}
+}
+
+type settingsCtxKey struct{}
+
+// withSettings provides the settings of the Relay to its handlers, it must come first.
+func withSettings(s *settings) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), settingsCtxKey{}, s)))
+		})
+	}
+}
+
+// settingsOf returns the settings of the Relay serving the request, or the package ones outside of a Relay.
+func settingsOf(r *http.Request) *settings {
+	if s, ok := r.Context().Value(settingsCtxKey{}).(*settings); ok {
+		return s
+	}
+	return packageSettings()
+}
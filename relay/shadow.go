@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// shadowTimeout bounds the duration of a single request mirrored to the shadow relay.
+	shadowTimeout = 10 * time.Second
+	// maxShadowBody bounds the size of the responses compared with the shadow relay ones.
+	maxShadowBody = 64 << 10
+	// maxShadowInflight bounds the number of requests mirrored concurrently, so that a slow shadow relay can't pile up
+	// goroutines and connections on ours, the requests beyond it aren't mirrored.
+	maxShadowInflight = 64
+)
+
+// ShadowRequests (HTTP) how the responses of the shadow relay compare to ours
+var ShadowRequests = defaultMetrics.shadowRequests
+
+// Shadow mirrors a share of the requests to a staging relay or a relay using a new backend, fire-and-forget, and
+// compares its responses to ours, to validate it before promoting it. Only the immutable responses are compared, the
+// latest beacons legitimately differ at the round boundaries. The request headers aren't forwarded, so that the
+// credentials of our clients don't leak to it.
+type Shadow struct {
+	url     string
+	percent float64
+	client  *http.Client
+	// inflight holds a token for every request being mirrored
+	inflight chan struct{}
+}
+
+// NewShadow returns a Shadow mirroring the provided percentage of the requests to the relay at the provided base URL,
+// or nil if the URL is empty.
+func NewShadow(url string, percent float64) *Shadow {
+	if url == "" {
+		return nil
+	}
+	return &Shadow{
+		url:      strings.TrimSuffix(url, "/"),
+		percent:  percent,
+		client:   &http.Client{Timeout: shadowTimeout},
+		inflight: make(chan struct{}, maxShadowInflight),
+	}
+}
+
+// cappedBuffer is a buffer dropping the writes beyond its max size, remembering that it overflowed.
+type cappedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || b.Len()+len(p) > b.max {
+		b.overflow = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// mirrorRequests is sending a share of the GET requests to the shadow relay once they are served, if any.
+func mirrorRequests(s *Shadow) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if s == nil || s.percent <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || rand.Float64()*100 >= s.percent {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			body := &cappedBuffer{max: maxShadowBody}
+			ww.Tee(body)
+			next.ServeHTTP(ww, r)
+
+			// the immutable responses are the only ones the shadow relay must serve identically
+			var expected []byte
+			if ww.Status() == http.StatusOK && ww.Header().Get("Cache-Control") == settingsOf(r).cacheImmutable && !body.overflow {
+				expected = body.Bytes()
+			}
+			m := settingsOf(r).metrics
+			select {
+			case s.inflight <- struct{}{}:
+				go func() {
+					defer func() { <-s.inflight }()
+					s.mirror(r.URL.RequestURI(), expected, m)
+				}()
+			default:
+				// the shadow relay is too slow to keep up, we don't wait for it
+				m.shadowRequests.WithLabelValues("dropped").Inc()
+			}
+		})
+	}
+}
+
+// mirror sends the request for the provided URI to the shadow relay, comparing its response to the expected one if
+// it isn't nil, and records the result in m.
+func (s *Shadow) mirror(uri string, expected []byte, m *relayMetrics) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	result := func() string {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+uri, nil)
+		if err != nil {
+			return "error"
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			slog.Debug("[Shadow] unable to mirror request", "uri", uri, "err", err)
+			return "error"
+		}
+		defer resp.Body.Close()
+		got, err := io.ReadAll(io.LimitReader(resp.Body, maxShadowBody))
+		if err != nil {
+			return "error"
+		}
+
+		switch {
+		case expected == nil:
+			return "unchecked"
+		case resp.StatusCode != http.StatusOK || !bytes.Equal(got, expected):
+			slog.Warn("[Shadow] response differs from ours", "uri", uri, "status", resp.StatusCode)
+			return "mismatch"
+		default:
+			return "match"
+		}
+	}()
+	m.shadowRequests.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,57 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorRequests(t *testing.T) {
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("shadow " + r.URL.Path))
+	}))
+	defer shadow.Close()
+
+	h := mirrorRequests(NewShadow(shadow.URL, 100))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/latest" {
+			w.Header().Set("Cache-Control", CacheImmutable)
+		}
+		w.Write([]byte("shadow /round"))
+	}))
+
+	for path, result := range map[string]string{"/round": "match", "/other": "mismatch", "/latest": "unchecked"} {
+		before := testutil.ToFloat64(ShadowRequests.WithLabelValues(result))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, "shadow /round", rr.Body.String(), "expected our response to be served")
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(ShadowRequests.WithLabelValues(result)) == before+1
+		}, 5*time.Second, 10*time.Millisecond, path)
+	}
+
+	require.Nil(t, NewShadow("", 100), "expected no shadow without URL")
+}
+
+func TestMirrorRequestsDropped(t *testing.T) {
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	s := NewShadow(shadow.URL, 100)
+	s.inflight = make(chan struct{}, 1)
+	h := mirrorRequests(s)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the first request is stuck on the shadow relay, the second one isn't mirrored
+	dropped := testutil.ToFloat64(ShadowRequests.WithLabelValues("dropped"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/round", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/round", nil))
+	require.Equal(t, dropped+1, testutil.ToFloat64(ShadowRequests.WithLabelValues("dropped")))
+	require.Len(t, s.inflight, 1)
+}
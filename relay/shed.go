@@ -0,0 +1,127 @@
+package relay
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// shedCheckInterval is how often the goroutines and the backend error rates are checked by the load shedder.
+const shedCheckInterval = time.Second
+
+// ShedRequests (HTTP) how many non-essential requests were rejected because the relay was overloaded, per reason
+var ShedRequests = defaultMetrics.shedRequests
+
+// loadShedder rejects the non-essential requests, such as the historical rounds or the route listing, once the relay
+// is overloaded, to preserve the latest and health traffic rather than degrading uniformly. A zero threshold disables
+// the corresponding check.
+type loadShedder struct {
+	maxInflight   int64
+	maxGoroutines int
+	maxErrorRate  float64
+
+	inflight atomic.Int64
+	// reason is why the relay was found overloaded by the last background check, empty if it isn't
+	reason atomic.Value
+}
+
+// newLoadShedder returns a loadShedder with the provided thresholds, or nil if they are all disabled. Its background
+// checks must be started using run.
+func newLoadShedder(maxInflight, maxGoroutines int, maxErrorRate float64) *loadShedder {
+	if maxInflight <= 0 && maxGoroutines <= 0 && maxErrorRate <= 0 {
+		return nil
+	}
+	l := &loadShedder{maxInflight: int64(maxInflight), maxGoroutines: maxGoroutines, maxErrorRate: maxErrorRate}
+	l.reason.Store("")
+	return l
+}
+
+// run checks the goroutines and the backend error rates every shedCheckInterval, until the context is done.
+func (l *loadShedder) run(ctx context.Context) {
+	ticker := time.NewTicker(shedCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.check()
+		}
+	}
+}
+
+func (l *loadShedder) check() {
+	reason := ""
+	if l.maxGoroutines > 0 && runtime.NumGoroutine() > l.maxGoroutines {
+		reason = "goroutines"
+	} else if l.maxErrorRate > 0 && backendErrorRate() > l.maxErrorRate {
+		reason = "backend_errors"
+	}
+	if prev := l.reason.Swap(reason); prev != reason && reason != "" {
+		slog.Warn("[loadShedder] relay overloaded, shedding non-essential requests", "reason", reason)
+	}
+}
+
+// backendErrorRate returns the average rolling error rate of the grpc backends.
+func backendErrorRate() float64 {
+	var sum float64
+	var n int
+	for _, b := range grpc.BalancerStates() {
+		for _, sc := range b.SubConns {
+			sum += sc.ErrorRate
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// overloaded returns why the relay is overloaded, or an empty string if it isn't.
+func (l *loadShedder) overloaded() string {
+	if l.maxInflight > 0 && l.inflight.Load() > l.maxInflight {
+		return "inflight"
+	}
+	return l.reason.Load().(string)
+}
+
+// trackInflight is counting the requests being served, for the load shedder to know about them.
+func trackInflight(l *loadShedder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l.inflight.Add(1)
+			defer l.inflight.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// shedLoad is rejecting the non-essential requests it is applied to with a 503 status when the relay is overloaded
+// according to the provided load shedder, if any.
+func shedLoad(l *loadShedder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if reason := l.overloaded(); reason != "" {
+				s := settingsOf(r)
+				s.metrics.shedRequests.WithLabelValues(reason).Inc()
+				w.Header().Set("Cache-Control", s.cacheNone)
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Overloaded, try again later", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShedLoad(t *testing.T) {
+	require.Nil(t, newLoadShedder(0, 0, 0), "expected no shedder without thresholds")
+	shedder := newLoadShedder(1, 0, 0)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	essential := trackInflight(shedder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	historical := trackInflight(shedder)(shedLoad(shedder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	rr := httptest.NewRecorder()
+	historical.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/public/1", nil))
+	require.Equal(t, http.StatusOK, rr.Code, "expected no shedding below the threshold")
+
+	done := make(chan struct{})
+	go func() {
+		essential.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public/latest", nil))
+		close(done)
+	}()
+	<-started
+
+	rr = httptest.NewRecorder()
+	historical.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/public/1", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	require.Equal(t, "5", rr.Header().Get("Retry-After"))
+	close(release)
+	<-done
+
+	shedder = newLoadShedder(0, 1, 0)
+	shedder.check()
+	require.Equal(t, "goroutines", shedder.overloaded())
+
+	// the background checks stop along with the relay
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		shedder.run(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the load shedder kept running once its context was canceled")
+	}
+}
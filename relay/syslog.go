@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package relay
+
+import (
+	"io"
+	"log/syslog"
+	"strings"
+)
+
+// newSyslogWriter returns a writer sending the logs to syslog, which journald also listens to. The address is either
+// "local" for the local syslog daemon, or a network address such as udp://host:514.
+func newSyslogWriter(addr string) (io.Writer, error) {
+	if addr == "local" {
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "drand-http-relay")
+	}
+	network, raddr, _ := strings.Cut(addr, "://")
+	return syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "drand-http-relay")
+}
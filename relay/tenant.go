@@ -0,0 +1,268 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	// TenantRequests (HTTP) how many v2 API requests were served to each tenant
+	TenantRequests = defaultMetrics.tenantRequests
+
+	// TenantBytes (HTTP) how many bytes were served to each tenant
+	TenantBytes = defaultMetrics.tenantBytes
+)
+
+// tenant is a consumer of the relay using its own API key, with its own limits and allowed chains, whose usage is
+// metered.
+type tenant struct {
+	name   string
+	limits tokenLimits
+	// chains are the chainhashes and beacon IDs the tenant may use, all of them when empty
+	chains []string
+
+	requests atomic.Uint64
+	errors   atomic.Uint64
+	bytes    atomic.Uint64
+}
+
+// allows returns whether the tenant may use the chain with the provided chainhash and beacon ID.
+func (t *tenant) allows(hash, beaconID string) bool {
+	return len(t.chains) == 0 || slices.Contains(t.chains, hash) || slices.Contains(t.chains, beaconID)
+}
+
+// tenants are the tenants of the relay, by name and by the sha256 of their API key, so that the lookups don't leak
+// timing information about the keys themselves.
+type tenants struct {
+	byName map[string]*tenant
+	byKey  map[[sha256.Size]byte]*tenant
+}
+
+// parseTenants reads tenants definitions, one per line in the form "name key rate quota [chains]", where chains is a
+// comma separated list of chainhashes or beacon IDs. Empty lines and lines starting with # are ignored.
+func parseTenants(r io.Reader) (*tenants, error) {
+	ts := &tenants{byName: make(map[string]*tenant), byKey: make(map[[sha256.Size]byte]*tenant)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || len(fields) > 5 {
+			// we don't print the line, since it holds a key
+			return nil, fmt.Errorf("invalid tenant on line %d, expected: name key rate quota [chains]", n)
+		}
+		rate, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate on line %d: %q", n, fields[2])
+		}
+		quota, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota on line %d: %q", n, fields[3])
+		}
+		if _, ok := ts.byName[fields[0]]; ok {
+			return nil, fmt.Errorf("duplicate tenant %q on line %d", fields[0], n)
+		}
+		key := sha256.Sum256([]byte(fields[1]))
+		if _, ok := ts.byKey[key]; ok {
+			return nil, fmt.Errorf("duplicate key for tenant %q on line %d", fields[0], n)
+		}
+
+		t := &tenant{name: fields[0], limits: tokenLimits{rate: rate, quota: quota}}
+		if len(fields) == 5 {
+			t.chains = strings.Split(fields[4], ",")
+		}
+		ts.byName[t.name] = t
+		ts.byKey[key] = t
+	}
+	return ts, scanner.Err()
+}
+
+// loadTenants loads the tenants from the provided --tenants file.
+func loadTenants(path string) (*tenants, error) {
+	if path == "" {
+		return nil, errors.New("no tenants file provided using --tenants")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ts, err := parseTenants(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(ts.byName) == 0 {
+		return nil, fmt.Errorf("no tenants defined in %s", path)
+	}
+	return ts, nil
+}
+
+// apiKeys returns the API keys of the tenants, named after them, to authenticate them like the --api-keys ones.
+func (ts *tenants) apiKeys() apiKeys {
+	keys := make(apiKeys, len(ts.byKey))
+	for k, t := range ts.byKey {
+		keys[k] = apiKey{name: t.name}
+	}
+	return keys
+}
+
+// tenantOf returns the tenant of the authenticated caller of the request, if any.
+func (ts *tenants) tenantOf(r *http.Request) *tenant {
+	id := requestIdentity(r)
+	if id == nil {
+		return nil
+	}
+	return ts.byName[id.subject]
+}
+
+// tenantChains is returning a 403 for requests targeting a chain their tenant may not use. It relies on the route URL
+// parameters, so it must be used in an inline group rather than on a sub-router.
+func tenantChains(c BeaconProvider, ts *tenants) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := ts.tenantOf(r)
+			if t == nil || len(t.chains) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			m, err := createRequestMD(r)
+			if err != nil {
+				// the handlers are dealing with invalid requests themselves
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the chains can be designated by chainhash or beacon ID either way, so we rely on the chain info
+			info, err := c.GetChainInfo(r.Context(), m)
+			if err != nil {
+				backendError(w, r, err, "Failed to get chain info")
+				return
+			}
+			if !t.allows(info.Hash.String(), info.BeaconId) {
+				slog.Debug("[tenantChains] request for a chain not allowed to the tenant", "tenant", t.name, "chainhash", info.Hash)
+				http.Error(w, "Chain not allowed", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type chainFilterCtxKey struct{}
+
+// filterTenantChains restricts the chains served by the routes serving several chains at once, such as /v2/latest,
+// to the ones the tenant of the request may use, see allowsChain. It must be used after the authentication middleware.
+func filterTenantChains(ts *tenants) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := ts.tenantOf(r)
+			if t == nil || len(t.chains) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chainFilterCtxKey{}, t.allows)))
+		})
+	}
+}
+
+// allowsChain returns whether the request may be served the chain with the provided chainhash and beacon ID, which is
+// always the case unless restricted by filterTenantChains.
+func allowsChain(r *http.Request, hash, beaconID string) bool {
+	allows, ok := r.Context().Value(chainFilterCtxKey{}).(func(hash, beaconID string) bool)
+	return !ok || allows(hash, beaconID)
+}
+
+// meterTenants records the requests and the bytes served to each tenant. It must be used after the authentication
+// middleware, the requests without tenant aren't metered.
+func meterTenants(ts *tenants) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := ts.tenantOf(r)
+			if t == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			status := ww.Status()
+			if status == 0 {
+				// nothing was written, the server answers with an empty 200
+				status = http.StatusOK
+			}
+
+			t.requests.Add(1)
+			if status >= http.StatusBadRequest {
+				t.errors.Add(1)
+			}
+			t.bytes.Add(uint64(ww.BytesWritten()))
+			m := settingsOf(r).metrics
+			m.tenantRequests.WithLabelValues(t.name, strconv.Itoa(status/100)+"xx").Inc()
+			m.tenantBytes.WithLabelValues(t.name).Add(float64(ww.BytesWritten()))
+		})
+	}
+}
+
+// tenantReport is the usage of a tenant since the relay started, as reported on /tenants.
+type tenantReport struct {
+	Name     string   `json:"name"`
+	Chains   []string `json:"chains,omitempty"`
+	Rate     float64  `json:"rate_limit"`
+	Quota    uint64   `json:"daily_quota"`
+	Requests uint64   `json:"requests"`
+	Errors   uint64   `json:"errors"`
+	Bytes    uint64   `json:"bytes"`
+}
+
+// report returns the usage of all the tenants, sorted by name.
+func (ts *tenants) report() []tenantReport {
+	reports := make([]tenantReport, 0, len(ts.byName))
+	for _, t := range ts.byName {
+		reports = append(reports, tenantReport{
+			Name:     t.name,
+			Chains:   t.chains,
+			Rate:     t.limits.rate,
+			Quota:    t.limits.quota,
+			Requests: t.requests.Load(),
+			Errors:   t.errors.Load(),
+			Bytes:    t.bytes.Load(),
+		})
+	}
+	slices.SortFunc(reports, func(a, b tenantReport) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return reports
+}
+
+// serveTenants serves the usage report of the tenants in JSON, it is empty when tenants are disabled.
+func serveTenants(ts *tenants) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reports := []tenantReport{}
+		if ts != nil {
+			reports = ts.report()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", settingsOf(r).cacheNone)
+		if err := json.NewEncoder(w).Encode(reports); err != nil {
+			slog.Error("[serveTenants] unable to encode tenants report", "err", err)
+		}
+	}
+}
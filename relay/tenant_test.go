@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/drand/http-server/grpc"
+)
+
+func TestParseTenants(t *testing.T) {
+	ts, err := parseTenants(strings.NewReader("# comment\n\nacme key1 10 1000\nglobex key2 0 0 quicknet,default\n"))
+	require.NoError(t, err)
+	require.Len(t, ts.byName, 2)
+	require.Equal(t, tokenLimits{rate: 10, quota: 1000}, ts.byName["acme"].limits)
+	require.Empty(t, ts.byName["acme"].chains)
+	require.Equal(t, []string{"quicknet", "default"}, ts.byName["globex"].chains)
+	require.True(t, ts.byName["globex"].allows("abcd", "quicknet"))
+	require.False(t, ts.byName["globex"].allows("abcd", "evmnet"))
+	require.Len(t, ts.apiKeys(), 2)
+
+	for _, invalid := range []string{"acme key1 10", "acme key1 fast 10", "acme key1 -1 10", "acme key1 1 -10", "acme key1 1 1 a b",
+		"acme key1 1 1\nacme key2 1 1", "acme key1 1 1\nglobex key1 1 1"} {
+		_, err := parseTenants(strings.NewReader(invalid))
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	quicknet := &grpc.JsonInfoV2{Period: 3, Hash: bytes.Repeat([]byte{0xcd}, 32), BeaconId: "quicknet"}
+	evmnet := &grpc.JsonInfoV2{Period: 3, Hash: bytes.Repeat([]byte{0xef}, 32), BeaconId: "evmnet"}
+	p := NewMockProvider(quicknet, evmnet)
+
+	path := filepath.Join(t.TempDir(), "tenants")
+	require.NoError(t, os.WriteFile(path, []byte("acme key1 0 0\nglobex key2 0 0 quicknet\n"), 0o600))
+	cfg := DefaultConfig()
+	cfg.RequireAuth, cfg.AuthMode, cfg.TenantsFile = true, "tenant", path
+	rl := newRelay(cfg, p, NewHub(p))
+	t.Cleanup(rl.close)
+	require.NoError(t, rl.setupAuth())
+	srv := httptest.NewServer(rl.handler(surfaceAll))
+	t.Cleanup(srv.Close)
+
+	status := func(key, path string) int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", key)
+		resp, _ := get(t, req)
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, status("key1", "/v2/beacons/evmnet/info"))
+	require.Equal(t, http.StatusOK, status("key2", "/v2/beacons/quicknet/info"))
+	require.Equal(t, http.StatusOK, status("key2", "/v2/chains/"+quicknet.Hash.String()+"/info"))
+	require.Equal(t, http.StatusForbidden, status("key2", "/v2/beacons/evmnet/info"))
+	require.Equal(t, http.StatusForbidden, status("key2", "/v2/chains/"+evmnet.Hash.String()+"/info"))
+	require.Equal(t, http.StatusUnauthorized, status("key3", "/v2/beacons/quicknet/info"))
+
+	rec := httptest.NewRecorder()
+	serveTenants(rl.tenants)(rec, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+	var reports []tenantReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reports))
+	require.Len(t, reports, 2)
+	require.Equal(t, "acme", reports[0].Name)
+	require.Equal(t, uint64(1), reports[0].Requests)
+	require.Zero(t, reports[0].Errors)
+	require.Positive(t, reports[0].Bytes)
+	require.Equal(t, "globex", reports[1].Name)
+	require.Equal(t, uint64(4), reports[1].Requests)
+	require.Equal(t, uint64(2), reports[1].Errors)
+	require.Equal(t, []string{"quicknet"}, reports[1].Chains)
+
+	rec = httptest.NewRecorder()
+	serveTenants(nil)(rec, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+	require.JSONEq(t, "[]", rec.Body.String())
+
+	// the latest beacons of all the chains only include the ones allowed to the tenant
+	p.AddBeacons(quicknet.Hash.String(), &grpc.HexBeacon{Round: 1, Signature: []byte{0x01}})
+	p.AddBeacons(evmnet.Hash.String(), &grpc.HexBeacon{Round: 1, Signature: []byte{0x02}})
+	latest := func(key string) map[string]json.RawMessage {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v2/latest", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", key)
+		resp, body := get(t, req)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		var all map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(body, &all))
+		return all
+	}
+	require.Len(t, latest("key1"), 2)
+	all := latest("key2")
+	require.Len(t, all, 1)
+	require.Contains(t, all, quicknet.Hash.String())
+}
@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+)
+
+const (
+	// upstreamTimeout bounds the duration of a single request to the upstream relay.
+	upstreamTimeout = 5 * time.Second
+	// maxUpstreamBody bounds the size of the beacons read from the upstream relay.
+	maxUpstreamBody = 64 << 10
+)
+
+// UpstreamRequests (HTTP) how many historical rounds were requested to the upstream relay, per result
+var UpstreamRequests = defaultMetrics.upstreamRequests
+
+// errInvalidUpstreamBeacon is returned by Upstream.Beacon when the upstream beacon fails verification.
+var errInvalidUpstreamBeacon = errors.New("invalid upstream beacon")
+
+// Upstream fetches the historical rounds from another relay over https, e.g. api.drand.sh, to reduce the load on our
+// own grpc backends. Its beacons are always verified since we don't trust it more than the backends.
+type Upstream struct {
+	url     string
+	client  *http.Client
+	metrics *relayMetrics
+}
+
+// NewUpstream returns an Upstream for the relay at the provided base URL.
+func NewUpstream(url string) *Upstream {
+	return &Upstream{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  &http.Client{Timeout: upstreamTimeout},
+		metrics: defaultMetrics,
+	}
+}
+
+// Beacon fetches and verifies the provided round of the chain from the upstream relay.
+func (u *Upstream) Beacon(ctx context.Context, info *grpc.JsonInfoV2, round uint64) (*grpc.HexBeacon, error) {
+	url := u.url + "/v2/chains/" + info.Hash.String() + "/rounds/" + strconv.FormatUint(round, 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// we drain the body to allow the connection to be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxUpstreamBody))
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var beacon grpc.HexBeacon
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxUpstreamBody)).Decode(&beacon); err != nil {
+		return nil, fmt.Errorf("invalid beacon: %w", err)
+	}
+	if beacon.Round != round {
+		return nil, fmt.Errorf("got round %d instead of %d", beacon.Round, round)
+	}
+	beacon.ApplyScheme(info.Scheme)
+	if err := info.Verify(&beacon); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidUpstreamBeacon, err)
+	}
+	return &beacon, nil
+}
+
+// historicalBeacon returns the provided past round, read through the upstream relay u if there is one, falling back to
+// the grpc backends when it fails. Every request to the upstream relay is counted once in UpstreamRequests, as a hit,
+// an invalid beacon or a miss.
+func historicalBeacon(ctx context.Context, u *Upstream, c BeaconProvider, m *proto.Metadata, info *grpc.JsonInfoV2, round uint64) (*grpc.HexBeacon, error) {
+	if u != nil {
+		beacon, err := u.Beacon(ctx, info, round)
+		if err == nil {
+			u.metrics.upstreamRequests.WithLabelValues("hit").Inc()
+			return beacon, nil
+		}
+		result := "miss"
+		if errors.Is(err, errInvalidUpstreamBeacon) {
+			result = "invalid"
+		}
+		u.metrics.upstreamRequests.WithLabelValues(result).Inc()
+		slog.Warn("[Upstream] unable to get beacon, falling back to the grpc backends", "round", round, "err", err)
+	}
+	return c.GetBeacon(ctx, m, round)
+}
@@ -0,0 +1,83 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	proto "github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/http-server/grpc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamBeacon(t *testing.T) {
+	url, chain := newTestRelay(t, DefaultConfig())
+	var info grpc.JsonInfoV2
+	getJSON(t, url+"/v2/chains/"+chain+"/info", http.StatusOK, &info)
+	var expected grpc.HexBeacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/5", http.StatusOK, &expected)
+
+	beacon, err := NewUpstream(url+"/").Beacon(context.Background(), &info, 5)
+	require.NoError(t, err)
+	require.Equal(t, &expected, beacon)
+
+	// the beacons of the upstream relay are never trusted
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"round":5,"signature":"abcd"}`))
+	}))
+	defer fake.Close()
+	_, err = NewUpstream(fake.URL).Beacon(context.Background(), &info, 5)
+	require.ErrorIs(t, err, errInvalidUpstreamBeacon, "expected an invalid signature to be rejected")
+	_, err = NewUpstream(fake.URL).Beacon(context.Background(), &info, 6)
+	require.Error(t, err, "expected another round to be rejected")
+
+	_, err = NewUpstream(url).Beacon(context.Background(), &info, 1<<40)
+	require.Error(t, err, "expected a future round to be rejected")
+}
+
+// backendBeacons is a BeaconProvider serving the provided beacon for every round.
+type backendBeacons struct {
+	BeaconProvider
+	beacon *grpc.HexBeacon
+}
+
+func (b backendBeacons) GetBeacon(context.Context, *proto.Metadata, uint64) (*grpc.HexBeacon, error) {
+	return b.beacon, nil
+}
+
+func TestHistoricalBeaconResults(t *testing.T) {
+	url, chain := newTestRelay(t, DefaultConfig())
+	var info grpc.JsonInfoV2
+	getJSON(t, url+"/v2/chains/"+chain+"/info", http.StatusOK, &info)
+	var expected grpc.HexBeacon
+	getJSON(t, url+"/v2/chains/"+chain+"/rounds/5", http.StatusOK, &expected)
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"round":5,"signature":"abcd"}`))
+	}))
+	defer invalid.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	backend := backendBeacons{beacon: &expected}
+	// every request is counted under a single result
+	for upstream, result := range map[string]string{url: "hit", invalid.URL: "invalid", down.URL: "miss"} {
+		counts := make(map[string]float64)
+		for _, r := range []string{"hit", "invalid", "miss"} {
+			counts[r] = testutil.ToFloat64(UpstreamRequests.WithLabelValues(r))
+		}
+		beacon, err := historicalBeacon(context.Background(), NewUpstream(upstream), backend, nil, &info, 5)
+		require.NoError(t, err)
+		require.Equal(t, &expected, beacon)
+		for _, r := range []string{"hit", "invalid", "miss"} {
+			want := counts[r]
+			if r == result {
+				want++
+			}
+			require.Equal(t, want, testutil.ToFloat64(UpstreamRequests.WithLabelValues(r)), "%s counted as %s", result, r)
+		}
+	}
+}
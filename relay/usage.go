@@ -0,0 +1,267 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// usagePushTimeout bounds the duration of a single push of the usage summaries.
+const usagePushTimeout = 30 * time.Second
+
+// usageCounts are the requests, and the failed ones among them, of a caller on a route.
+type usageCounts struct {
+	Requests uint64 `json:"requests"`
+	Errors   uint64 `json:"errors"`
+}
+
+// callerUsage is the usage of a caller, identified either by its token or by its IP address, during an export interval.
+type callerUsage struct {
+	Kind     string                  `json:"kind"`
+	Caller   string                  `json:"caller"`
+	Requests uint64                  `json:"requests"`
+	Errors   uint64                  `json:"errors"`
+	Routes   map[string]*usageCounts `json:"routes"`
+}
+
+// usageSummary is the usage of all the callers during an export interval.
+type usageSummary struct {
+	Start   time.Time      `json:"start"`
+	End     time.Time      `json:"end"`
+	Callers []*callerUsage `json:"callers"`
+}
+
+// usageMeter counts the requests of every caller per route, until they are flushed to be exported.
+type usageMeter struct {
+	trusted []netip.Prefix
+
+	mu      sync.Mutex
+	start   time.Time
+	callers map[[2]string]*callerUsage
+}
+
+func newUsageMeter(trusted []netip.Prefix) *usageMeter {
+	return &usageMeter{trusted: trusted, start: time.Now(), callers: make(map[[2]string]*callerUsage)}
+}
+
+// record counts a request of the provided caller on the provided route.
+func (u *usageMeter) record(kind, caller, route string, failed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c, ok := u.callers[[2]string{kind, caller}]
+	if !ok {
+		c = &callerUsage{Kind: kind, Caller: caller, Routes: make(map[string]*usageCounts)}
+		u.callers[[2]string{kind, caller}] = c
+	}
+	counts, ok := c.Routes[route]
+	if !ok {
+		counts = &usageCounts{}
+		c.Routes[route] = counts
+	}
+	c.Requests++
+	counts.Requests++
+	if failed {
+		c.Errors++
+		counts.Errors++
+	}
+}
+
+// flush returns the usage since the previous flush, sorted by caller, and starts a new interval.
+func (u *usageMeter) flush(now time.Time) *usageSummary {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s := &usageSummary{Start: u.start, End: now, Callers: make([]*callerUsage, 0, len(u.callers))}
+	for _, c := range u.callers {
+		s.Callers = append(s.Callers, c)
+	}
+	slices.SortFunc(s.Callers, func(a, b *callerUsage) int {
+		if a.Kind != b.Kind {
+			return strings.Compare(a.Kind, b.Kind)
+		}
+		return strings.Compare(a.Caller, b.Caller)
+	})
+	u.start = now
+	u.callers = make(map[[2]string]*callerUsage)
+	return s
+}
+
+type usageCtxKey struct{}
+
+// setUsageCaller records the token of the authenticated caller of a metered request, it does nothing if the request
+// isn't metered.
+func setUsageCaller(r *http.Request, token string) {
+	if caller, ok := r.Context().Value(usageCtxKey{}).(*string); ok {
+		*caller = token
+	}
+}
+
+// meterUsage records every request in the usage meter, per route and per caller: its token if it is authenticated,
+// or else its IP address.
+func meterUsage(u *usageMeter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), usageCtxKey{}, &token)))
+
+			kind, caller := "token", token
+			if token == "" {
+				kind = "ip"
+				if addr, err := clientIP(r, u.trusted); err == nil {
+					caller = addr.String()
+				} else {
+					caller = r.RemoteAddr
+				}
+			}
+			route := "other"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			u.record(kind, caller, route, ww.Status() >= http.StatusBadRequest)
+		})
+	}
+}
+
+// usageExporter periodically exports the usage summaries to a JSON lines or CSV file, according to its extension, or
+// pushes them in JSON to an http endpoint. If the DRAND_USAGE_TOKEN env variable is set, the pushes carry it as a
+// bearer token.
+type usageExporter struct {
+	meter  *usageMeter
+	target string
+	token  string
+	client *http.Client
+}
+
+func newUsageExporter(meter *usageMeter, target string) *usageExporter {
+	token, _ := os.LookupEnv("DRAND_USAGE_TOKEN")
+	return &usageExporter{meter: meter, target: target, token: token, client: &http.Client{Timeout: usagePushTimeout}}
+}
+
+// run exports the usage every interval until ctx is done, exporting the last partial interval then.
+func (e *usageExporter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.export(e.meter.flush(time.Now()))
+			return
+		case now := <-ticker.C:
+			e.export(e.meter.flush(now))
+		}
+	}
+}
+
+func (e *usageExporter) export(s *usageSummary) {
+	var err error
+	switch {
+	case isUsageURL(e.target):
+		err = e.push(s)
+	case strings.HasSuffix(e.target, ".csv"):
+		err = e.appendCSV(s)
+	default:
+		err = e.appendJSON(s)
+	}
+	if err != nil {
+		slog.Error("[usageExporter] unable to export usage", "target", e.target, "callers", len(s.Callers), "err", err)
+		return
+	}
+	slog.Debug("[usageExporter] exported usage", "target", e.target, "callers", len(s.Callers))
+}
+
+// isUsageURL returns whether the usage export target is an http endpoint rather than a file.
+func isUsageURL(target string) bool {
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+}
+
+// appendJSON appends the summary to the export file, as a single line of JSON.
+func (e *usageExporter) appendJSON(s *usageSummary) error {
+	f, err := os.OpenFile(e.target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(s)
+}
+
+// usageCSVHeader are the columns of the CSV export, which has a row per caller and route.
+var usageCSVHeader = []string{"start", "end", "kind", "caller", "route", "requests", "errors"}
+
+// appendCSV appends the summary to the export file, writing the CSV header first if the file is new.
+func (e *usageExporter) appendCSV(s *usageSummary) error {
+	f, err := os.OpenFile(e.target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if st.Size() == 0 {
+		w.Write(usageCSVHeader)
+	}
+	start, end := s.Start.UTC().Format(time.RFC3339), s.End.UTC().Format(time.RFC3339)
+	for _, c := range s.Callers {
+		routes := make([]string, 0, len(c.Routes))
+		for route := range c.Routes {
+			routes = append(routes, route)
+		}
+		slices.Sort(routes)
+		for _, route := range routes {
+			counts := c.Routes[route]
+			w.Write([]string{start, end, c.Kind, c.Caller, route,
+				strconv.FormatUint(counts.Requests, 10), strconv.FormatUint(counts.Errors, 10)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// push posts the summary in JSON to the export endpoint.
+func (e *usageExporter) push(s *usageSummary) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), usagePushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// we drain the body to allow the connection to be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
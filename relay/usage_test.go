@@ -0,0 +1,100 @@
+package relay
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeterUsage(t *testing.T) {
+	u := newUsageMeter(nil)
+	r := chi.NewRouter()
+	r.Use(meterUsage(u))
+	r.Get("/public/{round}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "" {
+			r = withIdentity(r, "alice", nil)
+		}
+		if chi.URLParam(r, "round") == "0" {
+			http.Error(w, "invalid round", http.StatusBadRequest)
+		}
+	})
+
+	for _, req := range []struct{ path, key string }{{"/public/1", ""}, {"/public/0", ""}, {"/public/1", "secret"}, {"/other", "secret"}} {
+		rq := httptest.NewRequest(http.MethodGet, req.path, nil)
+		rq.RemoteAddr = "192.0.2.1:1234"
+		if req.key != "" {
+			rq.Header.Set("X-API-Key", req.key)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), rq)
+	}
+
+	s := u.flush(time.Now())
+	require.Len(t, s.Callers, 2)
+	ip := s.Callers[0]
+	require.Equal(t, "ip", ip.Kind)
+	require.Equal(t, "192.0.2.1", ip.Caller)
+	require.Equal(t, uint64(3), ip.Requests, "the requests never reaching the authentication are counted by IP")
+	require.Equal(t, uint64(2), ip.Errors)
+	require.Equal(t, &usageCounts{Requests: 2, Errors: 1}, ip.Routes["/public/{round}"])
+	require.Equal(t, &usageCounts{Requests: 1, Errors: 1}, ip.Routes["other"])
+	token := s.Callers[1]
+	require.Equal(t, "token", token.Kind)
+	require.Equal(t, "alice", token.Caller)
+	require.Equal(t, &usageCounts{Requests: 1}, token.Routes["/public/{round}"])
+
+	require.Empty(t, u.flush(time.Now()).Callers, "the usage must be reset once flushed")
+}
+
+func TestUsageExport(t *testing.T) {
+	u := newUsageMeter(nil)
+	u.record("ip", "192.0.2.1", "/public/{round}", false)
+	u.record("token", "alice", "/v2/chains", true)
+	s := u.flush(time.Now())
+
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "usage.jsonl")
+	newUsageExporter(u, jsonFile).export(s)
+	newUsageExporter(u, jsonFile).export(s)
+	f, err := os.Open(jsonFile)
+	require.NoError(t, err)
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		var got usageSummary
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &got))
+		require.Len(t, got.Callers, 2)
+	}
+	require.Equal(t, 2, lines)
+
+	csvFile := filepath.Join(dir, "usage.csv")
+	newUsageExporter(u, csvFile).export(s)
+	newUsageExporter(u, csvFile).export(s)
+	raw, err := os.ReadFile(csvFile)
+	require.NoError(t, err)
+	rows := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	require.Len(t, rows, 5, "expected the header only once")
+	require.Equal(t, strings.Join(usageCSVHeader, ","), rows[0])
+	require.True(t, strings.HasSuffix(rows[2], ",token,alice,/v2/chains,1,1"), rows[2])
+
+	t.Setenv("DRAND_USAGE_TOKEN", "secret")
+	pushed := make(chan usageSummary, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var got usageSummary
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		pushed <- got
+	}))
+	defer srv.Close()
+	newUsageExporter(u, srv.URL).export(s)
+	require.Len(t, (<-pushed).Callers, 2)
+}
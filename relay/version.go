@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// commit is the git commit the relay was built from, it can be set at build time using -ldflags
+// "-X github.com/drand/http-server/relay.commit=$(git rev-parse HEAD)" and otherwise defaults to the one recorded by
+// the Go toolchain.
+var commit = ""
+
+// apiVersions are the versions of the HTTP API served by the relay.
+var apiVersions = []string{"v1", "v2"}
+
+// buildInfo is the build information of the relay served on the /version endpoints.
+type buildInfo struct {
+	Version     string   `json:"version"`
+	Commit      string   `json:"commit"`
+	GoVersion   string   `json:"go_version"`
+	APIVersions []string `json:"api_versions"`
+}
+
+func getBuildInfo() buildInfo {
+	rev := commit
+	if rev == "" {
+		rev = "unknown"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					rev = s.Value
+				}
+			}
+		}
+	}
+
+	return buildInfo{
+		Version:     Version,
+		Commit:      rev,
+		GoVersion:   runtime.Version(),
+		APIVersions: apiVersions,
+	}
+}
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drand/http-server/grpc"
+)
+
+// MaxWaiters is the default maximum number of requests that may wait for the next round of a given chain at the same
+// time, further requests get a 503 status. Unlimited when set to 0.
+var MaxWaiters = 0
+
+// waiters is counting the requests waiting for the next round of each chain, outside of a Relay.
+var waiters = newWaiterCounts(defaultMetrics)
+
+// waiterCounts is counting the requests waiting for the next round of each chain.
+type waiterCounts struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	metrics *relayMetrics
+}
+
+func newWaiterCounts(m *relayMetrics) *waiterCounts {
+	return &waiterCounts{counts: make(map[string]int), metrics: m}
+}
+
+// acquire registers a new waiter on the chain, returning false if there are already limit of them, unless it is 0.
+func (wc *waiterCounts) acquire(chain string, limit int) bool {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if limit > 0 && wc.counts[chain] >= limit {
+		wc.metrics.rateLimitRequests.WithLabelValues("waiters", "rejected").Inc()
+		return false
+	}
+	wc.metrics.rateLimitRequests.WithLabelValues("waiters", "allowed").Inc()
+	wc.counts[chain]++
+	wc.metrics.rateLimitKeys.WithLabelValues("waiters").Set(float64(len(wc.counts)))
+	return true
+}
+
+// release unregisters a waiter acquired on the chain.
+func (wc *waiterCounts) release(chain string) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.counts[chain]--
+	if wc.counts[chain] <= 0 {
+		delete(wc.counts, chain)
+	}
+	wc.metrics.rateLimitKeys.WithLabelValues("waiters").Set(float64(len(wc.counts)))
+}
+
+// tooManyWaiters replies with a 503 status and a Retry-After header set to the time of the next round, when the
+// waiting requests would have been served anyway.
+func (s *settings) tooManyWaiters(w http.ResponseWriter, info *grpc.JsonInfoV2) {
+	nextTime, _ := info.ExpectedNext()
+	w.Header().Set("Cache-Control", s.cacheNone)
+	w.Header().Set("Retry-After", strconv.FormatInt(max(nextTime-time.Now().Unix(), 1), 10))
+	http.Error(w, "Too many requests waiting for the next round", http.StatusServiceUnavailable)
+}
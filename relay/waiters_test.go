@@ -0,0 +1,20 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaiterCounts(t *testing.T) {
+	wc := newWaiterCounts(defaultMetrics)
+	require.True(t, wc.acquire("a", 2))
+	require.True(t, wc.acquire("a", 2), "expected to acquire up to the limit of waiters")
+	require.False(t, wc.acquire("a", 2), "expected the third waiter to be rejected")
+	require.True(t, wc.acquire("b", 2), "expected the limit to be per chain")
+
+	wc.release("a")
+	require.True(t, wc.acquire("a", 2), "expected a released waiter to make room")
+
+	require.True(t, wc.acquire("a", 0), "expected no limit when it is 0")
+}
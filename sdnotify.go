@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends the provided state, e.g. READY=1, to the systemd notification socket. It does nothing when the relay
+// isn't run by systemd with Type=notify, that is when the NOTIFY_SOCKET env variable is not set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns the interval at which systemd expects the watchdog pings, which is half of the
+// WatchdogSec configured in the unit, or 0 if the watchdog is disabled.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog pings the systemd watchdog as long as the http server answers on the provided /ping URL, so that systemd
+// restarts the relay when it is wedged. It returns when the context is done.
+func sdWatchdog(ctx context.Context, pingURL string) {
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	client := &http.Client{Timeout: interval / 2}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		resp, err := client.Get(pingURL)
+		if err != nil {
+			slog.Error("[sdWatchdog] relay not answering, skipping watchdog ping", "err", err)
+			continue
+		}
+		// any status will do, e.g. a 403 due to --ip-allow, we only care about the relay answering
+		resp.Body.Close()
+
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			slog.Error("[sdWatchdog] unable to notify systemd", "err", err)
+		}
+	}
+}